@@ -50,7 +50,7 @@ post-push:
 # Docker Build Target
 docker-build: .release
 	@echo "Building Docker image..."
-	docker build -t $(IMAGE):$(VERSION) . || { echo "ERROR: Docker build failed"; exit 1; }
+	docker build --build-arg VERSION=$(VERSION) -t $(IMAGE):$(VERSION) . || { echo "ERROR: Docker build failed"; exit 1; }
 
 	# Check Docker version and apply appropriate tagging
 	@DOCKER_MAJOR=$(shell docker -v | sed -e 's/.*version //' -e 's/,.*//' | cut -d\. -f1) ; \
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// zoneAccount holds the credentials of the TransIP account that is
+// authoritative for the zones under a zone suffix.
+type zoneAccount struct {
+	AccountName         string               `json:"accountName"`
+	PrivateKeySecretRef v1.SecretKeySelector `json:"privateKeySecretRef"`
+}
+
+// validateAccounts checks the zone suffixes and credentials of the accounts
+// of the config.
+func (cfg *transipDNSProviderConfig) validateAccounts() error {
+	suffixes := make([]string, 0, len(cfg.Accounts))
+	for suffix := range cfg.Accounts {
+		suffixes = append(suffixes, suffix)
+	}
+	sort.Strings(suffixes)
+
+	var errs []error
+	for _, suffix := range suffixes {
+		account := cfg.Accounts[suffix]
+		if msgs := validation.IsDNS1123Subdomain(normalizeZone(suffix)); len(msgs) > 0 {
+			errs = append(errs, fmt.Errorf("accounts[%q]: invalid zone suffix: %s", suffix, strings.Join(msgs, ", ")))
+		}
+		if account.AccountName == "" {
+			errs = append(errs, fmt.Errorf("accounts[%q]: accountName is required", suffix))
+		}
+		if account.PrivateKeySecretRef.Name == "" || account.PrivateKeySecretRef.Key == "" {
+			errs = append(errs, fmt.Errorf("accounts[%q]: privateKeySecretRef.name and privateKeySecretRef.key are required", suffix))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// forZone returns the config to authenticate with for zone: when an account
+// is configured for the longest zone suffix matching zone, a copy of the
+// config authenticating as that account, and the config itself otherwise.
+func (cfg *transipDNSProviderConfig) forZone(zone string) *transipDNSProviderConfig {
+	zone = normalizeZone(zone)
+
+	best := ""
+	var account zoneAccount
+	for suffix, a := range cfg.Accounts {
+		suffix = normalizeZone(suffix)
+		if (zone == suffix || strings.HasSuffix(zone, "."+suffix)) && len(suffix) > len(best) {
+			best, account = suffix, a
+		}
+	}
+	if best == "" {
+		return cfg
+	}
+
+	zoneCfg := *cfg
+	zoneCfg.AccountName = account.AccountName
+	zoneCfg.AccountNameSecretRef = v1.SecretKeySelector{}
+	zoneCfg.PrivateKey = nil
+	zoneCfg.PrivateKeySecretRef = account.PrivateKeySecretRef
+	zoneCfg.PrivateKeyPath = ""
+	zoneCfg.CredentialsDir = ""
+	zoneCfg.Token = ""
+	zoneCfg.TokenSecretRef = v1.SecretKeySelector{}
+	zoneCfg.Accounts = nil
+
+	return &zoneCfg
+}
+
+// normalizeZone returns zone in lower case without its trailing dot.
+func normalizeZone(zone string) string {
+	return strings.ToLower(strings.TrimSuffix(zone, "."))
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6"
+)
+
+func secretKeySelector(name, key string) v1.SecretKeySelector {
+	return v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: name}, Key: key}
+}
+
+func TestForZone(t *testing.T) {
+	cfg := &transipDNSProviderConfig{
+		AccountName: "default",
+		PrivateKey:  []byte("key"),
+		Accounts: map[string]zoneAccount{
+			"example.com":      {AccountName: "example", PrivateKeySecretRef: secretKeySelector("example", "privateKey")},
+			"sub.example.com.": {AccountName: "sub", PrivateKeySecretRef: secretKeySelector("sub", "privateKey")},
+			"example.org":      {AccountName: "org", PrivateKeySecretRef: secretKeySelector("org", "privateKey")},
+		},
+	}
+
+	tests := map[string]string{
+		"example.com.":         "example",
+		"EXAMPLE.com":          "example",
+		"www.example.com.":     "example",
+		"sub.example.com.":     "sub",
+		"a.sub.example.com.":   "sub",
+		"example.org.":         "org",
+		"notexample.com.":      "default",
+		"example.net.":         "default",
+		"com.":                 "default",
+		"sub.example.com.net.": "default",
+	}
+
+	for zone, want := range tests {
+		zoneCfg := cfg.forZone(zone)
+		if zoneCfg.AccountName != want {
+			t.Errorf("zone %s: expected account %q, got %q", zone, want, zoneCfg.AccountName)
+		}
+		if want == "default" {
+			if zoneCfg != cfg {
+				t.Errorf("zone %s: expected the config itself", zone)
+			}
+			continue
+		}
+		if zoneCfg.PrivateKey != nil || zoneCfg.PrivateKeySecretRef.Name != want || zoneCfg.Accounts != nil {
+			t.Errorf("zone %s: expected only the credentials of the account, got %+v", zone, zoneCfg)
+		}
+	}
+}
+
+func TestLoadConfigAccounts(t *testing.T) {
+	tests := map[string]struct {
+		config  string
+		wantErr string
+	}{
+		"valid": {
+			config: `{"accountName": "user", "privateKey": "a2V5", "accounts": {"example.com": {"accountName": "example", "privateKeySecretRef": {"name": "example", "key": "privateKey"}}}}`,
+		},
+		"invalid suffix": {
+			config:  `{"accountName": "user", "privateKey": "a2V5", "accounts": {"example..com": {"accountName": "example", "privateKeySecretRef": {"name": "example", "key": "privateKey"}}}}`,
+			wantErr: `accounts["example..com"]: invalid zone suffix`,
+		},
+		"missing account name": {
+			config:  `{"accountName": "user", "privateKey": "a2V5", "accounts": {"example.com": {"privateKeySecretRef": {"name": "example", "key": "privateKey"}}}}`,
+			wantErr: `accounts["example.com"]: accountName is required`,
+		},
+		"missing secret key": {
+			config:  `{"accountName": "user", "privateKey": "a2V5", "accounts": {"example.com": {"accountName": "example", "privateKeySecretRef": {"name": "example"}}}}`,
+			wantErr: `accounts["example.com"]: privateKeySecretRef.name and privateKeySecretRef.key are required`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadConfig(&extapi.JSON{Raw: []byte(tt.config)})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewTransipClientZoneAccount(t *testing.T) {
+	// The accounts are told apart by their names, so they share a key.
+	privateKey := testPrivateKey(t)
+
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "example-credentials", Namespace: "default"},
+		Data:       map[string][]byte{"privateKey": privateKey},
+	})
+	cfg := &transipDNSProviderConfig{
+		AccountName: "default",
+		PrivateKey:  privateKey,
+		Accounts: map[string]zoneAccount{
+			"example.com": {AccountName: "example", PrivateKeySecretRef: secretKeySelector("example-credentials", "privateKey")},
+		},
+	}
+
+	tests := map[string]string{
+		"example.com.":     "example",
+		"sub.example.com.": "example",
+		"example.org.":     "default",
+	}
+
+	for zone, want := range tests {
+		t.Run(zone, func(t *testing.T) {
+			var configs []gotransip.ClientConfiguration
+			solver := &transipDNSProviderSolver{client: client, newClient: recordClientConfigs(&configs)}
+
+			ch := &v1alpha1.ChallengeRequest{ResourceNamespace: "default", ResolvedZone: zone}
+			if _, err := solver.NewTransipClient(context.Background(), ch, cfg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(configs) != 1 || configs[0].AccountName != want {
+				t.Fatalf("expected a client for account %q, got %+v", want, configs)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// ambientCredentials are the TransIP credentials the webhook is deployed
+// with, used by Issuers that configure none of their own.
+type ambientCredentials struct {
+	accountName    string
+	privateKeyPath string
+}
+
+// loadAmbientCredentials returns the ambient credentials from the
+// environment, or nil when allowAmbientCredentialsEnvVar is not set.
+func loadAmbientCredentials() (*ambientCredentials, error) {
+	allowed, err := envBool(allowAmbientCredentialsEnvVar)
+	if err != nil || !allowed {
+		return nil, err
+	}
+
+	ambient := &ambientCredentials{
+		accountName:    os.Getenv(ambientAccountNameEnvVar),
+		privateKeyPath: os.Getenv(ambientPrivateKeyPathEnvVar),
+	}
+	if ambient.accountName == "" || ambient.privateKeyPath == "" {
+		return nil, fmt.Errorf("%s requires %s and %s to be set", allowAmbientCredentialsEnvVar, ambientAccountNameEnvVar, ambientPrivateKeyPathEnvVar)
+	}
+	return ambient, nil
+}
+
+// hasCredentials reports whether the config sets any of the fields
+// identifying the TransIP account or its credentials.
+func (cfg *transipDNSProviderConfig) hasCredentials() bool {
+	return cfg.AccountName != "" || cfg.AccountNameSecretRef.Name != "" || len(cfg.PrivateKey) > 0 || cfg.PrivateKeySecretRef.Name != "" ||
+		cfg.PrivateKeyPath != "" || cfg.CredentialsDir != "" || cfg.usesToken()
+}
+
+// errAmbientCredentialsNotAllowed is returned for challenges of Issuers that
+// configure no credentials when cert-manager does not allow them to use
+// ambient credentials.
+var errAmbientCredentialsNotAllowed = errors.New("the Issuer configures no TransIP credentials and cert-manager does not allow it to use ambient credentials: set credentials in the webhook config of the Issuer, or use a ClusterIssuer")
+
+// ambientCredentialsAllowed reports whether the challenge may use the ambient
+// credentials: the webhook must be deployed with them, and cert-manager must
+// allow the Issuer of the challenge to use ambient credentials, which it does
+// for ClusterIssuers and, with --issuer-ambient-credentials, for Issuers.
+func (c *transipDNSProviderSolver) ambientCredentialsAllowed(ch *v1alpha1.ChallengeRequest) bool {
+	return ch.AllowAmbientCredentials && c.ambientCredentials != nil
+}
+
+// checkAmbientCredentials returns errAmbientCredentialsNotAllowed when cfg,
+// as returned by credentialsFor, sets no credentials because the webhook has
+// ambient credentials that the challenge may not use.
+func (c *transipDNSProviderSolver) checkAmbientCredentials(ch *v1alpha1.ChallengeRequest, cfg *transipDNSProviderConfig) error {
+	if c.ambientCredentials != nil && !ch.AllowAmbientCredentials && !cfg.hasCredentials() {
+		return errAmbientCredentialsNotAllowed
+	}
+	return nil
+}
+
+// credentialsFor returns the config to authenticate with for the challenge:
+// that of the account of its zone, or a copy using the ambient credentials
+// when the config sets no credentials and the challenge may use ambient
+// credentials. Credentials in the config always take precedence over ambient
+// ones.
+func (c *transipDNSProviderSolver) credentialsFor(ch *v1alpha1.ChallengeRequest, cfg *transipDNSProviderConfig) *transipDNSProviderConfig {
+	cfg = cfg.forZone(ch.ResolvedZone)
+	if !c.ambientCredentialsAllowed(ch) || cfg.hasCredentials() {
+		return cfg
+	}
+
+	ambientCfg := *cfg
+	ambientCfg.AccountName = c.ambientCredentials.accountName
+	ambientCfg.PrivateKeyPath = c.ambientCredentials.privateKeyPath
+	return &ambientCfg
+}
+
+// loadConfig decodes the config of a challenge, on top of the default config
+// of the solver, with loadConfig. When the challenge may use ambient
+// credentials, a missing config is decoded as an empty one, so that Issuers
+// can rely on the ambient credentials entirely.
+func (c *transipDNSProviderSolver) loadConfig(ch *v1alpha1.ChallengeRequest) (*transipDNSProviderConfig, error) {
+	cfgJSON, err := c.withDefaultConfig(ch.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := loadConfig(cfgJSON)
+	if !errors.Is(err, errNoConfig) || c.ambientCredentials == nil {
+		return cfg, err
+	}
+	if !ch.AllowAmbientCredentials {
+		return nil, fmt.Errorf("%w: %w", err, errAmbientCredentialsNotAllowed)
+	}
+	return loadConfig(&extapi.JSON{Raw: []byte("{}")})
+}
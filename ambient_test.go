@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6"
+)
+
+func TestLoadAmbientCredentials(t *testing.T) {
+	t.Run("not allowed", func(t *testing.T) {
+		t.Setenv(ambientAccountNameEnvVar, "ambient")
+		t.Setenv(ambientPrivateKeyPathEnvVar, "/etc/transip/privateKey")
+
+		ambient, err := loadAmbientCredentials()
+		if err != nil || ambient != nil {
+			t.Fatalf("expected no ambient credentials, got %+v, %v", ambient, err)
+		}
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		t.Setenv(allowAmbientCredentialsEnvVar, "true")
+		t.Setenv(ambientAccountNameEnvVar, "ambient")
+		t.Setenv(ambientPrivateKeyPathEnvVar, "/etc/transip/privateKey")
+
+		ambient, err := loadAmbientCredentials()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := (ambientCredentials{accountName: "ambient", privateKeyPath: "/etc/transip/privateKey"}); ambient == nil || *ambient != want {
+			t.Errorf("expected %+v, got %+v", want, ambient)
+		}
+	})
+
+	t.Run("allowed without credentials", func(t *testing.T) {
+		t.Setenv(allowAmbientCredentialsEnvVar, "true")
+
+		if _, err := loadAmbientCredentials(); err == nil || !strings.Contains(err.Error(), "requires TRANSIP_ACCOUNT_NAME and TRANSIP_PRIVATE_KEY_PATH") {
+			t.Fatalf("expected an error naming the missing variables, got %v", err)
+		}
+	})
+}
+
+func TestNewTransipClientAmbientCredentials(t *testing.T) {
+	privateKey := testPrivateKey(t)
+	keyPath := filepath.Join(t.TempDir(), "privateKey")
+	if err := os.WriteFile(keyPath, privateKey, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ambient := &ambientCredentials{accountName: "ambient", privateKeyPath: keyPath}
+
+	tests := map[string]struct {
+		ambient     *ambientCredentials
+		allow       bool
+		cfg         *transipDNSProviderConfig
+		wantAccount string
+		wantErr     string
+	}{
+		"empty config": {
+			ambient:     ambient,
+			allow:       true,
+			cfg:         &transipDNSProviderConfig{TTL: 300},
+			wantAccount: "ambient",
+		},
+		"config takes precedence": {
+			ambient:     ambient,
+			allow:       true,
+			cfg:         &transipDNSProviderConfig{AccountName: "user", PrivateKey: privateKey},
+			wantAccount: "user",
+		},
+		"config without ambient credentials allowed": {
+			ambient:     ambient,
+			cfg:         &transipDNSProviderConfig{AccountName: "user", PrivateKey: privateKey},
+			wantAccount: "user",
+		},
+		"incomplete config": {
+			ambient: ambient,
+			allow:   true,
+			cfg:     &transipDNSProviderConfig{AccountName: "user"},
+			wantErr: "missing privateKey, privateKeySecretRef or privateKeyPath",
+		},
+		"not allowed": {
+			allow:   true,
+			cfg:     &transipDNSProviderConfig{TTL: 300},
+			wantErr: "missing accountName and privateKey, privateKeySecretRef or privateKeyPath",
+		},
+		"not allowed by cert-manager": {
+			ambient: ambient,
+			cfg:     &transipDNSProviderConfig{TTL: 300},
+			wantErr: "does not allow it to use ambient credentials",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var configs []gotransip.ClientConfiguration
+			solver := &transipDNSProviderSolver{ambientCredentials: tt.ambient, newClient: recordClientConfigs(&configs)}
+
+			ch := &v1alpha1.ChallengeRequest{ResourceNamespace: "default", AllowAmbientCredentials: tt.allow}
+			_, err := solver.NewTransipClient(context.Background(), ch, tt.cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(configs) != 1 || configs[0].AccountName != tt.wantAccount {
+				t.Errorf("expected a client for account %q, got %+v", tt.wantAccount, configs)
+			}
+		})
+	}
+}
+
+func TestPresentWithoutConfigAmbientCredentials(t *testing.T) {
+	ch := newChallengeRequest(t, "example.com", testKey, nil)
+	ch.Config = nil
+
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+	if err := solver.Present(ch); !errors.Is(err, errNoConfig) {
+		t.Fatalf("expected errNoConfig without ambient credentials, got %v", err)
+	}
+
+	solver.ambientCredentials = &ambientCredentials{accountName: "ambient", privateKeyPath: "/etc/transip/privateKey"}
+	if err := solver.Present(ch); !errors.Is(err, errAmbientCredentialsNotAllowed) {
+		t.Fatalf("expected errAmbientCredentialsNotAllowed when cert-manager does not allow ambient credentials, got %v", err)
+	}
+
+	ch.AllowAmbientCredentials = true
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPresentAmbientCredentialsNotAllowed(t *testing.T) {
+	privateKey := testPrivateKey(t)
+	keyPath := filepath.Join(t.TempDir(), "privateKey")
+	if err := os.WriteFile(keyPath, privateKey, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The solver creates a TransIP client for the challenge, which the
+	// ambient credentials must not be used for.
+	var configs []gotransip.ClientConfiguration
+	solver, _ := newTestSolver(nil)
+	solver.repositoryFactory = nil
+	solver.newClient = recordClientConfigs(&configs)
+	solver.ambientCredentials = &ambientCredentials{accountName: "ambient", privateKeyPath: keyPath}
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	ch.AllowAmbientCredentials = false
+
+	if err := solver.Present(ch); !errors.Is(err, errAmbientCredentialsNotAllowed) {
+		t.Fatalf("expected errAmbientCredentialsNotAllowed, got %v", err)
+	}
+	if len(configs) != 0 {
+		t.Errorf("expected no client for the ambient account, got %+v", configs)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6/domain"
+)
+
+// The actions recorded in the audit trail.
+const (
+	auditCreated = "created"
+	auditUpdated = "updated"
+	auditRemoved = "removed"
+)
+
+// auditReasons holds the reason of the Kubernetes Event recorded for each
+// action.
+var auditReasons = map[string]string{
+	auditCreated: "DNSRecordCreated",
+	auditUpdated: "DNSRecordUpdated",
+	auditRemoved: "DNSRecordRemoved",
+}
+
+// auditComponent is the source of the Kubernetes Events recorded for the audit
+// trail.
+const auditComponent = "cert-manager-webhook-transip"
+
+// eventRecorder records the changes to DNS entries as Kubernetes Events on the
+// webhook's own Pod. ChallengeRequests do not identify the Challenge they are
+// for, so the Events cannot be attached to it.
+type eventRecorder struct {
+	client    kubernetes.Interface
+	namespace string
+	pod       string
+	log       logr.Logger
+
+	// seq keeps the names of Events recorded at the same time apart.
+	seq atomic.Uint64
+}
+
+// Record creates an Event for action on entry. Failing to create it is logged
+// and does not fail the challenge.
+func (r *eventRecorder) Record(ctx context.Context, ch *v1alpha1.ChallengeRequest, action, domainName string, entry domain.DNSEntry, now time.Time) {
+	timestamp := metav1.NewTime(now)
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x.%d", r.pod, now.UnixNano(), r.seq.Add(1)),
+			Namespace: r.namespace,
+		},
+		InvolvedObject: v1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Namespace:  r.namespace,
+			Name:       r.pod,
+		},
+		Reason:              auditReasons[action],
+		Message:             fmt.Sprintf("%s record %q in domain %s %s for a challenge in namespace %s", entry.Type, entry.Name, domainName, action, ch.ResourceNamespace),
+		Type:                v1.EventTypeNormal,
+		Source:              v1.EventSource{Component: auditComponent},
+		ReportingController: auditComponent,
+		ReportingInstance:   r.pod,
+		FirstTimestamp:      timestamp,
+		LastTimestamp:       timestamp,
+		Count:               1,
+	}
+
+	if _, err := r.client.CoreV1().Events(r.namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		r.log.Error(err, "could not record the audit event", "action", action, "domain", domainName, "name", entry.Name)
+	}
+}
+
+// audit records that entry was created, updated or removed in the audit log,
+// and as a Kubernetes Event when audit events are enabled. The content of the
+// entry, which holds the challenge key, is left out of both. Nothing is
+// recorded in test mode, where the entries are not changed.
+func (c *transipDNSProviderSolver) audit(ctx context.Context, ch *v1alpha1.ChallengeRequest, cfg *transipDNSProviderConfig, action, domainName string, entry domain.DNSEntry) {
+	if cfg.TestMode {
+		return
+	}
+
+	now := c.now()
+	c.logger().Info("audit", "action", action, "domain", domainName, "name", entry.Name, "type", entry.Type, "ttl", entry.Expire,
+		"fqdn", ch.ResolvedFQDN, "namespace", ch.ResourceNamespace, "time", now.UTC().Format(time.RFC3339))
+
+	if c.events != nil {
+		c.events.Record(ctx, ch, action, domainName, entry, now)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/transip/gotransip/v6/domain"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAuditPresentCleanUp(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	client := fake.NewSimpleClientset()
+
+	repo := newFakeDNSRepository("example.com")
+	solver, logs := newTestSolver(repo)
+	solver.timeNow = func() time.Time { return now }
+	solver.events = &eventRecorder{client: client, namespace: "cert-manager", pod: "transip-webhook-0", log: solver.log}
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	ch.ResourceNamespace = "team-a"
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error presenting: %v", err)
+	}
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error cleaning up: %v", err)
+	}
+
+	for _, action := range []string{auditCreated, auditRemoved} {
+		if !logs.Contains(`"action"="` + action + `" "domain"="example.com" "name"="_acme-challenge"`) {
+			t.Errorf("expected an audit log line for %s, got logs:\n%s", action, logs)
+		}
+	}
+	if !logs.Contains(`"time"="2024-05-01T12:00:00Z"`) {
+		t.Errorf("expected the audit log to hold the time, got logs:\n%s", logs)
+	}
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, `"audit"`) && strings.Contains(line, testKey) {
+			t.Errorf("expected the audit log to leave out the challenge key, got %s", line)
+		}
+	}
+
+	events, err := client.CoreV1().Events("cert-manager").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reasons []string
+	for _, e := range events.Items {
+		reasons = append(reasons, e.Reason)
+		if e.InvolvedObject.Kind != "Pod" || e.InvolvedObject.Name != "transip-webhook-0" {
+			t.Errorf("expected the event to involve the webhook pod, got %+v", e.InvolvedObject)
+		}
+		if strings.Contains(e.Message, testKey) {
+			t.Errorf("expected the event to leave out the challenge key, got %q", e.Message)
+		}
+	}
+	sort.Strings(reasons)
+	if strings.Join(reasons, ",") != "DNSRecordCreated,DNSRecordRemoved" {
+		t.Errorf("expected a created and a removed event, got %v", reasons)
+	}
+}
+
+func TestAuditEventsDisabled(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, logs := newTestSolver(repo)
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !logs.Contains(`"action"="created"`) {
+		t.Errorf("expected the audit log line without audit events, got logs:\n%s", logs)
+	}
+}
+
+func TestAuditEveryRemovedEntry(t *testing.T) {
+	// A duplicate of the challenge record, e.g. left behind by an earlier
+	// run, is removed along with it.
+	repo := newFakeDNSRepository("example.com",
+		domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: testKey},
+		domain.DNSEntry{Name: "_acme-challenge", Expire: 60, Type: "TXT", Content: testKey},
+	)
+	solver, logs := newTestSolver(repo)
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, ttl := range []string{"300", "60"} {
+		if !logs.Contains(`"action"="removed" "domain"="example.com" "name"="_acme-challenge" "type"="TXT" "ttl"=` + ttl) {
+			t.Errorf("expected an audit log line for the record with TTL %s, got logs:\n%s", ttl, logs)
+		}
+	}
+}
+
+func TestAuditSkippedInTestMode(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	repo := newFakeDNSRepository("example.com")
+	solver, logs := newTestSolver(repo)
+	solver.events = &eventRecorder{client: client, namespace: "cert-manager", pod: "transip-webhook-0", log: solver.log}
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "testMode": true})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error presenting: %v", err)
+	}
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error cleaning up: %v", err)
+	}
+
+	if logs.Contains(`"msg"="audit"`) {
+		t.Errorf("expected no audit log line in test mode, got logs:\n%s", logs)
+	}
+	events, err := client.CoreV1().Events("cert-manager").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 0 {
+		t.Errorf("expected no events in test mode, got %d", len(events.Items))
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// acmeKeyLength is the length of a DNS-01 challenge key: the unpadded
+// base64url encoding of a SHA-256 digest.
+const acmeKeyLength = 43
+
+// validateChallengeKey checks that key looks like an ACME DNS-01 challenge
+// key, catching corrupted values before a record is created. The key itself
+// is never included in the error.
+func validateChallengeKey(key string) error {
+	if len(key) != acmeKeyLength {
+		return fmt.Errorf("invalid challenge key: expected %d base64url characters, got %d", acmeKeyLength, len(key))
+	}
+
+	digest, err := base64.RawURLEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("invalid challenge key: not unpadded base64url: %v", err)
+	}
+	if len(digest) != 32 {
+		return fmt.Errorf("invalid challenge key: expected a 32 byte digest, got %d bytes", len(digest))
+	}
+
+	return nil
+}
+
+// maxTXTStringLength is the length limit of a single TXT character-string.
+const maxTXTStringLength = 255
+
+// validateTXTContent checks that content can be stored as a single TXT
+// character-string: at most 255 printable ASCII characters, without quotes or
+// backslashes that would need escaping.
+func validateTXTContent(content string) error {
+	if len(content) > maxTXTStringLength {
+		return fmt.Errorf("invalid TXT content: longer than %d characters", maxTXTStringLength)
+	}
+
+	for i := 0; i < len(content); i++ {
+		if c := content[i]; c < ' ' || c > '~' || c == '"' || c == '\\' {
+			return fmt.Errorf("invalid TXT content: unsupported character %q at offset %d", c, i)
+		}
+	}
+
+	return nil
+}
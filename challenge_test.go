@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+func TestValidateChallengeKey(t *testing.T) {
+	tests := map[string]struct {
+		key     string
+		wantErr string
+	}{
+		"valid key": {
+			key: testKey,
+		},
+		"too short": {
+			key:     testKey[:20],
+			wantErr: "expected 43 base64url characters, got 20",
+		},
+		"standard base64 alphabet": {
+			key:     strings.NewReplacer("-", "+", "_", "/").Replace(testKey),
+			wantErr: "not unpadded base64url",
+		},
+		"invalid characters": {
+			key:     strings.Repeat("!", acmeKeyLength),
+			wantErr: "not unpadded base64url",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateChallengeKey(tt.key)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPresentRejectsInvalidChallengeKey(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	ch := newChallengeRequest(t, "example.com", "not-a-challenge-key", map[string]interface{}{"ttl": 300})
+	if err := solver.Present(ch); err == nil {
+		t.Fatal("expected an error for an invalid challenge key")
+	}
+
+	if got := repo.Calls("AddDNSEntry"); got != 0 {
+		t.Errorf("expected no AddDNSEntry calls, got %d", got)
+	}
+}
+
+func TestPresentSkipKeyValidation(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	ch := newChallengeRequest(t, "example.com", "not-a-challenge-key", map[string]interface{}{"ttl": 300, "skipKeyValidation": true})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := repo.Calls("AddDNSEntry"); got != 1 {
+		t.Errorf("expected 1 AddDNSEntry call, got %d", got)
+	}
+}
+
+func TestValidateTXTContent(t *testing.T) {
+	valid := []string{testKey, "v=" + testKey + ";", ""}
+	for _, content := range valid {
+		if err := validateTXTContent(content); err != nil {
+			t.Errorf("validateTXTContent(%q): unexpected error: %v", content, err)
+		}
+	}
+
+	invalid := []string{`"` + testKey + `"`, testKey + "\n", strings.Repeat("a", 256), "café"}
+	for _, content := range invalid {
+		if err := validateTXTContent(content); err == nil {
+			t.Errorf("validateTXTContent(%q): expected an error", content)
+		}
+	}
+}
+
+func TestPresentCleanUpContentWrapper(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	cfg := map[string]interface{}{"ttl": 300, "contentPrefix": "key=", "contentSuffix": ";v1"}
+	ch := newChallengeRequest(t, "example.com", testKey, cfg)
+	other := newChallengeRequest(t, "example.com", otherTestKey, cfg)
+
+	for _, c := range []*v1alpha1.ChallengeRequest{ch, other} {
+		if err := solver.Present(c); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	entries := repo.Entries("example.com")
+	if len(entries) != 2 || entries[0].Content != "key="+testKey+";v1" {
+		t.Fatalf("expected wrapped record contents, got %v", entries)
+	}
+
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries = repo.Entries("example.com")
+	if len(entries) != 1 || entries[0].Content != "key="+otherTestKey+";v1" {
+		t.Errorf("expected only the other challenge's record to remain, got %v", entries)
+	}
+}
+
+func TestPresentRejectsInvalidContentWrapper(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "contentPrefix": `"`})
+	if err := solver.Present(ch); err == nil {
+		t.Fatal("expected an error for wrapped content that is not a valid TXT string")
+	}
+
+	if got := repo.Calls("AddDNSEntry"); got != 0 {
+		t.Errorf("expected no AddDNSEntry calls, got %d", got)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/transip/gotransip/v6/domain"
+)
+
+// cleanupSummary records what CleanUp did with the TXT records found at the
+// name of the challenge record.
+type cleanupSummary struct {
+	// Removed is the number of records matching the challenge that were
+	// removed.
+	Removed int
+	// Skipped is the number of records at the same name that were kept,
+	// because they belong to other challenges.
+	Skipped int
+	// Gone is the number of records matching the challenge that TransIP
+	// could no longer find when removing them, typically because a
+	// concurrent cleanup removed them first.
+	Gone int
+}
+
+// notFound reports whether no record matching the challenge was found.
+func (s cleanupSummary) notFound() bool {
+	return s.Removed == 0 && s.Gone == 0
+}
+
+// log emits the summary as a single structured log line.
+func (s cleanupSummary) log(log logr.Logger, domainName, recordName string) {
+	log.Info("cleanup summary",
+		"domain", domainName,
+		"name", recordName,
+		"removed", s.Removed,
+		"skipped", s.Skipped,
+		"notFound", s.notFound(),
+		"alreadyRemoved", s.Gone,
+	)
+}
+
+// notFoundSeverity selects how a cleanup that finds no record matching the
+// challenge is reported.
+type notFoundSeverity string
+
+const (
+	// notFoundSilent only reports the cleanup in its summary.
+	notFoundSilent notFoundSeverity = "silent"
+	// notFoundWarn logs a warning and counts the cleanup in
+	// cleanupNotFoundTotal.
+	notFoundWarn notFoundSeverity = "warn"
+	// notFoundError additionally fails the cleanup.
+	notFoundError notFoundSeverity = "error"
+)
+
+// parseNotFoundSeverity returns the severity named s, defaulting to a warning.
+func parseNotFoundSeverity(s string) (notFoundSeverity, error) {
+	switch notFoundSeverity(s) {
+	case "":
+		return notFoundWarn, nil
+	case notFoundSilent, notFoundWarn, notFoundError:
+		return notFoundSeverity(s), nil
+	default:
+		return "", fmt.Errorf("invalid cleanupNotFound %q: expected one of %q, %q or %q", s, notFoundSilent, notFoundWarn, notFoundError)
+	}
+}
+
+// reportNotFound reports that no record matching entry was found in the
+// domain on cleanup, e.g. because the record was never presented, with the
+// configured severity.
+func (c *transipDNSProviderSolver) reportNotFound(cfg *transipDNSProviderConfig, domainName string, entry domain.DNSEntry) error {
+	severity, err := parseNotFoundSeverity(cfg.CleanupNotFound)
+	if err != nil {
+		return err
+	}
+	if severity == notFoundSilent {
+		return nil
+	}
+
+	cleanupNotFoundTotal.Inc()
+	if severity == notFoundError {
+		return fmt.Errorf("no DNS record %s with the challenge key found in domain %s", entry.Name, domainName)
+	}
+
+	c.logger().Info("WARNING: no DNS record with the challenge key found on cleanup, it may never have been presented",
+		"domain", domainName, "name", entry.Name)
+	return nil
+}
+
+// removeUnlistedEntry removes entry without having been able to list the
+// entries of the domain, treating an entry TransIP cannot find as already
+// removed. The entry is removed with the TTL it was presented with when that
+// was recorded, and with the configured TTL otherwise.
+func (c *transipDNSProviderSolver) removeUnlistedEntry(ctx context.Context, ch *v1alpha1.ChallengeRequest, repo dnsRepository, cfg *transipDNSProviderConfig, domainName string, entry domain.DNSEntry) error {
+	var summary cleanupSummary
+
+	if ttl, ok := c.ttls.Lookup(domainName, entry); ok {
+		entry.Expire = ttl
+	}
+
+	err := repo.RemoveDNSEntry(domainName, entry)
+	switch {
+	case err == nil:
+		summary.Removed++
+		c.audit(ctx, ch, cfg, auditRemoved, domainName, entry)
+	case !isNotFound(err):
+		return err
+	}
+	c.ttls.Forget(domainName, entry)
+
+	summary.log(c.logger(), domainName, entry.Name)
+
+	if summary.Removed == 0 {
+		return c.reportNotFound(cfg, domainName, entry)
+	}
+	return nil
+}
+
+// removeExistingRecord removes the copies of the challenge record entry from
+// the domain, whatever their TTL, so that forceUpdate adds the record again.
+// It returns the entries of the domain that are left. Other TXT records with
+// the same name, such as those of other challenges, are never removed.
+func (c *transipDNSProviderSolver) removeExistingRecord(repo dnsRepository, cfg *transipDNSProviderConfig, domainName string, entries []domain.DNSEntry, entry domain.DNSEntry) ([]domain.DNSEntry, error) {
+	var removed []int
+	kept := make([]domain.DNSEntry, 0, len(entries))
+	for i, e := range entries {
+		if sameRecord(e, entry) {
+			removed = append(removed, i)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	if len(removed) == 0 {
+		return entries, nil
+	}
+
+	c.logger().Info("removing the existing challenge record to add it again, as forceUpdate is set", "domain", domainName, "name", entry.Name, "records", len(removed))
+	if _, err := removeEntries(repo, domainName, entries, removed, entry, cfg.BatchUpdates); err != nil {
+		c.logger().Error(err, "could not remove the existing challenge record", "domain", domainName, "name", entry.Name)
+		return nil, err
+	}
+	return kept, nil
+}
+
+// removeEntries removes the entries at the indices in removed from the domain,
+// returning the entries it removed. An entry TransIP no longer finds,
+// e.g. because a concurrent cleanup removed it, is skipped. When batch is
+// set, the remaining entries replace those of the domain in a single call;
+// this relies on the caller holding the domain lock so entries are current,
+// which takes leases when several replicas change the domain. Without batch,
+// entries are removed one by one even from large domains, as replacing all
+// entries would drop those added since they were listed. The remaining
+// entries are written back exactly as they were listed, so no field TransIP
+// returned for them is lost.
+//
+// As a safeguard against removing records the webhook did not create, no
+// entry is removed when any of the entries to remove is not a TXT record with
+// the name and content of challenge.
+func removeEntries(repo dnsRepository, domainName string, entries []domain.DNSEntry, removed []int, challenge domain.DNSEntry, batch bool) ([]domain.DNSEntry, error) {
+	for _, i := range removed {
+		if !matchesChallenge(entries[i], challenge) {
+			return nil, fmt.Errorf("refusing to remove the %s record %s of domain %s, which does not match the challenge", entries[i].Type, entries[i].Name, domainName)
+		}
+	}
+
+	if !batch {
+		var done []domain.DNSEntry
+		for _, i := range removed {
+			err := repo.RemoveDNSEntry(domainName, entries[i])
+			switch {
+			case err == nil:
+				done = append(done, entries[i])
+			case !isNotFound(err):
+				return done, err
+			}
+		}
+		return done, nil
+	}
+
+	skip := make(map[int]bool, len(removed))
+	done := make([]domain.DNSEntry, 0, len(removed))
+	for _, i := range removed {
+		skip[i] = true
+		done = append(done, entries[i])
+	}
+	kept := make([]domain.DNSEntry, 0, len(entries)-len(removed))
+	for i, e := range entries {
+		if !skip[i] {
+			kept = append(kept, e)
+		}
+	}
+
+	if err := repo.ReplaceDNSEntries(domainName, kept); err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// addEntry adds entry to the domain whose current entries are entries. When
+// batch is set, entries and entry replace those of the domain in a single
+// call; like removeEntries, this relies on the caller holding the domain lock.
+func addEntry(repo dnsRepository, domainName string, entries []domain.DNSEntry, entry domain.DNSEntry, batch bool) error {
+	if !batch {
+		return repo.AddDNSEntry(domainName, entry)
+	}
+
+	all := make([]domain.DNSEntry, 0, len(entries)+1)
+	all = append(all, entries...)
+	return repo.ReplaceDNSEntries(domainName, append(all, entry))
+}
+
+// replaceEntry replaces the entry old of the domain, whose current entries
+// are entries, by entry, by removing old and adding entry or, when batch is
+// set, in a single call. Like addEntry, this relies on the caller holding the
+// domain lock.
+func replaceEntry(repo dnsRepository, domainName string, entries []domain.DNSEntry, old, entry domain.DNSEntry, batch bool) error {
+	if !batch {
+		if err := repo.RemoveDNSEntry(domainName, old); err != nil && !isNotFound(err) {
+			return err
+		}
+		return repo.AddDNSEntry(domainName, entry)
+	}
+
+	all := make([]domain.DNSEntry, 0, len(entries))
+	for _, e := range entries {
+		if e == old {
+			e = entry
+		}
+		all = append(all, e)
+	}
+	return repo.ReplaceDNSEntries(domainName, all)
+}
+
+// matchesChallenge reports whether entry is the TXT record built for the
+// challenge as challenge, comparing only its name and content. The TTL is
+// ignored, as the record may have been presented with another TTL than the
+// one configured now, or had it jittered or normalized by TransIP.
+func matchesChallenge(entry, challenge domain.DNSEntry) bool {
+	return entry.Type == "TXT" && sameRecordName(entry.Name, challenge.Name) && entry.Content == challenge.Content
+}
@@ -0,0 +1,666 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/transip/gotransip/v6/domain"
+	"github.com/transip/gotransip/v6/rest"
+)
+
+func TestCleanUpSummary(t *testing.T) {
+	repo := newFakeDNSRepository("example.com",
+		domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: otherTestKey},
+		domain.DNSEntry{Name: "www", Expire: 300, Type: "CNAME", Content: "example.com."},
+		domain.DNSEntry{Name: "@", Expire: 300, Type: "TXT", Content: "v=spf1 -all"},
+	)
+	solver, logs := newTestSolver(repo)
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `"msg"="cleanup summary" "domain"="example.com" "name"="_acme-challenge" "removed"=1 "skipped"=1 "notFound"=false`
+	if !logs.Contains(want) {
+		t.Errorf("expected summary %s, got logs:\n%s", want, logs)
+	}
+
+	// A second cleanup no longer finds the record.
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want = `"removed"=0 "skipped"=1 "notFound"=true`
+	if !logs.Contains(want) {
+		t.Errorf("expected summary %s, got logs:\n%s", want, logs)
+	}
+}
+
+func TestPresentCleanUpAfterRestart(t *testing.T) {
+	// The record was presented before the webhook restarted; the new solver
+	// only knows about it through the TransIP API.
+	repo := newFakeDNSRepository("example.com",
+		domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: testKey},
+	)
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+
+	solver, _ := newTestSolver(repo)
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := repo.Calls("AddDNSEntry"); got != 0 {
+		t.Errorf("expected the existing record not to be added again, got %d AddDNSEntry calls", got)
+	}
+
+	solver, _ = newTestSolver(repo)
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entries := repo.Entries("example.com"); len(entries) != 0 {
+		t.Errorf("expected the record to be removed after a restart, got %v", entries)
+	}
+}
+
+// largeDomain returns n A records followed by the challenge records of
+// testKey and otherTestKey.
+func largeDomain(n int) []domain.DNSEntry {
+	entries := make([]domain.DNSEntry, 0, n+2)
+	for i := 0; i < n; i++ {
+		entries = append(entries, domain.DNSEntry{Name: fmt.Sprintf("host%d", i), Expire: 300, Type: "A", Content: "192.0.2.1"})
+	}
+	return append(entries,
+		domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: testKey},
+		domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: otherTestKey},
+	)
+}
+
+func TestCleanUpLargeDomain(t *testing.T) {
+	entries := largeDomain(500)
+	repo := newFakeDNSRepository("example.com", entries...)
+	solver, _ := newTestSolver(repo)
+
+	if err := solver.CleanUp(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "batchUpdates": true})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := repo.Calls("ReplaceDNSEntries"); got != 1 {
+		t.Errorf("expected a single ReplaceDNSEntries call, got %d", got)
+	}
+	if got := repo.Calls("RemoveDNSEntry"); got != 0 {
+		t.Errorf("expected no RemoveDNSEntry calls, got %d", got)
+	}
+
+	remaining := repo.Entries("example.com")
+	want := append(entries[:500:500], entries[501])
+	if len(remaining) != len(want) {
+		t.Fatalf("expected %d entries to remain, got %d", len(want), len(remaining))
+	}
+	for i := range want {
+		if remaining[i] != want[i] {
+			t.Fatalf("entry %d = %v, want %v", i, remaining[i], want[i])
+		}
+	}
+}
+
+func TestCleanUpLargeDomainWithoutBatchUpdates(t *testing.T) {
+	// Replacing all entries of the domain would drop records added since
+	// they were listed, e.g. by another replica or by hand.
+	repo := newFakeDNSRepository("example.com", largeDomain(500)...)
+	solver, _ := newTestSolver(repo)
+
+	if err := solver.CleanUp(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := repo.Calls("RemoveDNSEntry"); got != 1 {
+		t.Errorf("expected a single RemoveDNSEntry call, got %d", got)
+	}
+	if got := repo.Calls("ReplaceDNSEntries"); got != 0 {
+		t.Errorf("expected no ReplaceDNSEntries calls without batchUpdates, got %d", got)
+	}
+	if got := len(repo.Entries("example.com")); got != 501 {
+		t.Errorf("expected 501 entries to remain, got %d", got)
+	}
+}
+
+func TestCleanUpSmallDomainRemovesEntry(t *testing.T) {
+	repo := newFakeDNSRepository("example.com", largeDomain(10)...)
+	solver, _ := newTestSolver(repo)
+
+	if err := solver.CleanUp(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := repo.Calls("RemoveDNSEntry"); got != 1 {
+		t.Errorf("expected a single RemoveDNSEntry call, got %d", got)
+	}
+	if got := repo.Calls("ReplaceDNSEntries"); got != 0 {
+		t.Errorf("expected no ReplaceDNSEntries calls, got %d", got)
+	}
+}
+
+func BenchmarkCleanUpLargeDomain(b *testing.B) {
+	entries := largeDomain(1000)
+	cfg, err := json.Marshal(map[string]interface{}{"ttl": 300, "batchUpdates": true})
+	if err != nil {
+		b.Fatal(err)
+	}
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.example.com.",
+		ResolvedZone: "example.com.",
+		Key:          testKey,
+		Config:       &extapi.JSON{Raw: cfg},
+	}
+
+	for i := 0; i < b.N; i++ {
+		repo := newFakeDNSRepository("example.com", entries...)
+		solver, _ := newTestSolver(repo)
+
+		if err := solver.CleanUp(ch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCleanUpLargeDomainPreservesOtherEntries(t *testing.T) {
+	others := []domain.DNSEntry{
+		{Name: "@", Expire: 86400, Type: "MX", Content: "10 mail.example.com."},
+		{Name: "_sip._tcp", Expire: 3600, Type: "SRV", Content: "10 60 5060 sip.example.com."},
+		{Name: "@", Expire: 60, Type: "CAA", Content: `0 issue "letsencrypt.org"`},
+		{Name: "_acme-challenge", Expire: 60, Type: "TXT", Content: otherTestKey},
+	}
+	entries := append(largeDomain(100), others...)
+
+	repo := newFakeDNSRepository("example.com", entries...)
+	solver, _ := newTestSolver(repo)
+
+	if err := solver.CleanUp(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "batchUpdates": true})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := repo.Calls("ReplaceDNSEntries"); got != 1 {
+		t.Fatalf("expected a single ReplaceDNSEntries call, got %d", got)
+	}
+
+	remaining := map[domain.DNSEntry]int{}
+	for _, e := range repo.Entries("example.com") {
+		remaining[e]++
+	}
+	for _, e := range entries {
+		want := 1
+		if e.Content == testKey {
+			want = 0
+		}
+		if remaining[e] != want {
+			t.Errorf("entry %+v: found %d times after the replace, want %d", e, remaining[e], want)
+		}
+	}
+}
+
+func TestCleanUpNotFoundSeverity(t *testing.T) {
+	tests := []struct {
+		severity  string
+		wantErr   bool
+		wantWarn  bool
+		wantCount float64
+	}{
+		{severity: "silent"},
+		{severity: "", wantWarn: true, wantCount: 1},
+		{severity: "warn", wantWarn: true, wantCount: 1},
+		{severity: "error", wantErr: true, wantCount: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.severity, func(t *testing.T) {
+			solver, logs := newTestSolver(newFakeDNSRepository("example.com"))
+			ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "cleanupNotFound": tt.severity})
+
+			before := cleanupNotFoundCount(t)
+			err := solver.CleanUp(ch)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("expected error: %v, got %v", tt.wantErr, err)
+			}
+			if got := logs.Contains("WARNING: no DNS record with the challenge key found"); got != tt.wantWarn {
+				t.Errorf("expected a warning: %v, got logs:\n%s", tt.wantWarn, logs)
+			}
+			if got := cleanupNotFoundCount(t) - before; got != tt.wantCount {
+				t.Errorf("cleanup not found count increased by %v, want %v", got, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestLoadConfigCleanupNotFound(t *testing.T) {
+	_, err := loadConfig(&extapi.JSON{Raw: []byte(`{"cleanupNotFound": "loud"}`)})
+	if err == nil || !strings.Contains(err.Error(), "invalid cleanupNotFound") {
+		t.Errorf("expected an invalid cleanupNotFound error, got %v", err)
+	}
+}
+
+func cleanupNotFoundCount(t *testing.T) float64 {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := cleanupNotFoundTotal.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestCleanUpIgnoresTTL(t *testing.T) {
+	presented := domain.DNSEntry{Name: "_acme-challenge", Expire: 60, Type: "TXT", Content: testKey}
+	other := domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: otherTestKey}
+
+	repo := newFakeDNSRepository("example.com", presented, other)
+	solver, _ := newTestSolver(repo)
+
+	// The record was presented with a TTL of 60, but is cleaned up with 300.
+	if err := solver.CleanUp(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	remaining := repo.Entries("example.com")
+	if len(remaining) != 1 || remaining[0] != other {
+		t.Errorf("expected only %+v to remain, got %+v", other, remaining)
+	}
+}
+
+func TestCleanUpRemovesDuplicates(t *testing.T) {
+	// largeDomain already holds the record of the challenge and one of
+	// another challenge at the same name.
+	duplicates := []domain.DNSEntry{
+		{Name: "_acme-challenge", Expire: 60, Type: "TXT", Content: testKey},
+		{Name: "_acme-challenge", Expire: 300, Type: "CNAME", Content: testKey},
+	}
+
+	for name, size := range map[string]int{"small": 10, "large": 100} {
+		t.Run(name, func(t *testing.T) {
+			repo := newFakeDNSRepository("example.com", append(largeDomain(size), duplicates...)...)
+			solver, logs := newTestSolver(repo)
+
+			if err := solver.CleanUp(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, e := range repo.Entries("example.com") {
+				if e.Type == "TXT" && e.Content == testKey {
+					t.Errorf("expected %+v to be removed", e)
+				}
+			}
+			if got, want := len(repo.Entries("example.com")), size+len(duplicates); got != want {
+				t.Errorf("expected %d entries to remain, got %d", want, got)
+			}
+			if want := `"removed"=2 "skipped"=1`; !logs.Contains(want) {
+				t.Errorf("expected summary %s, got logs:\n%s", want, logs)
+			}
+		})
+	}
+}
+
+func TestRemoveEntriesSkipsMissing(t *testing.T) {
+	entries := []domain.DNSEntry{
+		{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: testKey},
+		{Name: "_acme-challenge", Expire: 60, Type: "TXT", Content: testKey},
+	}
+	// Only the first entry still exists, e.g. because a concurrent cleanup
+	// removed the second after the entries were listed.
+	repo := newFakeDNSRepository("example.com", entries[0])
+
+	done, err := removeEntries(repo, "example.com", entries, []int{0, 1}, entries[0], false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(done) != 1 || done[0] != entries[0] {
+		t.Errorf("expected only the first entry to be removed, got %+v", done)
+	}
+	if got := repo.Entries("example.com"); len(got) != 0 {
+		t.Errorf("expected no entries to remain, got %+v", got)
+	}
+}
+
+func TestRemoveEntriesRefusesOtherRecords(t *testing.T) {
+	challenge := domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: testKey}
+	entries := []domain.DNSEntry{
+		challenge,
+		{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: "manually created"},
+	}
+
+	for _, batch := range []bool{false, true} {
+		repo := newFakeDNSRepository("example.com", entries...)
+		if _, err := removeEntries(repo, "example.com", entries, []int{0, 1}, challenge, batch); err == nil {
+			t.Errorf("batch=%v: expected an error for an entry not matching the challenge", batch)
+		}
+		if got := repo.Entries("example.com"); len(got) != len(entries) {
+			t.Errorf("batch=%v: expected no entries to be removed, got %+v", batch, got)
+		}
+	}
+}
+
+func TestCleanUpKeepsColocatedRecord(t *testing.T) {
+	own := domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: "v=verification-token"}
+	repo := newFakeDNSRepository("example.com", own)
+	solver, logs := newTestSolver(repo)
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := repo.Entries("example.com"); len(got) != 1 || got[0] != own {
+		t.Errorf("expected the co-located record to be preserved, got %+v", got)
+	}
+	if !logs.Contains("keeping a TXT record with the same name that does not match the challenge") {
+		t.Errorf("expected the kept record to be logged, got logs:\n%s", logs)
+	}
+	if logs.Contains("v=verification-token") {
+		t.Errorf("expected the content of the kept record not to be logged, got logs:\n%s", logs)
+	}
+}
+
+func TestPresentCleanUpApex(t *testing.T) {
+	repo := newFakeDNSRepository("example.com",
+		domain.DNSEntry{Name: "@", Expire: 300, Type: "TXT", Content: otherTestKey},
+	)
+	solver, _ := newTestSolver(repo)
+
+	// The challenge record is the domain itself, e.g. for a zone delegated
+	// to hold only the challenge record.
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	ch.ResolvedFQDN = "example.com."
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := domain.DNSEntry{Name: "@", Expire: 300, Type: "TXT", Content: testKey}
+	if got := repo.Entries("example.com"); len(got) != 2 || got[1] != want {
+		t.Fatalf("expected %+v to be added, got %+v", want, got)
+	}
+
+	// Presenting again finds the record at @.
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := repo.Calls("AddDNSEntry"); got != 1 {
+		t.Errorf("expected a single AddDNSEntry call, got %d", got)
+	}
+
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := repo.Entries("example.com"); len(got) != 1 || got[0].Content != otherTestKey {
+		t.Errorf("expected only the other record at @ to remain, got %+v", got)
+	}
+}
+
+func TestCleanUpApexWithoutName(t *testing.T) {
+	// An entry of the domain itself listed without a name is the same
+	// record as @.
+	repo := newFakeDNSRepository("example.com",
+		domain.DNSEntry{Name: "", Expire: 300, Type: "TXT", Content: testKey},
+	)
+	solver, _ := newTestSolver(repo)
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	ch.ResolvedFQDN = "example.com."
+
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := repo.Entries("example.com"); len(got) != 0 {
+		t.Errorf("expected the record to be removed, got %+v", got)
+	}
+}
+
+func TestWildcardAndBaseDomainChallenges(t *testing.T) {
+	for _, batch := range []bool{false, true} {
+		t.Run(fmt.Sprintf("batchUpdates=%v", batch), func(t *testing.T) {
+			repo := newFakeDNSRepository("example.com")
+			repo.getDelay = 10 * time.Millisecond
+			solver, _ := newTestSolver(repo)
+
+			// A certificate for example.com and *.example.com gets a
+			// challenge for each, both at _acme-challenge.example.com.
+			cfg := map[string]interface{}{"ttl": 300, "batchUpdates": batch, "entryComment": "managed"}
+			wildcard := newChallengeRequest(t, "example.com", testKey, cfg)
+			wildcard.DNSName = "*.example.com"
+			base := newChallengeRequest(t, "example.com", otherTestKey, cfg)
+			base.DNSName = "example.com"
+
+			concurrently := func(op func(*v1alpha1.ChallengeRequest) error) {
+				t.Helper()
+				errs := make(chan error, 2)
+				var wg sync.WaitGroup
+				for _, ch := range []*v1alpha1.ChallengeRequest{wildcard, base} {
+					wg.Add(1)
+					go func(ch *v1alpha1.ChallengeRequest) {
+						defer wg.Done()
+						errs <- op(ch)
+					}(ch)
+				}
+				wg.Wait()
+				close(errs)
+				for err := range errs {
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+				}
+			}
+
+			concurrently(solver.Present)
+
+			contents := map[string]bool{}
+			for _, e := range repo.Entries("example.com") {
+				if e.Name == "_acme-challenge" {
+					contents[e.Content] = true
+				}
+			}
+			if len(contents) != 2 || !contents[testKey] || !contents[otherTestKey] {
+				t.Fatalf("expected distinct records for the wildcard and base domain, got %+v", repo.Entries("example.com"))
+			}
+
+			// Cleaning up one challenge leaves the record of the other.
+			if err := solver.CleanUp(wildcard); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := []domain.DNSEntry{
+				{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: otherTestKey},
+				{Name: "_managed._acme-challenge", Expire: entryCommentTTL, Type: "TXT", Content: "managed " + challengeID(base)},
+			}
+			got := repo.Entries("example.com")
+			if len(got) != len(want) {
+				t.Fatalf("expected only the base domain's records to remain, got %+v", got)
+			}
+			for _, w := range want {
+				found := false
+				for _, e := range got {
+					found = found || e == w
+				}
+				if !found {
+					t.Errorf("expected %+v to remain, got %+v", w, got)
+				}
+			}
+
+			if err := solver.Present(wildcard); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			concurrently(solver.CleanUp)
+			if got := repo.Entries("example.com"); len(got) != 0 {
+				t.Errorf("expected both challenges to be cleaned up, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestPresentForceUpdate(t *testing.T) {
+	challenge := domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: testKey}
+	copyWithOtherTTL := domain.DNSEntry{Name: "_ACME-challenge", Expire: 60, Type: "TXT", Content: testKey}
+	other := domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: otherTestKey}
+	unrelated := domain.DNSEntry{Name: "www", Expire: 300, Type: "A", Content: "192.0.2.1"}
+
+	tests := map[string]struct {
+		config      map[string]interface{}
+		want        []domain.DNSEntry
+		wantRemoved int
+		wantAdded   int
+	}{
+		"skip existing": {
+			config: map[string]interface{}{"ttl": 300},
+			want:   []domain.DNSEntry{challenge, copyWithOtherTTL, other, unrelated},
+		},
+		"force update": {
+			config:      map[string]interface{}{"ttl": 300, "forceUpdate": true},
+			want:        []domain.DNSEntry{other, unrelated, challenge},
+			wantRemoved: 2,
+			wantAdded:   1,
+		},
+		"force update in batch": {
+			config: map[string]interface{}{"ttl": 300, "forceUpdate": true, "batchUpdates": true},
+			want:   []domain.DNSEntry{other, unrelated, challenge},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := newFakeDNSRepository("example.com", challenge, copyWithOtherTTL, other, unrelated)
+			solver, _ := newTestSolver(repo)
+
+			if err := solver.Present(newChallengeRequest(t, "example.com", testKey, tt.config)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := repo.Entries("example.com"); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("expected entries %v, got %v", tt.want, got)
+			}
+			if got := repo.Calls("RemoveDNSEntry"); got != tt.wantRemoved {
+				t.Errorf("expected %d RemoveDNSEntry calls, got %d", tt.wantRemoved, got)
+			}
+			if got := repo.Calls("AddDNSEntry"); got != tt.wantAdded {
+				t.Errorf("expected %d AddDNSEntry calls, got %d", tt.wantAdded, got)
+			}
+		})
+	}
+}
+
+// goneRepository reports the entries it removes as not found, as when a
+// concurrent cleanup removed them between listing and removing.
+type goneRepository struct {
+	*fakeDNSRepository
+	removeErr error
+}
+
+func (r *goneRepository) RemoveDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	if err := r.fakeDNSRepository.RemoveDNSEntry(domainName, dnsEntry); err != nil {
+		return err
+	}
+	return r.removeErr
+}
+
+func TestCleanUpRecordAlreadyRemoved(t *testing.T) {
+	tests := map[string]struct {
+		removeErr error
+		wantErr   bool
+	}{
+		"not found": {
+			removeErr: &rest.Error{Message: "DNS entry not found", StatusCode: 404},
+		},
+		"forbidden": {
+			removeErr: &rest.Error{Message: "this key is not allowed to remove DNS entries", StatusCode: 403},
+			wantErr:   true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := &goneRepository{
+				fakeDNSRepository: newFakeDNSRepository("example.com",
+					domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: testKey},
+				),
+				removeErr: tt.removeErr,
+			}
+			solver, logs := newTestSolver(repo)
+			ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "cleanupNotFound": "error"})
+
+			err := solver.CleanUp(ch)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "403") {
+					t.Fatalf("expected the removal error, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected a record removed concurrently to be cleaned up, got %v", err)
+			}
+			if want := `"removed"=0 "skipped"=0 "notFound"=false "alreadyRemoved"=1`; !logs.Contains(want) {
+				t.Errorf("expected the summary to contain %s, got logs:\n%s", want, logs)
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpEmptyDomain(t *testing.T) {
+	unrelated := domain.DNSEntry{Name: "www", Expire: 300, Type: "A", Content: "192.0.2.1"}
+
+	tests := map[string]struct {
+		existing    []domain.DNSEntry
+		initialize  bool
+		wantAdded   int
+		wantReplace int
+	}{
+		"empty": {
+			wantAdded: 1,
+		},
+		"empty, initialized": {
+			initialize:  true,
+			wantReplace: 1,
+		},
+		"not empty, initialize": {
+			existing:   []domain.DNSEntry{unrelated},
+			initialize: true,
+			wantAdded:  1,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := newFakeDNSRepository("example.com", tt.existing...)
+			solver, _ := newTestSolver(repo)
+			ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "initializeEmptyZone": tt.initialize})
+
+			if err := solver.Present(ch); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := append(append([]domain.DNSEntry(nil), tt.existing...), domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: testKey})
+			if got := repo.Entries("example.com"); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("expected entries %v, got %v", want, got)
+			}
+			if got := repo.Calls("AddDNSEntry"); got != tt.wantAdded {
+				t.Errorf("expected %d AddDNSEntry calls, got %d", tt.wantAdded, got)
+			}
+			if got := repo.Calls("ReplaceDNSEntries"); got != tt.wantReplace {
+				t.Errorf("expected %d ReplaceDNSEntries calls, got %d", tt.wantReplace, got)
+			}
+
+			if err := solver.CleanUp(ch); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := repo.Entries("example.com"); fmt.Sprint(got) != fmt.Sprint(tt.existing) {
+				t.Errorf("expected entries %v after cleanup, got %v", tt.existing, got)
+			}
+		})
+	}
+}
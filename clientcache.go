@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/transip/gotransip/v6/domain"
+	"github.com/transip/gotransip/v6/repository"
+)
+
+// clientCache reuses TransIP API clients across challenges, so that the
+// access token a client obtains is reused instead of authenticating again
+// for every challenge. Clients are keyed by clientCacheKey. The zero value
+// is ready to use.
+type clientCache struct {
+	mu      sync.Mutex
+	clients map[string]*repository.Client
+}
+
+// Get returns the client cached under key, calling create when there is none.
+// Clients that failed to be created are not cached.
+func (cc *clientCache) Get(key string, create func() (repository.Client, error)) (*repository.Client, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if client, ok := cc.clients[key]; ok {
+		return client, nil
+	}
+
+	client, err := create()
+	if err != nil {
+		return nil, err
+	}
+
+	if cc.clients == nil {
+		cc.clients = map[string]*repository.Client{}
+	}
+	cc.clients[key] = &client
+
+	return &client, nil
+}
+
+// Evict drops client from the cache, so that the next challenge creates a new
+// client. Clients no longer cached are ignored.
+func (cc *clientCache) Evict(client *repository.Client) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	for key, cached := range cc.clients {
+		if cached == client {
+			delete(cc.clients, key)
+		}
+	}
+}
+
+// clientCacheKey identifies a client by its account, proxy, request timeout
+// and a hash of its private key or token, so that rotated credentials get a
+// new client and the credentials themselves are not kept as keys.
+func clientCacheKey(accountName string, credential []byte, readOnly bool, httpProxy string, requestTimeout time.Duration) string {
+	mode := byte('w')
+	if readOnly {
+		mode = 'r'
+	}
+
+	h := sha256.New()
+	h.Write([]byte(accountName))
+	h.Write([]byte{0, mode})
+	h.Write([]byte(httpProxy))
+	h.Write([]byte{0})
+	h.Write([]byte(requestTimeout.String()))
+	h.Write([]byte{0})
+	h.Write(credential)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// evictingRepository evicts the cached client backing it when the TransIP API
+// rejects its authentication, e.g. because the access token was revoked, so
+// that the next challenge authenticates again.
+type evictingRepository struct {
+	repo  dnsRepository
+	evict func()
+}
+
+func (r *evictingRepository) check(err error) error {
+	if isUnauthorized(err) {
+		r.evict()
+	}
+	return err
+}
+
+func (r *evictingRepository) GetAll() ([]domain.Domain, error) {
+	domains, err := r.repo.GetAll()
+	return domains, r.check(err)
+}
+
+func (r *evictingRepository) GetDNSEntries(domainName string) ([]domain.DNSEntry, error) {
+	entries, err := r.repo.GetDNSEntries(domainName)
+	return entries, r.check(err)
+}
+
+func (r *evictingRepository) AddDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	return r.check(r.repo.AddDNSEntry(domainName, dnsEntry))
+}
+
+func (r *evictingRepository) RemoveDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	return r.check(r.repo.RemoveDNSEntry(domainName, dnsEntry))
+}
+
+func (r *evictingRepository) ReplaceDNSEntries(domainName string, dnsEntries []domain.DNSEntry) error {
+	return r.check(r.repo.ReplaceDNSEntries(domainName, dnsEntries))
+}
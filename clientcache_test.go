@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6"
+	"github.com/transip/gotransip/v6/repository"
+	"github.com/transip/gotransip/v6/rest"
+)
+
+func TestNewTransipClientReusesClient(t *testing.T) {
+	var configs []gotransip.ClientConfiguration
+	solver := &transipDNSProviderSolver{newClient: recordClientConfigs(&configs)}
+	ch := &v1alpha1.ChallengeRequest{ResourceNamespace: "default"}
+	cfg := &transipDNSProviderConfig{AccountName: "user", PrivateKey: testPrivateKey(t)}
+
+	first, err := solver.NewTransipClient(context.Background(), ch, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := solver.NewTransipClient(context.Background(), ch, &transipDNSProviderConfig{AccountName: "user", PrivateKey: testPrivateKey(t)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first != second || len(configs) != 1 {
+		t.Errorf("expected identical configs to reuse one client, got %d clients", len(configs))
+	}
+
+	// Other credentials or modes get their own client.
+	for _, other := range []*transipDNSProviderConfig{
+		{AccountName: "other", PrivateKey: testPrivateKey(t)},
+		{AccountName: "user", PrivateKey: testPrivateKey(t), ReadOnly: true},
+		{AccountName: "user", Token: testToken},
+	} {
+		client, err := solver.NewTransipClient(context.Background(), ch, other)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if client == first {
+			t.Errorf("expected a new client for %+v", other)
+		}
+	}
+	if len(configs) != 4 {
+		t.Errorf("expected 4 clients, got %d", len(configs))
+	}
+}
+
+func TestNewDNSRepositoryReusesClient(t *testing.T) {
+	var configs []gotransip.ClientConfiguration
+	solver := &transipDNSProviderSolver{newClient: recordClientConfigs(&configs)}
+
+	// Each challenge creates its repository from the config of the Issuer.
+	for i := 0; i < 2; i++ {
+		ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"accountName": "user", "privateKey": testPrivateKey(t), "ttl": 300})
+		cfg, err := loadConfig(ch.Config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := solver.newDNSRepository(context.Background(), ch, cfg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(configs) != 1 {
+		t.Errorf("expected both challenges to use one client, got %d clients", len(configs))
+	}
+}
+
+func TestEvictingRepository(t *testing.T) {
+	var cache clientCache
+	create := func() (repository.Client, error) { return repository.Client{}, nil }
+
+	client, err := cache.Get("key", create)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := newFakeDNSRepository("example.com")
+	repo := &evictingRepository{repo: fake, evict: func() { cache.Evict(client) }}
+
+	fake.getErr = &rest.Error{Message: "access denied", StatusCode: 403}
+	if _, err := repo.GetDNSEntries("example.com"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if cached, _ := cache.Get("key", create); cached != client {
+		t.Fatal("expected the client to stay cached after a non-authentication error")
+	}
+
+	fake.getErr = &rest.Error{Message: "token expired", StatusCode: 401}
+	if _, err := repo.GetDNSEntries("example.com"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if cached, _ := cache.Get("key", create); cached == client {
+		t.Error("expected the client to be evicted after an authentication error")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/cert-manager/cert-manager/pkg/issuer/acme/dns/util"
+)
+
+// maxCNAMEHops is the number of CNAMEs followCNAME follows before giving up.
+const maxCNAMEHops = 10
+
+// followCNAME returns the challenge with its record moved to the target of
+// the CNAME chain at its FQDN, for challenge records delegated to another
+// zone. The challenge is returned as it is when its FQDN is not a CNAME.
+func (c *transipDNSProviderSolver) followCNAME(ctx context.Context, ch *v1alpha1.ChallengeRequest, cfg *transipDNSProviderConfig) (*v1alpha1.ChallengeRequest, error) {
+	lookup := lookupCNAME
+	if c.lookupCNAME != nil {
+		lookup = c.lookupCNAME
+	}
+
+	fqdn := util.ToFqdn(ch.ResolvedFQDN)
+	seen := map[string]bool{strings.ToLower(fqdn): true}
+	for hops := 0; ; hops++ {
+		target, err := callWithTimeout(ctx, cfg.apiTimeout(), "LookupCNAME", func() (string, error) {
+			return lookup(ctx, fqdn, cfg.nameservers())
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error following the CNAME of %s: %w", fqdn, err)
+		}
+		if target == "" || strings.EqualFold(util.ToFqdn(target), fqdn) {
+			break
+		}
+
+		target = util.ToFqdn(target)
+		if seen[strings.ToLower(target)] {
+			return nil, fmt.Errorf("CNAME loop at %s following the CNAME of %s", target, ch.ResolvedFQDN)
+		}
+		if hops == maxCNAMEHops {
+			return nil, fmt.Errorf("more than %d CNAMEs following the CNAME of %s", maxCNAMEHops, ch.ResolvedFQDN)
+		}
+		seen[strings.ToLower(target)] = true
+		fqdn = target
+	}
+
+	if fqdn == util.ToFqdn(ch.ResolvedFQDN) {
+		return ch, nil
+	}
+
+	c.logger().Info("following the CNAME of the challenge record", "fqdn", ch.ResolvedFQDN, "target", fqdn)
+
+	// The zone of the target is detected from the target itself.
+	followed := *ch
+	followed.ResolvedFQDN = fqdn
+	followed.ResolvedZone = fqdn
+	return &followed, nil
+}
+
+// lookupCNAME returns the canonical name of fqdn, querying the first of
+// nameservers that is not a DNS-over-HTTPS resolver, or the system resolver
+// when there is none. It returns an empty name when fqdn does not exist.
+func lookupCNAME(ctx context.Context, fqdn string, nameservers []string) (string, error) {
+	resolver := net.DefaultResolver
+	for _, ns := range nameservers {
+		if strings.HasPrefix(ns, "https://") {
+			continue
+		}
+
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, ns)
+			},
+		}
+		break
+	}
+
+	cname, err := resolver.LookupCNAME(ctx, fqdn)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return "", nil
+	}
+	return cname, err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/transip/gotransip/v6/domain"
+)
+
+// cnameChain returns a lookupCNAME function resolving the CNAMEs in chain.
+func cnameChain(chain map[string]string) func(context.Context, string, []string) (string, error) {
+	return func(_ context.Context, fqdn string, _ []string) (string, error) {
+		return chain[fqdn], nil
+	}
+}
+
+func TestPresentFollowCNAME(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	repo.entries["acme.example.net"] = nil
+
+	solver, _ := newTestSolver(repo)
+	solver.lookupCNAME = cnameChain(map[string]string{
+		"_acme-challenge.example.com.": "challenges.example.org.",
+		"challenges.example.org.":      "_acme-challenge.acme.example.net.",
+	})
+	// Zone detection finds the delegated zone from the target of the chain.
+	solver.findZoneByFqdn = func(_ context.Context, fqdn string, _ []string) (string, error) {
+		if strings.HasSuffix(fqdn, ".acme.example.net.") {
+			return "acme.example.net.", nil
+		}
+		return fqdn, nil
+	}
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "followCNAME": true})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: testKey}
+	if got := repo.Entries("acme.example.net"); len(got) != 1 || got[0] != want {
+		t.Errorf("expected %+v in the delegated zone, got %+v", want, got)
+	}
+	if got := repo.Entries("example.com"); len(got) != 0 {
+		t.Errorf("expected no entries in the zone of the challenge, got %+v", got)
+	}
+
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := repo.Entries("acme.example.net"); len(got) != 0 {
+		t.Errorf("expected the record to be removed from the delegated zone, got %+v", got)
+	}
+}
+
+func TestPresentWithoutFollowCNAME(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+	solver.lookupCNAME = func(context.Context, string, []string) (string, error) {
+		t.Fatal("expected no CNAME lookups without followCNAME")
+		return "", nil
+	}
+
+	if err := solver.Present(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := repo.Entries("example.com"); len(got) != 1 {
+		t.Errorf("expected the record in the zone of the challenge, got %+v", got)
+	}
+}
+
+func TestFollowCNAMEErrors(t *testing.T) {
+	tests := map[string]struct {
+		chain   map[string]string
+		wantErr string
+	}{
+		"loop": {
+			chain: map[string]string{
+				"_acme-challenge.example.com.": "a.example.org.",
+				"a.example.org.":               "_acme-challenge.example.com.",
+			},
+			wantErr: "CNAME loop at _acme-challenge.example.com.",
+		},
+		"too long": {
+			chain: func() map[string]string {
+				chain := map[string]string{"_acme-challenge.example.com.": "0.example.org."}
+				for i := 0; i <= maxCNAMEHops; i++ {
+					chain[strings.Repeat("x", i)+"0.example.org."] = strings.Repeat("x", i+1) + "0.example.org."
+				}
+				return chain
+			}(),
+			wantErr: "more than 10 CNAMEs",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+			solver.lookupCNAME = cnameChain(tt.chain)
+
+			ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "followCNAME": true})
+			err := solver.Present(ch)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6/domain"
+)
+
+// entryCommentPrefix is prepended to the name of a challenge record to name
+// the TXT record carrying the configured entry comment.
+const entryCommentPrefix = "_managed."
+
+// entryCommentTTL is the TTL of entry comment records, in seconds.
+const entryCommentTTL = 60
+
+// maxEntryCommentLength leaves room in the TXT content of a comment record
+// for the challengeID of the challenge.
+const maxEntryCommentLength = 200
+
+// validateEntryComment checks that comment fits in the content of a comment
+// record next to the challengeID of a challenge.
+func validateEntryComment(comment string) error {
+	if len(comment) > maxEntryCommentLength {
+		return fmt.Errorf("invalid entryComment: longer than %d characters", maxEntryCommentLength)
+	}
+	if err := validateTXTContent(comment); err != nil {
+		return fmt.Errorf("invalid entryComment: %w", err)
+	}
+	return nil
+}
+
+// newEntryComment returns the record marking the challenge record entry as
+// managed by the webhook. TransIP DNS entries carry no labels, so the comment
+// is stored in a TXT record of its own, named after the challenge record. Its
+// content holds the comment and the challengeID of the challenge, so that
+// concurrent challenges for the same name each get their own comment record.
+func newEntryComment(ch *v1alpha1.ChallengeRequest, comment string, entry domain.DNSEntry) domain.DNSEntry {
+	name := entryCommentPrefix + entry.Name
+	if sameRecordName(entry.Name, "@") {
+		name = strings.TrimSuffix(entryCommentPrefix, ".")
+	}
+
+	return domain.DNSEntry{
+		Name:    name,
+		Expire:  entryCommentTTL,
+		Type:    "TXT",
+		Content: fmt.Sprintf("%s %s", comment, challengeID(ch)),
+	}
+}
+
+// addEntryComment adds the comment record of the challenge record entry.
+// Failures are logged without failing the challenge, whose record has
+// already been added.
+func (c *transipDNSProviderSolver) addEntryComment(repo dnsRepository, cfg *transipDNSProviderConfig, ch *v1alpha1.ChallengeRequest, domainName string, entry domain.DNSEntry) {
+	comment := newEntryComment(ch, cfg.EntryComment, entry)
+	if err := repo.AddDNSEntry(domainName, comment); err != nil && !isConflict(err) {
+		c.logger().Error(err, "could not add the entry comment", "domain", domainName, "name", comment.Name)
+	}
+}
+
+// removeEntryComment removes the comment record of the challenge record
+// entry. A comment record that does not exist, e.g. because entryComment was
+// set after the challenge was presented, is ignored, and other failures are
+// logged without failing the cleanup.
+func (c *transipDNSProviderSolver) removeEntryComment(repo dnsRepository, cfg *transipDNSProviderConfig, ch *v1alpha1.ChallengeRequest, domainName string, entry domain.DNSEntry) {
+	comment := newEntryComment(ch, cfg.EntryComment, entry)
+	if err := repo.RemoveDNSEntry(domainName, comment); err != nil && !isNotFound(err) {
+		c.logger().Error(err, "could not remove the entry comment", "domain", domainName, "name", comment.Name)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6/domain"
+)
+
+func TestEntryComment(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "entryComment": "managed by cert-manager"})
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := domain.DNSEntry{Name: "_managed._acme-challenge", Expire: entryCommentTTL, Type: "TXT", Content: "managed by cert-manager " + challengeID(ch)}
+	var found bool
+	for _, e := range repo.Entries("example.com") {
+		found = found || e == want
+	}
+	if !found {
+		t.Fatalf("expected comment record %v, got %v", want, repo.Entries("example.com"))
+	}
+
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entries := repo.Entries("example.com"); len(entries) != 0 {
+		t.Errorf("expected the challenge and comment records to be removed, got %v", entries)
+	}
+}
+
+func TestEntryCommentConcurrentChallenges(t *testing.T) {
+	// A wildcard and a base domain challenge share their record name. As
+	// cert-manager leaves the UID of ChallengeRequests empty, the comment
+	// records are told apart by the key of their challenge.
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	cfg := map[string]interface{}{"ttl": 300, "entryComment": "managed"}
+	wildcard := newChallengeRequest(t, "example.com", testKey, cfg)
+	base := newChallengeRequest(t, "example.com", otherTestKey, cfg)
+
+	for _, ch := range []*v1alpha1.ChallengeRequest{wildcard, base} {
+		if err := solver.Present(ch); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := solver.CleanUp(wildcard); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []domain.DNSEntry{
+		{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: otherTestKey},
+		{Name: "_managed._acme-challenge", Expire: entryCommentTTL, Type: "TXT", Content: "managed " + challengeID(base)},
+	}
+	if got := repo.Entries("example.com"); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the records of the base domain challenge to remain, got %+v", got)
+	}
+}
+
+func TestEntryCommentApex(t *testing.T) {
+	ch := newChallengeRequest(t, "example.com", testKey, nil)
+
+	got := newEntryComment(ch, "managed", domain.DNSEntry{Name: "@"})
+	if got.Name != "_managed" {
+		t.Errorf("expected the comment of an apex record to be named _managed, got %q", got.Name)
+	}
+}
+
+func TestEntryCommentMissingOnCleanUp(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, logs := newTestSolver(repo)
+
+	if err := solver.Present(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "entryComment": "managed"})
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("expected a missing comment record to be ignored, got %v", err)
+	}
+	if logs.Contains("could not remove the entry comment") {
+		t.Errorf("expected no error to be logged, got %s", logs.String())
+	}
+}
+
+func TestCleanUpLeavesOtherRecords(t *testing.T) {
+	others := []domain.DNSEntry{
+		{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: "manually created"},
+		{Name: "_acme-challenge", Expire: 300, Type: "CNAME", Content: testKey},
+		{Name: "_acme-challenge.www", Expire: 300, Type: "TXT", Content: testKey},
+		{Name: "@", Expire: 300, Type: "TXT", Content: testKey},
+		{Name: "@", Expire: 300, Type: "TXT", Content: "v=spf1 -all"},
+		{Name: "_managed._acme-challenge", Expire: entryCommentTTL, Type: "TXT", Content: "managed other-uid"},
+	}
+	repo := newFakeDNSRepository("example.com", others...)
+	solver, _ := newTestSolver(repo)
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "entryComment": "managed"})
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := repo.Entries("example.com"); !reflect.DeepEqual(got, others) {
+		t.Errorf("expected only the records of the challenge to be removed, got %v", got)
+	}
+}
+
+func TestLoadConfigEntryComment(t *testing.T) {
+	for name, comment := range map[string]string{
+		"too long":  strings.Repeat("a", maxEntryCommentLength+1),
+		"quote":     `managed "here"`,
+		"non-ascii": "géré",
+	} {
+		raw := []byte(`{"entryComment": "` + strings.ReplaceAll(comment, `"`, `\"`) + `"}`)
+		if _, err := loadConfig(&extapi.JSON{Raw: raw}); err == nil {
+			t.Errorf("%s: expected an error for entryComment %q", name, comment)
+		}
+	}
+
+	if _, err := loadConfig(&extapi.JSON{Raw: []byte(`{"entryComment": "managed by cert-manager"}`)}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// errNoConfig is returned for challenges of an Issuer without a config block
+// for the webhook.
+var errNoConfig = errors.New("no config provided for the transip solver: set accountName and privateKey, privateKeySecretRef or privateKeyPath, token or tokenSecretRef, or credentialsDir in the webhook config of the Issuer")
+
+// jsonErrorContext is the number of bytes shown on each side of the
+// position of a JSON decoding error.
+const jsonErrorContext = 30
+
+// describeJSONError adds the line and column of a JSON decoding error to its
+// message, together with the surrounding part of the config. String values in
+// that preview are redacted since they may hold credentials.
+func describeJSONError(raw []byte, err error) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err
+	}
+
+	if offset > int64(len(raw)) {
+		offset = int64(len(raw))
+	}
+	// The offset points just past the byte that could not be decoded.
+	pos := int(offset)
+	if pos > 0 {
+		pos--
+	}
+
+	line, column := 1, 1
+	for _, b := range raw[:pos] {
+		if b == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+
+	start, end := pos-jsonErrorContext, pos+jsonErrorContext
+	if start < 0 {
+		start = 0
+	}
+	if end > len(raw) {
+		end = len(raw)
+	}
+
+	preview := redactJSONStrings(raw)[start:end]
+	preview = bytes.Join(bytes.Fields(preview), []byte(" "))
+
+	return fmt.Errorf("%v at line %d, column %d, near `%s`", err, line, column, preview)
+}
+
+// redactJSONStrings replaces the characters of all string values in raw with
+// asterisks, keeping object keys readable. The result has the same length as
+// raw, so offsets into raw remain valid. raw does not need to be valid JSON.
+func redactJSONStrings(raw []byte) []byte {
+	redacted := make([]byte, len(raw))
+	copy(redacted, raw)
+
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '"' {
+			continue
+		}
+
+		start := i + 1
+		end := start
+		for end < len(raw) && raw[end] != '"' {
+			if raw[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end > len(raw) {
+			end = len(raw)
+		}
+
+		next := end + 1
+		for next < len(raw) && (raw[next] == ' ' || raw[next] == '\t' || raw[next] == '\r' || raw[next] == '\n') {
+			next++
+		}
+		isKey := next < len(raw) && raw[next] == ':'
+
+		if !isKey {
+			for j := start; j < end; j++ {
+				redacted[j] = '*'
+			}
+		}
+
+		i = end
+	}
+
+	return redacted
+}
+
+// checkCredentials reports which fields are missing for the config to
+// authenticate with TransIP, before any API client is created. Configs in
+// test mode use the demo account and need no credentials.
+func (cfg *transipDNSProviderConfig) checkCredentials() error {
+	if cfg.TestMode {
+		return nil
+	}
+	if cfg.usesToken() {
+		return cfg.checkTokenCredentials()
+	}
+	if cfg.CredentialsDir != "" {
+		return nil
+	}
+
+	var missing []string
+	switch {
+	case cfg.AccountNameSecretRef.Name != "":
+		if cfg.AccountNameSecretRef.Key == "" {
+			missing = append(missing, "accountNameSecretRef.key")
+		}
+	case cfg.AccountName == "":
+		missing = append(missing, "accountName")
+	}
+	// An inline private key takes precedence over privateKeySecretRef,
+	// which takes precedence over privateKeyPath.
+	switch {
+	case len(cfg.PrivateKey) > 0:
+	case cfg.PrivateKeySecretRef.Name != "":
+		if cfg.PrivateKeySecretRef.Key == "" {
+			missing = append(missing, "privateKeySecretRef.key")
+		}
+	case cfg.PrivateKeyPath != "":
+	default:
+		missing = append(missing, "privateKey, privateKeySecretRef or privateKeyPath")
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("transip solver config is missing %s (or set credentialsDir instead)", strings.Join(missing, " and "))
+	}
+	return nil
+}
+
+// checkTokenCredentials validates a config authenticating with an access
+// token, which needs no account name and excludes any private key.
+func (cfg *transipDNSProviderConfig) checkTokenCredentials() error {
+	if len(cfg.PrivateKey) > 0 || cfg.PrivateKeySecretRef.Name != "" || cfg.PrivateKeyPath != "" || cfg.CredentialsDir != "" {
+		return errors.New("transip solver config has both a token and a private key: set either token or tokenSecretRef, or privateKey, privateKeySecretRef, privateKeyPath or credentialsDir")
+	}
+	if cfg.Token != "" && cfg.TokenSecretRef.Name != "" {
+		return errors.New("transip solver config has both token and tokenSecretRef: set only one of them")
+	}
+	if cfg.Token == "" && cfg.TokenSecretRef.Key == "" {
+		return errors.New("transip solver config is missing tokenSecretRef.key")
+	}
+	if cfg.AccountNameSecretRef.Name != "" && cfg.AccountNameSecretRef.Key == "" {
+		return errors.New("transip solver config is missing accountNameSecretRef.key")
+	}
+	return nil
+}
+
+// checkWritable rejects configs whose TransIP client is read-only before any
+// API call is made, as such a client can never add or remove DNS entries.
+func (cfg *transipDNSProviderConfig) checkWritable() error {
+	if cfg.ReadOnly {
+		return errors.New("transip solver config sets readOnly: a read-only TransIP client cannot add or remove DNS entries, unset readOnly to serve challenges")
+	}
+	return nil
+}
+
+// redacted replaces secret values in configs shown to users.
+const redacted = "****"
+
+// effectiveConfigJSON decodes raw the way the webhook decodes the config of a
+// challenge, and returns the resulting config as JSON with the defaults the
+// webhook applies filled in and the private key redacted.
+func effectiveConfigJSON(raw []byte) ([]byte, error) {
+	cfg, err := loadConfig(&extapi.JSON{Raw: raw})
+	if err != nil {
+		return nil, err
+	}
+	// The credentials are only checked once a client is created for a
+	// challenge, so report missing ones here rather than on the first
+	// challenge.
+	if err := cfg.checkCredentials(); err != nil {
+		return nil, err
+	}
+
+	jitter, err := parseJitterStrategy(cfg.RetryJitter)
+	if err != nil {
+		return nil, err
+	}
+	cfg.RetryJitter = string(jitter)
+	severity, err := parseNotFoundSeverity(cfg.CleanupNotFound)
+	if err != nil {
+		return nil, err
+	}
+	cfg.CleanupNotFound = string(severity)
+	if cfg.TTLClampMode == "" {
+		cfg.TTLClampMode = ttlReject
+	}
+	if cfg.DomainListCacheTTL == nil {
+		cfg.DomainListCacheTTL = &metav1.Duration{Duration: defaultDomainListCacheTTL}
+	}
+	if cfg.ZoneCacheTTL == nil {
+		cfg.ZoneCacheTTL = &metav1.Duration{Duration: defaultZoneCacheTTL}
+	}
+	if cfg.RetryAttempts == 0 {
+		cfg.RetryAttempts = defaultRetryAttempts
+	}
+	if cfg.RetryBaseDelay == nil {
+		cfg.RetryBaseDelay = &metav1.Duration{Duration: defaultRetryBaseDelay}
+	}
+	if cfg.APITimeout == nil {
+		cfg.APITimeout = &metav1.Duration{Duration: defaultAPITimeout}
+	}
+	if cfg.RequestTimeout == nil {
+		cfg.RequestTimeout = &metav1.Duration{Duration: cfg.requestTimeout()}
+	}
+	if cfg.CleanupMarkerMaxAge == nil {
+		cfg.CleanupMarkerMaxAge = &metav1.Duration{Duration: defaultCleanupMarkerMaxAge}
+	}
+	if cfg.PropagationCheck && cfg.PropagationCheckTimeout == nil {
+		cfg.PropagationCheckTimeout = &metav1.Duration{Duration: defaultPropagationCheckTimeout}
+	}
+	if len(cfg.PropagationResolvers) > 0 {
+		cfg.PropagationQuorum = cfg.propagationQuorum()
+	}
+
+	encoded, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	if len(cfg.PrivateKey) > 0 {
+		fields["privateKey"] = redacted
+	}
+	if cfg.Token != "" {
+		fields["token"] = redacted
+	}
+	if cfg.HTTPProxy != "" {
+		fields["httpProxy"] = proxyWithoutUserinfo(cfg.HTTPProxy)
+	}
+
+	return json.MarshalIndent(fields, "", "  ")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCleanupCooldown bounds the configurable cleanup cooldown, so a present
+// never waits long.
+const maxCleanupCooldown = time.Minute
+
+// domainCooldowns records, per domain, until when presents wait after a
+// cleanup. The zero value is ready to use.
+type domainCooldowns struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+// Start makes presents in domainName wait until the given time.
+func (d *domainCooldowns) Start(domainName string, until time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.until == nil {
+		d.until = map[string]time.Time{}
+	}
+	d.until[strings.ToLower(domainName)] = until
+}
+
+// Until returns until when presents in domainName wait, or the zero time.
+func (d *domainCooldowns) Until(domainName string) time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.until[strings.ToLower(domainName)]
+}
+
+// waitCooldown blocks until the cooldown of domainName after its last
+// cleanup has passed or ctx is done.
+func (c *transipDNSProviderSolver) waitCooldown(ctx context.Context, domainName string) error {
+	remaining := c.cooldowns.Until(domainName).Sub(c.now())
+	if remaining <= 0 {
+		return nil
+	}
+
+	clk := c.clock
+	if clk == nil {
+		clk = realClock{}
+	}
+
+	c.logger().Info("waiting for the cleanup cooldown of the domain", "domain", domainName, "remaining", remaining.String())
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for the cleanup cooldown of %s: %w", domainName, ctx.Err())
+	case <-clk.After(remaining):
+		return nil
+	}
+}
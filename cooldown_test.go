@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// blockingClock never fires.
+type blockingClock struct{}
+
+func (blockingClock) After(time.Duration) <-chan time.Time {
+	return nil
+}
+
+func TestPresentWaitsForCleanupCooldown(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	repo := newFakeDNSRepository("example.com")
+	solver, logs := newTestSolver(repo)
+	solver.timeNow = func() time.Time { return now }
+	clk := solver.clock.(*fakeClock)
+
+	cfg := map[string]interface{}{"ttl": 300, "cleanupCooldown": "30s"}
+	first := newChallengeRequest(t, "example.com", testKey, cfg)
+	if err := solver.Present(first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := solver.CleanUp(first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Shortly after the cleanup, a present waits out the rest of the
+	// cooldown.
+	now = now.Add(10 * time.Second)
+	second := newChallengeRequest(t, "example.com", otherTestKey, cfg)
+	if err := solver.Present(second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := clk.Delays(); len(got) != 1 || got[0] != 20*time.Second {
+		t.Fatalf("expected a single wait of 20s, got %v", got)
+	}
+	if !logs.Contains("waiting for the cleanup cooldown") {
+		t.Errorf("expected the wait to be logged, got logs:\n%s", logs)
+	}
+
+	// Presents after the cooldown do not wait.
+	now = now.Add(time.Minute)
+	if err := solver.Present(newChallengeRequest(t, "example.com", testKey, cfg)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := clk.Delays(); len(got) != 1 {
+		t.Errorf("expected no further waits, got %v", got)
+	}
+}
+
+func TestWaitCooldownCancelled(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+	solver.timeNow = func() time.Time { return now }
+	solver.clock = blockingClock{}
+	solver.cooldowns.Start("example.com", now.Add(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := solver.waitCooldown(ctx, "Example.com"); err == nil {
+		t.Fatal("expected an error when the context is done")
+	}
+}
+
+func TestLoadConfigCleanupCooldown(t *testing.T) {
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"cleanupCooldown": "2m"})
+	if _, err := loadConfig(ch.Config); err == nil {
+		t.Errorf("expected a cooldown above %v to be rejected", maxCleanupCooldown)
+	}
+}
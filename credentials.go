@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+const (
+	// credentialsDirAccountNameFile and credentialsDirPrivateKeyFile are the
+	// file names expected inside a credentials directory.
+	credentialsDirAccountNameFile = "accountName"
+	credentialsDirPrivateKeyFile  = "privateKey"
+
+	// projectedVolumeDataDir is the symlink Kubernetes swaps atomically when
+	// the contents of a projected (or secret) volume are updated.
+	projectedVolumeDataDir = "..data"
+)
+
+// dirCredentials reads the TransIP account name and private key from a
+// directory, typically a projected volume mounted into the webhook pod.
+// The files are only read again when the directory changes, so rotated
+// credentials are picked up without re-reading them on every challenge.
+type dirCredentials struct {
+	dir string
+
+	mu          sync.Mutex
+	version     string
+	accountName string
+	privateKey  []byte
+}
+
+// Load returns the current account name and private key stored in the
+// directory, reloading them when the directory has been updated.
+func (d *dirCredentials) Load() (string, []byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	version, err := d.currentVersion()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if version == d.version && d.privateKey != nil {
+		return d.accountName, d.privateKey, nil
+	}
+
+	accountName, err := os.ReadFile(filepath.Join(d.dir, credentialsDirAccountNameFile))
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading account name from credentials directory %q: %v", d.dir, err)
+	}
+
+	privateKey, err := os.ReadFile(filepath.Join(d.dir, credentialsDirPrivateKeyFile))
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading private key from credentials directory %q: %v", d.dir, err)
+	}
+
+	d.version = version
+	d.accountName = strings.TrimSpace(string(accountName))
+	d.privateKey = privateKey
+
+	return d.accountName, d.privateKey, nil
+}
+
+// currentVersion identifies the current contents of the directory. Projected
+// volumes are identified by the target of their ..data symlink; for plain
+// directories the modification times of the credential files are used.
+func (d *dirCredentials) currentVersion() (string, error) {
+	if target, err := os.Readlink(filepath.Join(d.dir, projectedVolumeDataDir)); err == nil {
+		return target, nil
+	}
+
+	version := ""
+	for _, name := range []string{credentialsDirAccountNameFile, credentialsDirPrivateKeyFile} {
+		info, err := os.Stat(filepath.Join(d.dir, name))
+		if err != nil {
+			return "", fmt.Errorf("error reading credentials directory %q: %v", d.dir, err)
+		}
+		version += fmt.Sprintf("%s:%d:%d;", name, info.ModTime().UnixNano(), info.Size())
+	}
+
+	return version, nil
+}
+
+// dirCredentials returns the credentials loader for the given directory,
+// creating it on first use so its contents are cached across challenges.
+func (c *transipDNSProviderSolver) dirCredentials(dir string) *dirCredentials {
+	c.credentialsMu.Lock()
+	defer c.credentialsMu.Unlock()
+
+	if c.credentialDirs == nil {
+		c.credentialDirs = map[string]*dirCredentials{}
+	}
+
+	creds, ok := c.credentialDirs[dir]
+	if !ok {
+		creds = &dirCredentials{dir: dir}
+		c.credentialDirs[dir] = creds
+	}
+
+	return creds
+}
+
+// secretNotFoundAttempts and secretNotFoundDelay bound how long a Secret that
+// is not found is waited for, as a Secret applied together with its Issuer
+// may not be visible to the webhook right away.
+const (
+	secretNotFoundAttempts = 5
+	secretNotFoundDelay    = 2 * time.Second
+)
+
+// ErrSecretNotFound is returned, wrapped together with the error of the
+// Kubernetes API, when a Secret referenced by the config does not exist.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// ErrSecretKeyNotFound is returned, wrapped, when a Secret referenced by the
+// config exists but does not hold the referenced key.
+var ErrSecretKeyNotFound = errors.New("key not found in secret")
+
+// getSecret returns the named Secret, retrying for a short while when it is
+// not found. Other errors are returned immediately.
+func (c *transipDNSProviderSolver) getSecret(ctx context.Context, namespace, name string) (*v1.Secret, error) {
+	clk := c.clock
+	if clk == nil {
+		clk = realClock{}
+	}
+
+	for attempt := 1; ; attempt++ {
+		secret, err := c.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) && attempt == secretNotFoundAttempts {
+			return nil, fmt.Errorf("%w: %s/%s: %w", ErrSecretNotFound, namespace, name, err)
+		}
+		if err == nil || !apierrors.IsNotFound(err) {
+			return secret, err
+		}
+
+		c.logger().Info("secret not found, waiting for it to appear", "namespace", namespace, "name", name, "attempt", attempt)
+		select {
+		case <-clk.After(secretNotFoundDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// secretKey returns the value of key in secret, or ErrSecretKeyNotFound,
+// wrapped in a message naming what was looked for, when it is missing.
+func secretKey(secret *v1.Secret, key, what string) ([]byte, error) {
+	value, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("no %s for %q in secret '%s/%s': %w", what, key, secret.Namespace, secret.Name, ErrSecretKeyNotFound)
+	}
+	return value, nil
+}
+
+// resolveAccountName returns the config with the account name read from
+// accountNameSecretRef when it is set, or the config itself otherwise. The
+// Secret takes precedence over an inline accountName; an account name that
+// resolves to an empty value is an error rather than a fallback.
+func (c *transipDNSProviderSolver) resolveAccountName(ctx context.Context, ch *v1alpha1.ChallengeRequest, cfg *transipDNSProviderConfig) (*transipDNSProviderConfig, error) {
+	ref := cfg.AccountNameSecretRef
+	if ref.Name == "" {
+		return cfg, nil
+	}
+
+	secret, err := c.getSecret(ctx, ch.ResourceNamespace, ref.Name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := secretKey(secret, ref.Key, "account name")
+	if err != nil {
+		return nil, err
+	}
+
+	accountName := strings.TrimSpace(string(data))
+	if accountName == "" {
+		return nil, fmt.Errorf("account name for %q in secret '%s/%s' is empty", ref.Key, secret.Namespace, secret.Name)
+	}
+
+	resolved := *cfg
+	resolved.AccountName = accountName
+	return &resolved, nil
+}
+
+// readPrivateKeyFile reads the private key stored at path, typically mounted
+// into the webhook pod by a CSI secrets driver.
+func readPrivateKeyFile(path string) ([]byte, error) {
+	privateKey, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading private key from privateKeyPath: %v", err)
+	}
+	if len(bytes.TrimSpace(privateKey)) == 0 {
+		return nil, fmt.Errorf("private key file %q from privateKeyPath is empty", path)
+	}
+	return privateKey, nil
+}
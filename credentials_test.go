@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6"
+)
+
+// writeProjectedVolume mimics the kubelet's atomic writer: the files live in
+// a timestamped directory and are exposed through the ..data symlink, which is
+// replaced in a single rename when the contents change.
+func writeProjectedVolume(t *testing.T, dir, version, accountName, privateKey string) {
+	t.Helper()
+
+	dataDir := filepath.Join(dir, version)
+	if err := os.Mkdir(dataDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, credentialsDirAccountNameFile), []byte(accountName+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, credentialsDirPrivateKeyFile), []byte(privateKey), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpLink := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(version, tmpLink); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmpLink, filepath.Join(dir, projectedVolumeDataDir)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{credentialsDirAccountNameFile, credentialsDirPrivateKeyFile} {
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); err == nil {
+			continue
+		}
+		if err := os.Symlink(filepath.Join(projectedVolumeDataDir, name), link); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDirCredentialsProjectedVolumeRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeProjectedVolume(t, dir, "..2024_01_01_00_00_00.1", "first-account", "first-key")
+
+	solver := &transipDNSProviderSolver{}
+
+	accountName, privateKey, err := solver.dirCredentials(dir).Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if accountName != "first-account" || string(privateKey) != "first-key" {
+		t.Fatalf("got %q/%q, want first-account/first-key", accountName, privateKey)
+	}
+
+	writeProjectedVolume(t, dir, "..2024_01_02_00_00_00.2", "second-account", "second-key")
+
+	accountName, privateKey, err = solver.dirCredentials(dir).Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if accountName != "second-account" || string(privateKey) != "second-key" {
+		t.Fatalf("got %q/%q after rotation, want second-account/second-key", accountName, privateKey)
+	}
+}
+
+func TestDirCredentialsCachedUntilChanged(t *testing.T) {
+	dir := t.TempDir()
+	writeProjectedVolume(t, dir, "..2024_01_01_00_00_00.1", "account", "key")
+
+	creds := &dirCredentials{dir: dir}
+	if _, _, err := creds.Load(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Overwrite the data behind the symlink without swapping it: as the
+	// volume version did not change, the cached credentials are returned.
+	dataFile := filepath.Join(dir, "..2024_01_01_00_00_00.1", credentialsDirPrivateKeyFile)
+	if err := os.WriteFile(dataFile, []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, privateKey, err := creds.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(privateKey) != "key" {
+		t.Fatalf("got private key %q, want cached value %q", privateKey, "key")
+	}
+}
+
+func TestDirCredentialsPlainDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, credentialsDirAccountNameFile), []byte("account"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, credentialsDirPrivateKeyFile), []byte("key"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	accountName, privateKey, err := (&dirCredentials{dir: dir}).Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if accountName != "account" || string(privateKey) != "key" {
+		t.Fatalf("got %q/%q, want account/key", accountName, privateKey)
+	}
+}
+
+func TestDirCredentialsMissingFiles(t *testing.T) {
+	if _, _, err := (&dirCredentials{dir: t.TempDir()}).Load(); err == nil {
+		t.Fatal("expected an error for an empty credentials directory")
+	}
+}
+
+func TestNewTransipClientLogsCreation(t *testing.T) {
+	privateKey := testPrivateKey(t)
+
+	log, logs := newTestLogger()
+	solver := &transipDNSProviderSolver{log: log}
+	ch := &v1alpha1.ChallengeRequest{ResourceNamespace: "default"}
+
+	if _, err := solver.NewTransipClient(context.Background(), ch, &transipDNSProviderConfig{AccountName: "user", PrivateKey: privateKey}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !logs.Contains(`"msg"="creating TransIP client" "account"="user" "source"="inline"`) {
+		t.Errorf("expected a structured client creation log line, got logs:\n%s", logs)
+	}
+	if logs.Contains("PRIVATE KEY") {
+		t.Errorf("expected the private key not to be logged, got logs:\n%s", logs)
+	}
+}
+
+func TestNewTransipClientWaitsForSecret(t *testing.T) {
+	privateKey := testPrivateKey(t)
+
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "transip-credentials", Namespace: "default"},
+		Data:       map[string][]byte{"privateKey": privateKey},
+	})
+	// The Secret is not visible for the first two reads.
+	gets := 0
+	client.PrependReactor("get", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets <= 2 {
+			return true, nil, apierrors.NewNotFound(v1.Resource("secrets"), "transip-credentials")
+		}
+		return false, nil, nil
+	})
+
+	clk := &fakeClock{}
+	solver := &transipDNSProviderSolver{client: client, clock: clk}
+	cfg := &transipDNSProviderConfig{
+		AccountName:         "user",
+		PrivateKeySecretRef: v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "transip-credentials"}, Key: "privateKey"},
+	}
+
+	if _, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{ResourceNamespace: "default"}, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gets != 3 {
+		t.Errorf("expected 3 reads of the secret, got %d", gets)
+	}
+	if got := clk.Delays(); len(got) != 2 || got[0] != secretNotFoundDelay {
+		t.Errorf("expected two waits of %v, got %v", secretNotFoundDelay, got)
+	}
+}
+
+func TestNewTransipClientSecretNotFound(t *testing.T) {
+	clk := &fakeClock{}
+	solver := &transipDNSProviderSolver{client: fake.NewSimpleClientset(), clock: clk}
+	cfg := &transipDNSProviderConfig{
+		AccountName:         "user",
+		PrivateKeySecretRef: v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "missing"}, Key: "privateKey"},
+	}
+
+	_, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{ResourceNamespace: "default"}, cfg)
+	if !errors.Is(err, ErrSecretNotFound) || !apierrors.IsNotFound(err) {
+		t.Fatalf("expected ErrSecretNotFound wrapping the not found error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "default/missing") {
+		t.Errorf("expected the error to name the secret, got %v", err)
+	}
+	if got := len(clk.Delays()); got != secretNotFoundAttempts-1 {
+		t.Errorf("expected %d waits, got %d", secretNotFoundAttempts-1, got)
+	}
+}
+
+func TestNewTransipClientSecretKeyNotFound(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "transip-credentials", Namespace: "default"},
+		Data:       map[string][]byte{"token": []byte("...")},
+	})
+	solver := &transipDNSProviderSolver{client: client, clock: &fakeClock{}}
+	cfg := &transipDNSProviderConfig{
+		AccountName:         "user",
+		PrivateKeySecretRef: secretKeySelector("transip-credentials", "privateKey"),
+	}
+
+	_, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{ResourceNamespace: "default"}, cfg)
+	if !errors.Is(err, ErrSecretKeyNotFound) {
+		t.Fatalf("expected ErrSecretKeyNotFound, got %v", err)
+	}
+	if errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected an existing secret not to be reported as missing, got %v", err)
+	}
+	if want := `no private key for "privateKey" in secret 'default/transip-credentials'`; !strings.Contains(err.Error(), want) {
+		t.Errorf("expected the error to contain %q, got %v", want, err)
+	}
+}
+
+func TestSecretKeyMessage(t *testing.T) {
+	secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "transip-credentials", Namespace: "cert-manager"}}
+
+	_, err := secretKey(secret, "privateKey", "private key")
+	want := `no private key for "privateKey" in secret 'cert-manager/transip-credentials': key not found in secret`
+	if err == nil || err.Error() != want {
+		t.Errorf("secretKey() error = %v, want %s", err, want)
+	}
+}
+
+func TestNewTransipClientPrivateKeyPath(t *testing.T) {
+	privateKey := testPrivateKey(t)
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "privateKey")
+	if err := os.WriteFile(keyPath, privateKey, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	emptyPath := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyPath, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	missingPath := filepath.Join(dir, "missing")
+
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "transip-credentials", Namespace: "default"},
+		Data:       map[string][]byte{"privateKey": privateKey},
+	})
+	secretRef := v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "transip-credentials"}, Key: "privateKey"}
+
+	tests := map[string]struct {
+		cfg        *transipDNSProviderConfig
+		wantSource string
+		wantErr    string
+	}{
+		"path": {
+			cfg:        &transipDNSProviderConfig{AccountName: "user", PrivateKeyPath: keyPath},
+			wantSource: credentialSourceFile,
+		},
+		"inline before path": {
+			cfg:        &transipDNSProviderConfig{AccountName: "user", PrivateKey: privateKey, PrivateKeyPath: missingPath},
+			wantSource: credentialSourceInline,
+		},
+		"secret before path": {
+			cfg:        &transipDNSProviderConfig{AccountName: "user", PrivateKeySecretRef: secretRef, PrivateKeyPath: missingPath},
+			wantSource: credentialSourceSecret,
+		},
+		"missing file": {
+			cfg:     &transipDNSProviderConfig{AccountName: "user", PrivateKeyPath: missingPath},
+			wantErr: "error reading private key from privateKeyPath",
+		},
+		"empty file": {
+			cfg:     &transipDNSProviderConfig{AccountName: "user", PrivateKeyPath: emptyPath},
+			wantErr: "from privateKeyPath is empty",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			log, logs := newTestLogger()
+			var configs []gotransip.ClientConfiguration
+			solver := &transipDNSProviderSolver{client: client, log: log, newClient: recordClientConfigs(&configs)}
+
+			_, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{ResourceNamespace: "default"}, tt.cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !logs.Contains(`"source"="` + tt.wantSource + `"`) {
+				t.Errorf("expected the private key to be read from the %s source, got logs:\n%s", tt.wantSource, logs)
+			}
+		})
+	}
+}
+
+func TestNewTransipClientAccountNameSecret(t *testing.T) {
+	privateKey := testPrivateKey(t)
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "transip-credentials", Namespace: "default"},
+		Data: map[string][]byte{
+			"accountName": []byte("secret-user\n"),
+			"empty":       []byte(" \n"),
+			"privateKey":  privateKey,
+		},
+	})
+	ref := func(key string) v1.SecretKeySelector {
+		return v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "transip-credentials"}, Key: key}
+	}
+
+	tests := map[string]struct {
+		cfg         *transipDNSProviderConfig
+		wantAccount string
+		wantErr     string
+	}{
+		"secret": {
+			cfg:         &transipDNSProviderConfig{AccountNameSecretRef: ref("accountName"), PrivateKeySecretRef: ref("privateKey")},
+			wantAccount: "secret-user",
+		},
+		"secret before inline": {
+			cfg:         &transipDNSProviderConfig{AccountName: "inline-user", AccountNameSecretRef: ref("accountName"), PrivateKey: privateKey},
+			wantAccount: "secret-user",
+		},
+		"secret with token": {
+			cfg:         &transipDNSProviderConfig{AccountNameSecretRef: ref("accountName"), Token: testToken},
+			wantAccount: "secret-user",
+		},
+		"empty in secret": {
+			cfg:     &transipDNSProviderConfig{AccountName: "inline-user", AccountNameSecretRef: ref("empty"), PrivateKey: privateKey},
+			wantErr: `account name for "empty" in secret 'default/transip-credentials' is empty`,
+		},
+		"missing from secret": {
+			cfg:     &transipDNSProviderConfig{AccountNameSecretRef: ref("missing"), PrivateKey: privateKey},
+			wantErr: `no account name for "missing" in secret 'default/transip-credentials'`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var configs []gotransip.ClientConfiguration
+			solver := &transipDNSProviderSolver{client: client, newClient: recordClientConfigs(&configs)}
+
+			_, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{ResourceNamespace: "default"}, tt.cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if len(configs) != 0 {
+					t.Errorf("expected no client to be created, got %+v", configs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(configs) != 1 || configs[0].AccountName != tt.wantAccount {
+				t.Errorf("expected a client for account %q, got %+v", tt.wantAccount, configs)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// debugHost is the interface the debug endpoints listen on; they are never
+// exposed outside of the pod.
+const debugHost = "127.0.0.1"
+
+// startDebugServer serves the net/http/pprof handlers and the effective config
+// endpoint on addr until stop is closed, returning the address it listens on.
+func startDebugServer(addr string, stop <-chan struct{}, log logr.Logger) (net.Addr, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/config", effectiveConfigHandler)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error(err, "debug server stopped")
+		}
+	}()
+	go func() {
+		<-stop
+		server.Close()
+	}()
+
+	return listener.Addr(), nil
+}
+
+// effectiveConfigHandler responds to a POST of the webhook config of an
+// Issuer with the config the webhook uses for it, after defaulting and
+// validation, with secret material redacted.
+func effectiveConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "POST the webhook config of an Issuer", http.StatusMethodNotAllowed)
+		return
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	effective, err := effectiveConfigJSON(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(effective)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+// freePort returns a loopback port that is not in use.
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", net.JoinHostPort(debugHost, "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestInitializePprof(t *testing.T) {
+	port := freePort(t)
+	url := "http://" + net.JoinHostPort(debugHost, strconv.Itoa(port)) + "/debug/pprof/"
+
+	t.Run("disabled", func(t *testing.T) {
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+
+		solver := &transipDNSProviderSolver{}
+		if err := solver.Initialize(&rest.Config{}, stopCh); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+			t.Fatal("expected the pprof endpoint to be unreachable when disabled")
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		t.Setenv(pprofPortEnvVar, strconv.Itoa(port))
+
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+
+		solver := &transipDNSProviderSolver{}
+		if err := solver.Initialize(&rest.Config{}, stopCh); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("expected the pprof endpoint to be reachable: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected status 200, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestInitializeDebugServerBindFailure(t *testing.T) {
+	// Occupy the port of the debug server.
+	l, err := net.Listen("tcp", net.JoinHostPort(debugHost, "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	t.Setenv(pprofPortEnvVar, strconv.Itoa(l.Addr().(*net.TCPAddr).Port))
+
+	t.Run("optional", func(t *testing.T) {
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+
+		repo := newFakeDNSRepository("example.com")
+		solver, logs := newTestSolver(repo)
+		if err := solver.Initialize(&rest.Config{}, stopCh); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !logs.Contains("could not start the debug server") {
+			t.Errorf("expected the bind failure to be logged, got logs:\n%s", logs)
+		}
+
+		ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+		if err := solver.Present(ch); err != nil {
+			t.Fatalf("unexpected error presenting: %v", err)
+		}
+		if err := solver.CleanUp(ch); err != nil {
+			t.Fatalf("unexpected error cleaning up: %v", err)
+		}
+		if entries := repo.Entries("example.com"); len(entries) != 0 {
+			t.Errorf("expected the record to be cleaned up, got %v", entries)
+		}
+	})
+
+	t.Run("required", func(t *testing.T) {
+		t.Setenv(debugRequiredEnvVar, "true")
+
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+
+		solver := &transipDNSProviderSolver{}
+		if err := solver.Initialize(&rest.Config{}, stopCh); err == nil {
+			t.Fatal("expected an error when the debug server is required")
+		}
+	})
+}
+
+func TestEffectiveConfigHandler(t *testing.T) {
+	tests := []struct {
+		method     string
+		body       string
+		wantStatus int
+		want       string
+	}{
+		{method: http.MethodPost, body: `{"accountName": "user", "privateKey": "c2VjcmV0LWtleQ=="}`, wantStatus: http.StatusOK, want: `"privateKey": "****"`},
+		{method: http.MethodPost, body: `{"ttlJitter": -1}`, wantStatus: http.StatusBadRequest, want: "ttlJitter must not be negative"},
+		{method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/debug/config", strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		effectiveConfigHandler(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.body, rec.Code, tt.wantStatus)
+		}
+		if !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s %s: expected the response to contain %q, got:\n%s", tt.method, tt.body, tt.want, rec.Body)
+		}
+	}
+}
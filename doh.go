@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/cert-manager/cert-manager/pkg/issuer/acme/dns/util"
+)
+
+// dohContentType is the media type of DNS messages sent over HTTPS.
+const dohContentType = "application/dns-message"
+
+// isDNSOverHTTPS reports whether all nameservers are DNS-over-HTTPS URLs.
+func isDNSOverHTTPS(nameservers []string) bool {
+	for _, ns := range nameservers {
+		if !strings.HasPrefix(ns, "https://") {
+			return false
+		}
+	}
+	return len(nameservers) > 0
+}
+
+// findZone returns the zone of fqdn like util.FindZoneByFqdn, which it uses
+// for plain nameservers. Zones are looked up through DNS-over-HTTPS resolvers
+// with the dohClient of the solver, which util.FindZoneByFqdn does not take.
+func (c *transipDNSProviderSolver) findZone(ctx context.Context, fqdn string, nameservers []string) (string, error) {
+	if c.findZoneByFqdn != nil {
+		return c.findZoneByFqdn(ctx, fqdn, nameservers)
+	}
+	if !isDNSOverHTTPS(nameservers) {
+		return util.FindZoneByFqdn(ctx, fqdn, nameservers)
+	}
+
+	// Climb up the DNS tree until a name has an SOA record: names below the
+	// zone return NXDOMAIN, and names with a CNAME cannot be a zone apex.
+	for _, i := range dns.Split(fqdn) {
+		name := fqdn[i:]
+
+		resp, err := c.dohQuery(ctx, name, dns.TypeSOA, nameservers)
+		if err != nil {
+			return "", err
+		}
+		if resp.Rcode == dns.RcodeNameError {
+			continue
+		}
+		if resp.Rcode != dns.RcodeSuccess {
+			return "", fmt.Errorf("querying the SOA record of %s through %v returned %s", name, nameservers, dns.RcodeToString[resp.Rcode])
+		}
+
+		if hasCNAME(resp) {
+			continue
+		}
+		for _, rr := range resp.Answer {
+			if soa, ok := rr.(*dns.SOA); ok {
+				return soa.Hdr.Name, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("could not find the SOA record of %s through %v", fqdn, nameservers)
+}
+
+// hasCNAME reports whether msg answers with a CNAME record.
+func hasCNAME(msg *dns.Msg) bool {
+	for _, rr := range msg.Answer {
+		if _, ok := rr.(*dns.CNAME); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dohQuery sends a recursive query for name to the DNS-over-HTTPS resolvers
+// in turn, returning the first answer.
+func (c *transipDNSProviderSolver) dohQuery(ctx context.Context, name string, rtype uint16, resolvers []string) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, rtype)
+	msg.SetEdns0(4096, false)
+
+	var err error
+	for _, resolver := range resolvers {
+		var resp *dns.Msg
+		if resp, err = c.dohExchange(ctx, msg, resolver); err == nil {
+			return resp, nil
+		}
+	}
+	return nil, err
+}
+
+// dohExchange sends msg to the DNS-over-HTTPS resolver and returns its
+// answer, bounded by util.DNSTimeout like the DNS queries of cert-manager.
+func (c *transipDNSProviderSolver) dohExchange(ctx context.Context, msg *dns.Msg, resolver string) (*dns.Msg, error) {
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, util.DNSTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, resolver, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+
+	client := c.dohClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS-over-HTTPS resolver %s returned HTTP status %d", resolver, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != dohContentType {
+		return nil, fmt.Errorf("DNS-over-HTTPS resolver %s returned Content-Type %q, expected %q", resolver, ct, dohContentType)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	answer := new(dns.Msg)
+	if err := answer.Unpack(body); err != nil {
+		return nil, err
+	}
+	return answer, nil
+}
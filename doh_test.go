@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsDNSOverHTTPS(t *testing.T) {
+	tests := map[string]struct {
+		nameservers []string
+		want        bool
+	}{
+		"resolver":     {nameservers: []string{"https://cloudflare-dns.com/dns-query"}, want: true},
+		"nameserver":   {nameservers: []string{"10.0.0.10:53"}},
+		"mixed":        {nameservers: []string{"https://cloudflare-dns.com/dns-query", "10.0.0.10:53"}},
+		"no resolvers": {},
+	}
+
+	for name, tt := range tests {
+		if got := isDNSOverHTTPS(tt.nameservers); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", name, tt.want, got)
+		}
+	}
+}
+
+func TestFindZoneDNSOverHTTPSError(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	solver := &transipDNSProviderSolver{dohClient: server.Client()}
+	_, err := solver.findZone(context.Background(), "_acme-challenge.example.com.", []string{server.URL})
+	if err == nil || !strings.Contains(err.Error(), "returned HTTP status 503") {
+		t.Fatalf("expected the HTTP status of the resolver in the error, got %v", err)
+	}
+}
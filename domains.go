@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/cert-manager/cert-manager/pkg/issuer/acme/dns/util"
+)
+
+// zoneMapping maps challenge FQDNs matching Pattern to the TransIP domain
+// Zone. Patterns are matched against the lowercase FQDN without its trailing
+// dot, e.g. `^_acme-challenge\.[^.]+\.apps\.example\.com$`.
+type zoneMapping struct {
+	Pattern string `json:"pattern"`
+	Zone    string `json:"zone"`
+
+	re *regexp.Regexp
+}
+
+// compileZoneMappings validates and compiles the zone mapping patterns.
+func (cfg *transipDNSProviderConfig) compileZoneMappings() error {
+	for i := range cfg.ZoneMappings {
+		m := &cfg.ZoneMappings[i]
+		if m.Zone == "" {
+			return fmt.Errorf("zoneMappings[%d]: zone must be set", i)
+		}
+
+		re, err := regexp.Compile(m.Pattern)
+		if err != nil {
+			return fmt.Errorf("zoneMappings[%d]: invalid pattern %q: %v", i, m.Pattern, err)
+		}
+		m.re = re
+	}
+
+	return nil
+}
+
+// mappedZone returns the zone of the first zone mapping matching fqdn. It
+// fails when fqdn is not within the mapped zone, as no record name relative
+// to the zone can be computed then.
+func (cfg *transipDNSProviderConfig) mappedZone(fqdn string) (string, bool, error) {
+	name := strings.ToLower(util.UnFqdn(fqdn))
+
+	for i, m := range cfg.ZoneMappings {
+		if m.re == nil || !m.re.MatchString(name) {
+			continue
+		}
+
+		zone := strings.ToLower(util.UnFqdn(m.Zone))
+		if name != zone && !strings.HasSuffix(name, "."+zone) {
+			return "", false, fmt.Errorf("zoneMappings[%d]: %s is not within the mapped zone %s", i, name, zone)
+		}
+		return zone, true, nil
+	}
+
+	return "", false, nil
+}
+
+// resolveDomainName returns the TransIP domain to manage the challenge record
+// in: the zone of the first matching zone mapping, else the longest matching
+// domain of the account when checkDomainOwnership is set, else the zone found
+// by looking up the challenge in DNS.
+func (c *transipDNSProviderSolver) resolveDomainName(ctx context.Context, ch *v1alpha1.ChallengeRequest, cfg *transipDNSProviderConfig, repo dnsRepository) (string, error) {
+	zone, ok, err := cfg.mappedZone(ch.ResolvedFQDN)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return zone, nil
+	}
+
+	if cfg.CheckDomainOwnership {
+		// The domains are those of the account of the zone.
+		return c.ownedDomain(repo, c.credentialsFor(ch, cfg), ch.ResolvedFQDN)
+	}
+
+	domainName, err := c.lookupDomainName(ctx, ch.ResolvedZone, cfg.nameservers(), cfg)
+	if err != nil && len(cfg.AlternateNameservers) > 0 {
+		c.logger().Info("zone detection failed, retrying with the alternate nameservers",
+			"zone", ch.ResolvedZone, "nameservers", cfg.AlternateNameservers, "error", err.Error())
+		domainName, err = c.lookupDomainName(ctx, ch.ResolvedZone, cfg.AlternateNameservers, cfg)
+	}
+	if err != nil {
+		if cfg.StrictZoneDetection {
+			return "", fmt.Errorf("strict zone detection: %v", err)
+		}
+		c.logger().Info("WARNING: zone detection failed, falling back to the resolved zone as the domain; set strictZoneDetection to fail the challenge instead",
+			"zone", ch.ResolvedZone, "domain", domainName, "error", err.Error())
+	}
+
+	return domainName, nil
+}
+
+// nameservers returns the nameservers used to detect the zone of a challenge:
+// the DNS-over-HTTPS resolver when configured, for clusters that cannot reach
+// nameservers on port 53, the configured nameservers, or the recursive
+// nameservers otherwise.
+func (cfg *transipDNSProviderConfig) nameservers() []string {
+	if cfg.DNSOverHTTPSResolver != "" {
+		return []string{cfg.DNSOverHTTPSResolver}
+	}
+	if len(cfg.Nameservers) > 0 {
+		return cfg.Nameservers
+	}
+	return util.RecursiveNameservers
+}
+
+// defaultZoneCacheTTL is how long the zone looked up for a challenge is
+// reused before it is looked up again.
+const defaultZoneCacheTTL = 5 * time.Minute
+
+// maxZoneCacheTTL bounds zoneCacheTTL, and thereby how long a cached zone may
+// outlive a change of the delegation.
+const maxZoneCacheTTL = time.Hour
+
+// zoneCacheTTL returns how long looked up zones are reused.
+func (cfg *transipDNSProviderConfig) zoneCacheTTL() time.Duration {
+	if cfg.ZoneCacheTTL != nil {
+		return cfg.ZoneCacheTTL.Duration
+	}
+	return defaultZoneCacheTTL
+}
+
+// lookupDomainName returns the domain of zone with extractDomainName, reusing
+// the domain looked up earlier through the same nameservers for the
+// configured zoneCacheTTL. Failed lookups are not cached, so the next
+// challenge looks the zone up again.
+func (c *transipDNSProviderSolver) lookupDomainName(ctx context.Context, zone string, nameservers []string, cfg *transipDNSProviderConfig) (string, error) {
+	key := strings.ToLower(zone) + " " + strings.Join(nameservers, ",")
+	if domainName, ok := c.zones.Get(key, cfg.zoneCacheTTL(), c.now()); ok {
+		return domainName, nil
+	}
+
+	domainName, err := c.extractDomainName(ctx, zone, nameservers, cfg.apiTimeout())
+	if err != nil {
+		return domainName, err
+	}
+	c.zones.Put(key, domainName, c.now())
+
+	return domainName, nil
+}
+
+// zoneCache caches the domains looked up for zones. The zero value is ready
+// to use.
+type zoneCache struct {
+	mu      sync.Mutex
+	entries map[string]zoneCacheEntry
+}
+
+type zoneCacheEntry struct {
+	domainName string
+	fetched    time.Time
+}
+
+// Get returns the domain cached for key, unless it was looked up ttl or
+// longer before now.
+func (z *zoneCache) Get(key string, ttl time.Duration, now time.Time) (string, bool) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	entry, ok := z.entries[key]
+	if !ok || now.Sub(entry.fetched) >= ttl {
+		return "", false
+	}
+	return entry.domainName, true
+}
+
+// Put caches domainName for key, as looked up at now. Expired entries are
+// dropped while at it, so that the cache does not grow with every zone ever
+// looked up.
+func (z *zoneCache) Put(key, domainName string, now time.Time) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if z.entries == nil {
+		z.entries = map[string]zoneCacheEntry{}
+	}
+	for k, entry := range z.entries {
+		if now.Sub(entry.fetched) >= maxZoneCacheTTL {
+			delete(z.entries, k)
+		}
+	}
+	z.entries[key] = zoneCacheEntry{domainName: domainName, fetched: now}
+}
+
+// defaultDomainListCacheTTL is how long the list of domains of an account is
+// reused before it is fetched from TransIP again.
+const defaultDomainListCacheTTL = 5 * time.Minute
+
+// domainListCache caches the names of the domains registered under each
+// TransIP account. The zero value is ready to use.
+type domainListCache struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entries map[string]domainListCacheEntry
+}
+
+type domainListCacheEntry struct {
+	domains []string
+	fetched time.Time
+}
+
+// Get returns the cached domains of account, calling fetch when they are not
+// cached or were fetched longer than ttl ago.
+func (d *domainListCache) Get(account string, ttl time.Duration, fetch func() ([]string, error)) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now
+	if d.now != nil {
+		now = d.now
+	}
+
+	if entry, ok := d.entries[account]; ok && now().Sub(entry.fetched) < ttl {
+		return entry.domains, nil
+	}
+
+	domains, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	if d.entries == nil {
+		d.entries = map[string]domainListCacheEntry{}
+	}
+	d.entries[account] = domainListCacheEntry{domains: domains, fetched: now()}
+
+	return domains, nil
+}
+
+// Invalidate drops the cached domains of account.
+func (d *domainListCache) Invalidate(account string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.entries, account)
+}
+
+// ownedDomain returns the domain of the TransIP account that fqdn belongs to,
+// using the longest matching domain when several match. The domain list is
+// cached per account; when no domain matches, it is fetched again once in
+// case the domain was added to the account since.
+func (c *transipDNSProviderSolver) ownedDomain(repo dnsRepository, cfg *transipDNSProviderConfig, fqdn string) (string, error) {
+	ttl := defaultDomainListCacheTTL
+	if cfg.DomainListCacheTTL != nil {
+		ttl = cfg.DomainListCacheTTL.Duration
+	}
+
+	fetch := func() ([]string, error) {
+		domains, err := repo.GetAll()
+		if err != nil {
+			return nil, fmt.Errorf("error listing the domains of the TransIP account: %v", err)
+		}
+
+		names := make([]string, 0, len(domains))
+		for _, d := range domains {
+			names = append(names, d.Name)
+		}
+		return names, nil
+	}
+
+	account := cfg.accountKey()
+	for attempt := 0; attempt < 2; attempt++ {
+		if attempt > 0 {
+			c.domainLists.Invalidate(account)
+		}
+
+		domains, err := c.domainLists.Get(account, ttl, fetch)
+		if err != nil {
+			return "", err
+		}
+
+		if name, ties := longestDomainSuffix(fqdn, domains); name != "" {
+			if ties != nil {
+				if cfg.StrictZoneDetection {
+					return "", fmt.Errorf("strict zone detection: several domains of the TransIP account match %s equally: %v", util.UnFqdn(fqdn), ties)
+				}
+				c.logger().Info("WARNING: several domains of the TransIP account match equally, using the first in lexicographic order",
+					"fqdn", fqdn, "domain", name, "matches", ties)
+			}
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s is not managed by TransIP account %q", util.UnFqdn(fqdn), account)
+}
+
+// longestDomainSuffix returns the longest of domains that fqdn equals or is a
+// subdomain of, as listed by the account, or an empty string when none match.
+// A domain listed more than once, e.g. with a different case, ties with
+// itself: the lexicographically smallest spelling is returned, and ties holds
+// all tied spellings.
+func longestDomainSuffix(fqdn string, domains []string) (longest string, ties []string) {
+	name := strings.ToLower(util.UnFqdn(fqdn))
+
+	for _, d := range domains {
+		d = util.UnFqdn(d)
+		candidate := strings.ToLower(d)
+		if name != candidate && !strings.HasSuffix(name, "."+candidate) {
+			continue
+		}
+
+		switch {
+		case len(candidate) > len(longest):
+			longest, ties = d, []string{d}
+		case len(candidate) == len(longest):
+			ties = append(ties, d)
+			if d < longest {
+				longest = d
+			}
+		}
+	}
+
+	if len(ties) < 2 {
+		ties = nil
+	}
+	return longest, ties
+}
@@ -0,0 +1,587 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6/domain"
+)
+
+func TestDomainListCacheTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := domainListCache{now: func() time.Time { return now }}
+
+	fetches := 0
+	fetch := func() ([]string, error) {
+		fetches++
+		return []string{"example.com"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Get("account", time.Minute, fetch); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if fetches != 1 {
+		t.Fatalf("expected 1 fetch within the TTL, got %d", fetches)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := cache.Get("account", time.Minute, fetch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fetches != 2 {
+		t.Fatalf("expected the list to be fetched again after the TTL, got %d fetches", fetches)
+	}
+
+	cache.Invalidate("account")
+	if _, err := cache.Get("account", time.Minute, fetch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fetches != 3 {
+		t.Fatalf("expected the list to be fetched again after invalidation, got %d fetches", fetches)
+	}
+}
+
+func TestLongestDomainSuffix(t *testing.T) {
+	domains := []string{"example.com", "sub.example.com", "example.org"}
+
+	tests := map[string]string{
+		"_acme-challenge.example.com.":     "example.com",
+		"_acme-challenge.sub.example.com.": "sub.example.com",
+		"_acme-challenge.SUB.Example.com":  "sub.example.com",
+		"example.org.":                     "example.org",
+		"_acme-challenge.notexample.com.":  "",
+		"_acme-challenge.example.net.":     "",
+	}
+
+	for fqdn, want := range tests {
+		if got, _ := longestDomainSuffix(fqdn, domains); got != want {
+			t.Errorf("longestDomainSuffix(%q) = %q, want %q", fqdn, got, want)
+		}
+	}
+}
+
+func TestLongestDomainSuffixTie(t *testing.T) {
+	for _, domains := range [][]string{
+		{"example.com", "Example.com", "EXAMPLE.COM."},
+		{"EXAMPLE.COM.", "Example.com", "example.com"},
+	} {
+		got, ties := longestDomainSuffix("_acme-challenge.example.com.", domains)
+		if got != "EXAMPLE.COM" {
+			t.Errorf("longestDomainSuffix(%v) = %q, want %q", domains, got, "EXAMPLE.COM")
+		}
+		if len(ties) != 3 {
+			t.Errorf("expected 3 tied matches for %v, got %v", domains, ties)
+		}
+	}
+
+	if _, ties := longestDomainSuffix("_acme-challenge.sub.example.com.", []string{"example.com", "sub.example.com"}); ties != nil {
+		t.Errorf("expected no ties, got %v", ties)
+	}
+}
+
+func TestPresentDomainOwnershipLogsTie(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	repo.entries["Example.com"] = nil
+	solver, logs := newTestSolver(repo)
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"accountName": "user", "ttl": 300, "checkDomainOwnership": true})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !logs.Contains("several domains of the TransIP account match equally") {
+		t.Errorf("expected the tie to be logged, got logs:\n%s", logs)
+	}
+	if entries := repo.Entries("Example.com"); len(entries) != 1 {
+		t.Errorf("expected the record to be added to the lexicographically smallest domain, got %v", entries)
+	}
+}
+
+func TestPresentDomainOwnershipCachesDomainList(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	cfg := map[string]interface{}{"accountName": "user", "ttl": 300, "checkDomainOwnership": true}
+	for _, key := range []string{testKey, otherTestKey} {
+		ch := newChallengeRequest(t, "example.com", key, cfg)
+		if err := solver.Present(ch); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if got := repo.Calls("GetAll"); got != 1 {
+		t.Errorf("expected the domain list to be fetched once, got %d GetAll calls", got)
+	}
+}
+
+func TestPresentDomainOwnershipNotOwned(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	cfg := map[string]interface{}{"accountName": "user", "ttl": 300, "checkDomainOwnership": true}
+	ch := newChallengeRequest(t, "example.org", testKey, cfg)
+
+	err := solver.Present(ch)
+	if err == nil || !strings.Contains(err.Error(), `example.org is not managed by TransIP account "user"`) {
+		t.Fatalf("expected a not managed error, got %v", err)
+	}
+
+	// The cached list is refreshed once before giving up.
+	if got := repo.Calls("GetAll"); got != 2 {
+		t.Errorf("expected 2 GetAll calls, got %d", got)
+	}
+	if got := repo.Calls("AddDNSEntry"); got != 0 {
+		t.Errorf("expected no AddDNSEntry calls, got %d", got)
+	}
+}
+
+func TestLoadConfigZoneMappingsValidation(t *testing.T) {
+	tests := map[string]string{
+		`{"zoneMappings": [{"pattern": "(", "zone": "example.com"}]}`: `zoneMappings[0]: invalid pattern "("`,
+		`{"zoneMappings": [{"pattern": ".*"}]}`:                       "zoneMappings[0]: zone must be set",
+	}
+
+	for config, want := range tests {
+		_, err := loadConfig(&extapi.JSON{Raw: []byte(config)})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("loadConfig(%s) error = %v, want %q", config, err, want)
+		}
+	}
+}
+
+func TestPresentZoneMappings(t *testing.T) {
+	mappings := []map[string]string{
+		{"pattern": `^_acme-challenge\.[^.]+\.apps\.example\.com$`, "zone": "example.com"},
+		{"pattern": `\.internal\.example\.org$`, "zone": "internal.example.org."},
+	}
+
+	tests := map[string]struct {
+		fqdn, resolvedZone string
+		wantDomain         string
+		wantName           string
+	}{
+		"first pattern": {
+			fqdn:         "_acme-challenge.shop.apps.example.com.",
+			resolvedZone: "apps.example.com.",
+			wantDomain:   "example.com",
+			wantName:     "_acme-challenge.shop.apps",
+		},
+		"second pattern": {
+			fqdn:         "_acme-challenge.api.internal.example.org.",
+			resolvedZone: "example.org.",
+			wantDomain:   "internal.example.org",
+			wantName:     "_acme-challenge.api",
+		},
+		"no match falls through to auto-detection": {
+			fqdn:         "_acme-challenge.www.example.net.",
+			resolvedZone: "example.net.",
+			wantDomain:   "example.net",
+			wantName:     "_acme-challenge.www",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := newFakeDNSRepository(tt.wantDomain)
+			solver, _ := newTestSolver(repo)
+
+			ch := newChallengeRequest(t, "unused.example", testKey, map[string]interface{}{"ttl": 300, "zoneMappings": mappings})
+			ch.ResolvedFQDN = tt.fqdn
+			ch.ResolvedZone = tt.resolvedZone
+
+			if err := solver.Present(ch); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			entries := repo.Entries(tt.wantDomain)
+			if len(entries) != 1 || entries[0].Name != tt.wantName {
+				t.Fatalf("expected a record named %q in %s, got %v", tt.wantName, tt.wantDomain, entries)
+			}
+		})
+	}
+}
+
+func TestPresentZoneMappingOutsideZone(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	mappings := []map[string]string{{"pattern": `example\.net$`, "zone": "example.com"}}
+	ch := newChallengeRequest(t, "example.net", testKey, map[string]interface{}{"ttl": 300, "zoneMappings": mappings})
+
+	err := solver.Present(ch)
+	if err == nil || !strings.Contains(err.Error(), "is not within the mapped zone example.com") {
+		t.Fatalf("expected an error for a mapping outside the zone, got %v", err)
+	}
+}
+
+// newFakeDoHServer returns a DNS-over-HTTPS server answering SOA queries for
+// zone and NXDOMAIN for any other name. Its client trusts the server, and is
+// set as the dohClient of solvers.
+func newFakeDoHServer(t *testing.T, zone string) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var queries int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req := new(dns.Msg)
+		if err := req.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		if q := req.Question[0]; q.Name == zone && q.Qtype == dns.TypeSOA {
+			resp.Answer = append(resp.Answer, &dns.SOA{
+				Hdr:  dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+				Ns:   "ns0." + zone,
+				Mbox: "hostmaster." + zone,
+			})
+		} else {
+			resp.Rcode = dns.RcodeNameError
+		}
+
+		packed, err := resp.Pack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(packed)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &queries
+}
+
+func TestResolveDomainNameDNSOverHTTPS(t *testing.T) {
+	server, queries := newFakeDoHServer(t, "doh.example.")
+
+	solver := &transipDNSProviderSolver{dohClient: server.Client()}
+	ch := newChallengeRequest(t, "sub.doh.example", testKey, map[string]interface{}{"dnsOverHTTPSResolver": server.URL})
+	cfg, err := loadConfig(ch.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	domainName, err := solver.resolveDomainName(context.Background(), ch, cfg, newFakeDNSRepository("doh.example"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if domainName != "doh.example" {
+		t.Errorf("expected domain doh.example, got %q", domainName)
+	}
+	if atomic.LoadInt32(queries) == 0 {
+		t.Error("expected the zone to be looked up through the DNS-over-HTTPS resolver")
+	}
+}
+
+func TestLoadConfigDNSOverHTTPSResolver(t *testing.T) {
+	if _, err := loadConfig(&extapi.JSON{Raw: []byte(`{"dnsOverHTTPSResolver": "8.8.8.8:53"}`)}); err == nil {
+		t.Error("expected an error for a resolver that is not an https:// URL")
+	}
+}
+
+func TestResolveDomainNameAlternateNameservers(t *testing.T) {
+	solver, logs := newTestSolver(newFakeDNSRepository("example.com"))
+
+	var queried [][]string
+	solver.findZoneByFqdn = func(_ context.Context, fqdn string, nameservers []string) (string, error) {
+		queried = append(queried, nameservers)
+		if nameservers[0] == "10.0.0.1:53" {
+			return "", errors.New("i/o timeout")
+		}
+		return "example.com.", nil
+	}
+
+	ch := newChallengeRequest(t, "sub.example.com", testKey, map[string]interface{}{
+		"nameservers":          []string{"10.0.0.1:53"},
+		"alternateNameservers": []string{"10.0.0.2:53"},
+		"strictZoneDetection":  true,
+	})
+	cfg, err := loadConfig(ch.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	domainName, err := solver.resolveDomainName(context.Background(), ch, cfg, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if domainName != "example.com" {
+		t.Errorf("expected domain example.com, got %q", domainName)
+	}
+	if fmt.Sprint(queried) != "[[10.0.0.1:53] [10.0.0.2:53]]" {
+		t.Errorf("expected the primary and then the alternate nameservers to be queried, got %v", queried)
+	}
+	if !logs.Contains("retrying with the alternate nameservers") {
+		t.Errorf("expected the retry to be logged, got:\n%s", logs)
+	}
+}
+
+func TestLoadConfigNameserversWithDNSOverHTTPS(t *testing.T) {
+	raw := `{"nameservers": ["10.0.0.1:53"], "dnsOverHTTPSResolver": "https://cloudflare-dns.com/dns-query"}`
+	if _, err := loadConfig(&extapi.JSON{Raw: []byte(raw)}); err == nil {
+		t.Error("expected an error when both nameservers and dnsOverHTTPSResolver are set")
+	}
+}
+
+func TestStrictZoneDetection(t *testing.T) {
+	tests := map[string]struct {
+		setup func(*transipDNSProviderSolver, *fakeDNSRepository, *v1alpha1.ChallengeRequest)
+		cfg   map[string]interface{}
+	}{
+		"zone lookup fails": {
+			setup: func(s *transipDNSProviderSolver, repo *fakeDNSRepository, ch *v1alpha1.ChallengeRequest) {
+				s.findZoneByFqdn = func(context.Context, string, []string) (string, error) {
+					return "", errors.New("i/o timeout")
+				}
+			},
+		},
+		"fqdn outside of the domain": {
+			setup: func(s *transipDNSProviderSolver, _ *fakeDNSRepository, ch *v1alpha1.ChallengeRequest) {
+				ch.ResolvedFQDN = "_acme-challenge.example.org."
+			},
+		},
+		"tied account domains": {
+			setup: func(_ *transipDNSProviderSolver, repo *fakeDNSRepository, _ *v1alpha1.ChallengeRequest) {
+				repo.entries["Example.com"] = nil
+			},
+			cfg: map[string]interface{}{"accountName": "user", "checkDomainOwnership": true},
+		},
+	}
+
+	for name, tt := range tests {
+		for _, strict := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/strict=%v", name, strict), func(t *testing.T) {
+				repo := newFakeDNSRepository("example.com")
+				solver, logs := newTestSolver(repo)
+
+				cfg := map[string]interface{}{"ttl": 300, "strictZoneDetection": strict}
+				for k, v := range tt.cfg {
+					cfg[k] = v
+				}
+				ch := newChallengeRequest(t, "example.com", testKey, cfg)
+				tt.setup(solver, repo, ch)
+
+				err := solver.Present(ch)
+				if strict {
+					if err == nil || !strings.Contains(err.Error(), "strict zone detection") {
+						t.Fatalf("expected a strict zone detection error, got %v", err)
+					}
+					if got := repo.Calls("AddDNSEntry"); got != 0 {
+						t.Errorf("expected no AddDNSEntry calls, got %d", got)
+					}
+					return
+				}
+
+				if err != nil {
+					t.Fatalf("expected lenient mode to fall back, got %v", err)
+				}
+				if !logs.Contains("WARNING") {
+					t.Errorf("expected the fallback to be logged, got logs:\n%s", logs)
+				}
+			})
+		}
+	}
+}
+
+func TestExtractRecordName(t *testing.T) {
+	tests := []struct {
+		fqdn, domain string
+		want         string
+		wantOK       bool
+	}{
+		{fqdn: "_acme-challenge.example.com.", domain: "example.com", want: "_acme-challenge", wantOK: true},
+		{fqdn: "_acme-challenge.example.com", domain: "example.com.", want: "_acme-challenge", wantOK: true},
+		{fqdn: "_acme-challenge.www.example.com.", domain: "example.com", want: "_acme-challenge.www", wantOK: true},
+		{fqdn: "_ACME-Challenge.Example.COM.", domain: "example.com", want: "_acme-challenge", wantOK: true},
+		{fqdn: "_acme-challenge.example.com.", domain: "EXAMPLE.com.", want: "_acme-challenge", wantOK: true},
+		{fqdn: "example.com.", domain: "example.com", want: "@", wantOK: true},
+		{fqdn: "Example.com", domain: "example.COM.", want: "@", wantOK: true},
+		{fqdn: "_acme-challenge.notexample.com.", domain: "example.com", want: "_acme-challenge.notexample.com", wantOK: false},
+		{fqdn: "_acme-challenge.example.com.evil.net.", domain: "example.com", want: "_acme-challenge.example.com.evil.net", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := extractRecordName(tt.fqdn, tt.domain)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("extractRecordName(%q, %q) = %q, %v, want %q, %v", tt.fqdn, tt.domain, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestPresentZoneLookupNameservers(t *testing.T) {
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+
+	var queried [][]string
+	solver.findZoneByFqdn = func(_ context.Context, fqdn string, nameservers []string) (string, error) {
+		queried = append(queried, nameservers)
+		return "example.com.", nil
+	}
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{
+		"ttl":                 300,
+		"nameservers":         []string{"ns0.transip.net", "195.135.195.195:53"},
+		"strictZoneDetection": true,
+	})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fmt.Sprint(queried) != "[[ns0.transip.net:53 195.135.195.195:53]]" {
+		t.Errorf("expected the configured nameservers to be passed to the zone lookup, got %v", queried)
+	}
+}
+
+func TestZoneLookupFailure(t *testing.T) {
+	lookupFails := func(context.Context, string, []string) (string, error) {
+		return "", errors.New("i/o timeout")
+	}
+
+	t.Run("lenient", func(t *testing.T) {
+		repo := newFakeDNSRepository("example.com")
+		solver, logs := newTestSolver(repo)
+		solver.findZoneByFqdn = lookupFails
+
+		ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+		if err := solver.Present(ch); err != nil {
+			t.Fatalf("expected the resolved zone to be used, got %v", err)
+		}
+		// The resolved zone is used without its trailing dot.
+		if got := repo.Entries("example.com"); len(got) != 1 {
+			t.Errorf("expected the record to be added to example.com, got %+v", got)
+		}
+		if !logs.Contains(`"domain"="example.com"`) || !logs.Contains("i/o timeout") {
+			t.Errorf("expected the fallback domain and the lookup error to be logged, got logs:\n%s", logs)
+		}
+
+		if err := solver.CleanUp(ch); err != nil {
+			t.Fatalf("unexpected error cleaning up: %v", err)
+		}
+		if got := repo.Entries("example.com"); len(got) != 0 {
+			t.Errorf("expected the record to be removed, got %+v", got)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		repo := newFakeDNSRepository("example.com", domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: testKey})
+		solver, _ := newTestSolver(repo)
+		solver.findZoneByFqdn = lookupFails
+
+		ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "strictZoneDetection": true})
+		err := solver.CleanUp(ch)
+		if err == nil || !strings.Contains(err.Error(), "i/o timeout") {
+			t.Fatalf("expected the lookup error to be returned, got %v", err)
+		}
+		if got := repo.Calls("GetDNSEntries"); got != 0 {
+			t.Errorf("expected TransIP not to be called, got %d GetDNSEntries calls", got)
+		}
+	})
+}
+
+func TestZoneCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+	solver.timeNow = func() time.Time { return now }
+
+	lookups := 0
+	var lookupErr error
+	solver.findZoneByFqdn = func(context.Context, string, []string) (string, error) {
+		lookups++
+		return "example.com.", lookupErr
+	}
+
+	resolve := func(cfg map[string]interface{}) {
+		t.Helper()
+		ch := newChallengeRequest(t, "sub.example.com", testKey, cfg)
+		loaded, err := loadConfig(ch.Config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := solver.resolveDomainName(context.Background(), ch, loaded, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	resolve(map[string]interface{}{})
+	resolve(map[string]interface{}{})
+	if lookups != 1 {
+		t.Errorf("expected the second lookup within the TTL to be cached, got %d lookups", lookups)
+	}
+
+	// Other nameservers may see another zone.
+	resolve(map[string]interface{}{"nameservers": []string{"10.0.0.1:53"}})
+	if lookups != 2 {
+		t.Errorf("expected a lookup through other nameservers not to use the cache, got %d lookups", lookups)
+	}
+
+	now = now.Add(defaultZoneCacheTTL)
+	resolve(map[string]interface{}{})
+	if lookups != 3 {
+		t.Errorf("expected the zone to be looked up again after the TTL, got %d lookups", lookups)
+	}
+
+	resolve(map[string]interface{}{"zoneCacheTTL": "0s"})
+	if lookups != 4 {
+		t.Errorf("expected a zero zoneCacheTTL to disable the cache, got %d lookups", lookups)
+	}
+}
+
+func TestZoneCacheSkipsFailedLookups(t *testing.T) {
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+
+	lookups := 0
+	solver.findZoneByFqdn = func(context.Context, string, []string) (string, error) {
+		lookups++
+		if lookups == 1 {
+			return "", errors.New("i/o timeout")
+		}
+		return "example.com.", nil
+	}
+
+	ch := newChallengeRequest(t, "sub.example.com", testKey, map[string]interface{}{"strictZoneDetection": true})
+	cfg, err := loadConfig(ch.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := solver.resolveDomainName(context.Background(), ch, cfg, nil); err == nil {
+		t.Fatal("expected the failed lookup to be returned")
+	}
+	domainName, err := solver.resolveDomainName(context.Background(), ch, cfg, nil)
+	if err != nil {
+		t.Fatalf("expected the zone to be looked up again after a failure, got %v", err)
+	}
+	if domainName != "example.com" || lookups != 2 {
+		t.Errorf("expected example.com after 2 lookups, got %q after %d", domainName, lookups)
+	}
+}
+
+func TestLoadConfigZoneCacheTTL(t *testing.T) {
+	for _, ttl := range []string{"-1s", "2h"} {
+		if _, err := loadConfig(&extapi.JSON{Raw: []byte(`{"zoneCacheTTL": "` + ttl + `"}`)}); err == nil {
+			t.Errorf("expected an error for zoneCacheTTL %s", ttl)
+		}
+	}
+}
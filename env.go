@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// pausedEnvVar stops the webhook from making any DNS changes while set to
+// true; challenges fail with errPaused so cert-manager retries them later.
+const pausedEnvVar = "TRANSIP_WEBHOOK_PAUSED"
+
+// workersEnvVar sets the number of workers processing challenges; when unset
+// or zero, each challenge is processed by the goroutine serving it.
+const workersEnvVar = "TRANSIP_WEBHOOK_WORKERS"
+
+// maxConcurrentOperationsEnvVar sets the number of read-modify-write cycles
+// against TransIP that may run at the same time across all challenges;
+// defaultMaxConcurrentOperations applies when unset or zero.
+const maxConcurrentOperationsEnvVar = "TRANSIP_WEBHOOK_MAX_CONCURRENT_OPERATIONS"
+
+// minRSAKeySizeEnvVar sets the smallest RSA private key size, in bits, the
+// webhook accepts; defaultMinRSAKeySize applies when unset or zero.
+const minRSAKeySizeEnvVar = "TRANSIP_MIN_RSA_KEY_SIZE"
+
+// defaultTTLEnvVar sets the TTL, in seconds, of challenge records whose config
+// does not set a positive ttl; defaultTTL applies when unset or zero.
+const defaultTTLEnvVar = "TRANSIP_DEFAULT_TTL"
+
+// pprofPortEnvVar enables the net/http/pprof and effective config debug
+// endpoints on the given port of the loopback interface; they are disabled
+// when unset or zero.
+const pprofPortEnvVar = "TRANSIP_WEBHOOK_PPROF_PORT"
+
+// metricsAddressEnvVar sets the address the Prometheus metrics are served on;
+// defaultMetricsAddress applies when unset.
+const metricsAddressEnvVar = "TRANSIP_WEBHOOK_METRICS_ADDRESS"
+
+// healthAddressEnvVar sets the address the liveness and readiness endpoints
+// are served on; defaultHealthAddress applies when unset.
+const healthAddressEnvVar = "TRANSIP_WEBHOOK_HEALTH_ADDRESS"
+
+// debugRequiredEnvVar makes failing to start the debug endpoints fatal; by
+// default the failure is logged and challenges are served regardless.
+const debugRequiredEnvVar = "TRANSIP_WEBHOOK_DEBUG_REQUIRED"
+
+// allowedNamespacesEnvVar restricts the webhook to challenges whose resource
+// namespace is in the comma-separated list; all namespaces are allowed when
+// unset.
+const allowedNamespacesEnvVar = "TRANSIP_WEBHOOK_ALLOWED_NAMESPACES"
+
+// entryLogVerbosityEnvVar sets the verbosity at which individual DNS entries
+// are logged, independently of the operations on them; defaultEntryLogVerbosity
+// applies when unset or zero.
+const entryLogVerbosityEnvVar = "TRANSIP_WEBHOOK_ENTRY_LOG_VERBOSITY"
+
+// leaseNamespaceEnvVar enables serializing the changes to each domain across
+// webhook replicas with Leases created in the given namespace.
+const leaseNamespaceEnvVar = "TRANSIP_WEBHOOK_LEASE_NAMESPACE"
+
+// auditEventsEnvVar makes the webhook record the DNS entries it creates,
+// updates and removes as Kubernetes Events on its own Pod, identified by
+// podNameEnvVar and podNamespaceEnvVar, in addition to the audit log.
+const auditEventsEnvVar = "TRANSIP_WEBHOOK_AUDIT_EVENTS"
+
+// podNameEnvVar and podNamespaceEnvVar identify the webhook's Pod, set through
+// the downward API.
+const (
+	podNameEnvVar      = "POD_NAME"
+	podNamespaceEnvVar = "POD_NAMESPACE"
+)
+
+// allowAmbientCredentialsEnvVar lets Issuers that configure no credentials use
+// the account in ambientAccountNameEnvVar with the private key at
+// ambientPrivateKeyPathEnvVar.
+const allowAmbientCredentialsEnvVar = "TRANSIP_WEBHOOK_ALLOW_AMBIENT_CREDENTIALS"
+
+// ambientAccountNameEnvVar and ambientPrivateKeyPathEnvVar hold the ambient
+// credentials allowed by allowAmbientCredentialsEnvVar.
+const (
+	ambientAccountNameEnvVar    = "TRANSIP_ACCOUNT_NAME"
+	ambientPrivateKeyPathEnvVar = "TRANSIP_PRIVATE_KEY_PATH"
+)
+
+// checkCredentialsDirEnvVar makes the webhook verify the credentials in the
+// given credentials directory with TransIP when it starts.
+const checkCredentialsDirEnvVar = "TRANSIP_WEBHOOK_CHECK_CREDENTIALS_DIR"
+
+// solversEnvVar registers a solver for each name in the given JSON object,
+// e.g. {"transip": {}, "transip-staging": {"testMode": true}}, with the value
+// as the default config of its Issuers; a single solver named
+// defaultSolverName is registered when unset.
+const solversEnvVar = "TRANSIP_WEBHOOK_SOLVERS"
+
+// workQueueDepth is the number of challenges each worker buffers before
+// further challenges block while being submitted.
+const workQueueDepth = 100
+
+// envBool parses the boolean environment variable name, returning false when
+// it is unset.
+func envBool(name string) (bool, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q for %s: expected a boolean", value, name)
+	}
+
+	return b, nil
+}
+
+// envInt parses the non-negative integer environment variable name,
+// returning 0 when it is unset.
+func envInt(name string) (int, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid value %q for %s: expected a non-negative integer", value, name)
+	}
+
+	return n, nil
+}
+
+// envList parses the comma-separated environment variable name, ignoring
+// surrounding whitespace and empty elements. It returns nil when unset.
+func envList(name string) []string {
+	var list []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestEnvBool(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{value: "", want: false},
+		{value: "true", want: true},
+		{value: "1", want: true},
+		{value: "false", want: false},
+		{value: "yes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("TRANSIP_TEST_BOOL", tt.value)
+
+		got, err := envBool("TRANSIP_TEST_BOOL")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("envBool(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("envBool(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestInitializePausedFromEnv(t *testing.T) {
+	t.Setenv(pausedEnvVar, "true")
+
+	solver := &transipDNSProviderSolver{}
+	if err := solver.Initialize(&rest.Config{}, make(chan struct{})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !solver.paused {
+		t.Error("expected the solver to be paused")
+	}
+}
+
+func TestPausedSolverMakesNoAPICalls(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+	solver.paused = true
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+
+	if err := solver.Present(ch); !errors.Is(err, errPaused) {
+		t.Errorf("Present() error = %v, want %v", err, errPaused)
+	}
+	if err := solver.CleanUp(ch); !errors.Is(err, errPaused) {
+		t.Errorf("CleanUp() error = %v, want %v", err, errPaused)
+	}
+
+	for _, method := range []string{"GetDNSEntries", "AddDNSEntry", "RemoveDNSEntry"} {
+		if got := repo.Calls(method); got != 0 {
+			t.Errorf("expected no %s calls while paused, got %d", method, got)
+		}
+	}
+}
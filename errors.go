@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/transip/gotransip/v6/domain"
+	"github.com/transip/gotransip/v6/rest"
+)
+
+// apiStatusCode returns the HTTP status code of an error returned by the
+// TransIP API, or 0 when err did not come from the API.
+func apiStatusCode(err error) int {
+	var restErr *rest.Error
+	if errors.As(err, &restErr) {
+		return restErr.StatusCode
+	}
+	return 0
+}
+
+// isUnauthorized reports whether the TransIP API rejected the authentication
+// of the call.
+func isUnauthorized(err error) bool {
+	return apiStatusCode(err) == http.StatusUnauthorized
+}
+
+// isForbidden reports whether the TransIP API refused the call for lack of
+// permissions.
+func isForbidden(err error) bool {
+	return apiStatusCode(err) == http.StatusForbidden
+}
+
+// isConflict reports whether the TransIP API refused the call because the
+// resource already exists.
+func isConflict(err error) bool {
+	return apiStatusCode(err) == http.StatusConflict
+}
+
+// isNotFound reports whether the TransIP API could not find the resource.
+func isNotFound(err error) bool {
+	return apiStatusCode(err) == http.StatusNotFound
+}
+
+// describeDomainError explains a not found error of the TransIP API for the
+// entries of domainName: the domain is not registered under the account the
+// Issuer authenticates as, typically because the Issuer is configured with the
+// wrong account. Other errors are returned as they are.
+func describeDomainError(err error, domainName, account string) error {
+	if !isNotFound(err) {
+		return err
+	}
+	return fmt.Errorf("domain %s is not managed by the TransIP account %s: configure the Issuer with the account the domain is registered under: %w", domainName, account, err)
+}
+
+// describeAPIError adds the name of the call and the HTTP status of an error
+// returned by the TransIP API to the message of TransIP, which on its own
+// does not tell an invalid request from a rate limit or a rejected key.
+// Errors that did not come from the API are returned as they are.
+func describeAPIError(err error, call string) error {
+	var restErr *rest.Error
+	if !errors.As(err, &restErr) {
+		return err
+	}
+	return fmt.Errorf("TransIP API call %s failed with HTTP status %d (%s): %w", call, restErr.StatusCode, http.StatusText(restErr.StatusCode), err)
+}
+
+// apiErrorRepository describes the TransIP API errors returned by the calls
+// of a dnsRepository with describeAPIError.
+type apiErrorRepository struct {
+	repo dnsRepository
+}
+
+func (r *apiErrorRepository) GetAll() ([]domain.Domain, error) {
+	domains, err := r.repo.GetAll()
+	return domains, describeAPIError(err, "GetAll")
+}
+
+func (r *apiErrorRepository) GetDNSEntries(domainName string) ([]domain.DNSEntry, error) {
+	entries, err := r.repo.GetDNSEntries(domainName)
+	return entries, describeAPIError(err, "GetDNSEntries")
+}
+
+func (r *apiErrorRepository) AddDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	return describeAPIError(r.repo.AddDNSEntry(domainName, dnsEntry), "AddDNSEntry")
+}
+
+func (r *apiErrorRepository) RemoveDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	return describeAPIError(r.repo.RemoveDNSEntry(domainName, dnsEntry), "RemoveDNSEntry")
+}
+
+func (r *apiErrorRepository) ReplaceDNSEntries(domainName string, dnsEntries []domain.DNSEntry) error {
+	return describeAPIError(r.repo.ReplaceDNSEntries(domainName, dnsEntries), "ReplaceDNSEntries")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6/rest"
+)
+
+func TestAPIStatusCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: &rest.Error{Message: "forbidden", StatusCode: 403}, want: 403},
+		{err: fmt.Errorf("wrapped: %w", &rest.Error{Message: "not found", StatusCode: 404}), want: 404},
+		{err: errors.New("connection refused"), want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := apiStatusCode(tt.err); got != tt.want {
+			t.Errorf("apiStatusCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestPresentListForbidden(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	repo.getErr = &rest.Error{Message: "this key is not allowed to list DNS entries", StatusCode: 403}
+	repo.rejectDuplicates = true
+
+	solver, logs := newTestSolver(repo)
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "tolerateListForbidden": true})
+
+	// Presenting twice succeeds: the second add is refused as a duplicate.
+	for i := 0; i < 2; i++ {
+		if err := solver.Present(ch); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if entries := repo.Entries("example.com"); len(entries) != 1 {
+		t.Errorf("expected one record, got %v", entries)
+	}
+	if !logs.Contains("listing DNS entries is forbidden") {
+		t.Errorf("expected the skipped listing to be logged, got logs:\n%s", logs)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := solver.CleanUp(ch); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if entries := repo.Entries("example.com"); len(entries) != 0 {
+		t.Errorf("expected the record to be removed, got %v", entries)
+	}
+}
+
+func TestPresentListForbiddenNotTolerated(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	repo.getErr = &rest.Error{Message: "this key is not allowed to list DNS entries", StatusCode: 403}
+
+	solver, _ := newTestSolver(repo)
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+
+	if err := solver.Present(ch); err == nil {
+		t.Fatal("expected an error when listing is forbidden")
+	}
+	if got := repo.Calls("AddDNSEntry"); got != 0 {
+		t.Errorf("expected no AddDNSEntry calls, got %d", got)
+	}
+}
+
+func TestDomainNotManaged(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	repo.getErr = &rest.Error{Message: "Domain not found", StatusCode: 404}
+
+	solver, _ := newTestSolver(repo)
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"accountName": "user", "ttl": 300})
+
+	want := `domain example.com is not managed by the TransIP account user`
+	for name, op := range map[string]func(*v1alpha1.ChallengeRequest) error{"present": solver.Present, "cleanup": solver.CleanUp} {
+		err := op(ch)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", name, want, err)
+		}
+		if !isNotFound(err) {
+			t.Errorf("%s: expected the API error to be wrapped, got %v", name, err)
+		}
+	}
+}
+
+func TestDescribeDomainErrorOtherErrors(t *testing.T) {
+	err := &rest.Error{Message: "internal error", StatusCode: 500}
+	if got := describeDomainError(err, "example.com", "user"); got != error(err) {
+		t.Errorf("expected other errors to be returned as they are, got %v", got)
+	}
+}
+
+func TestDescribeAPIError(t *testing.T) {
+	err := describeAPIError(fmt.Errorf("wrapped: %w", &rest.Error{Message: "rate limit exceeded", StatusCode: 429}), "AddDNSEntry")
+	want := "TransIP API call AddDNSEntry failed with HTTP status 429 (Too Many Requests): wrapped: rate limit exceeded"
+	if err.Error() != want {
+		t.Errorf("describeAPIError() = %q, want %q", err, want)
+	}
+	if apiStatusCode(err) != 429 {
+		t.Errorf("expected the API error to be wrapped, got %v", err)
+	}
+
+	other := errors.New("connection refused")
+	if got := describeAPIError(other, "AddDNSEntry"); got != other {
+		t.Errorf("expected other errors to be returned as they are, got %v", got)
+	}
+	if got := describeAPIError(nil, "AddDNSEntry"); got != nil {
+		t.Errorf("expected no error, got %v", got)
+	}
+}
+
+func TestPresentAddAPIError(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	repo.addErr = &rest.Error{Message: "The TTL is invalid", StatusCode: 406}
+
+	solver, logs := newTestSolver(repo)
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+
+	err := solver.Present(ch)
+	if err == nil {
+		t.Fatal("expected Present to fail")
+	}
+	for _, want := range []string{"AddDNSEntry", "406", "Not Acceptable", "The TTL is invalid"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to contain %q, got %v", want, err)
+		}
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("expected the logs to contain %q, got %s", want, logs.String())
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6/domain"
+	"github.com/transip/gotransip/v6/rest"
+)
+
+// testKey is a valid ACME DNS-01 challenge key.
+const testKey = "n4bQgYhMfWWaL-qgxVrQFaO_TxsrC4Is0V1sFbDwCgg"
+
+// otherTestKey is a valid challenge key for a second, concurrent challenge.
+const otherTestKey = "2SmKENGwc1g33EvYXaxkGw887yekfl1TpU8vP1svz_o"
+
+// fakeDNSRepository is an in-memory dnsRepository recording the calls made
+// against it.
+type fakeDNSRepository struct {
+	mu      sync.Mutex
+	entries map[string][]domain.DNSEntry
+	calls   []string
+
+	// storedTTL, when set, replaces the TTL of added entries to simulate
+	// normalization by the TransIP API.
+	storedTTL func(ttl int) int
+	// getDelay delays GetDNSEntries, widening the window for races between
+	// concurrent operations.
+	getDelay time.Duration
+	// getErr, when set, is returned by GetDNSEntries.
+	getErr error
+	// getAllErr, when set, is returned by GetAll.
+	getAllErr error
+	// addErr, when set, is returned by AddDNSEntry.
+	addErr error
+	// rejectDuplicates makes AddDNSEntry fail with a conflict for entries
+	// that already exist.
+	rejectDuplicates bool
+}
+
+func newFakeDNSRepository(domainName string, entries ...domain.DNSEntry) *fakeDNSRepository {
+	return &fakeDNSRepository{
+		entries: map[string][]domain.DNSEntry{domainName: entries},
+	}
+}
+
+func (r *fakeDNSRepository) GetAll() ([]domain.Domain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, "GetAll")
+
+	if r.getAllErr != nil {
+		return nil, r.getAllErr
+	}
+
+	domains := make([]domain.Domain, 0, len(r.entries))
+	for name := range r.entries {
+		domains = append(domains, domain.Domain{Name: name})
+	}
+
+	return domains, nil
+}
+
+func (r *fakeDNSRepository) GetDNSEntries(domainName string) ([]domain.DNSEntry, error) {
+	time.Sleep(r.getDelay)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, "GetDNSEntries")
+
+	if r.getErr != nil {
+		return nil, r.getErr
+	}
+
+	entries, ok := r.entries[domainName]
+	if !ok {
+		return nil, fmt.Errorf("domain %q not found", domainName)
+	}
+
+	return append([]domain.DNSEntry(nil), entries...), nil
+}
+
+func (r *fakeDNSRepository) AddDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, "AddDNSEntry")
+
+	if r.addErr != nil {
+		return r.addErr
+	}
+	if r.rejectDuplicates {
+		for _, e := range r.entries[domainName] {
+			if e == dnsEntry {
+				return &rest.Error{Message: "DNS entry already exists", StatusCode: 409}
+			}
+		}
+	}
+
+	if r.storedTTL != nil {
+		dnsEntry.Expire = r.storedTTL(dnsEntry.Expire)
+	}
+	r.entries[domainName] = append(r.entries[domainName], dnsEntry)
+
+	return nil
+}
+
+func (r *fakeDNSRepository) RemoveDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, "RemoveDNSEntry")
+
+	entries := r.entries[domainName]
+	for i, e := range entries {
+		if e == dnsEntry {
+			r.entries[domainName] = append(entries[:i:i], entries[i+1:]...)
+			return nil
+		}
+	}
+
+	return &rest.Error{Message: fmt.Sprintf("dns entry %v not found", dnsEntry), StatusCode: 404}
+}
+
+func (r *fakeDNSRepository) ReplaceDNSEntries(domainName string, dnsEntries []domain.DNSEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, "ReplaceDNSEntries")
+
+	if _, ok := r.entries[domainName]; !ok {
+		return fmt.Errorf("domain %q not found", domainName)
+	}
+	r.entries[domainName] = append([]domain.DNSEntry(nil), dnsEntries...)
+
+	return nil
+}
+
+// Entries returns a copy of the entries currently stored for the domain.
+func (r *fakeDNSRepository) Entries(domainName string) []domain.DNSEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]domain.DNSEntry(nil), r.entries[domainName]...)
+}
+
+// Calls returns the number of calls made to the named method.
+func (r *fakeDNSRepository) Calls(method string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, call := range r.calls {
+		if call == method {
+			n++
+		}
+	}
+	return n
+}
+
+// fakeClock records the delays waited for instead of waiting.
+type fakeClock struct {
+	mu     sync.Mutex
+	delays []time.Duration
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.delays = append(c.delays, d)
+
+	ch := make(chan time.Time, 1)
+	ch <- time.Time{}
+	return ch
+}
+
+// Delays returns the delays waited for so far.
+func (c *fakeClock) Delays() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]time.Duration(nil), c.delays...)
+}
+
+// logBuffer collects the lines written by a logger created by newTestLogger.
+type logBuffer struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return strings.Join(b.lines, "\n")
+}
+
+func (b *logBuffer) Contains(s string) bool {
+	return strings.Contains(b.String(), s)
+}
+
+func newTestLogger() (logr.Logger, *logBuffer) {
+	buf := &logBuffer{}
+	log := funcr.New(func(prefix, args string) {
+		buf.mu.Lock()
+		defer buf.mu.Unlock()
+		buf.lines = append(buf.lines, prefix+" "+args)
+	}, funcr.Options{})
+
+	return log, buf
+}
+
+// newTestSolver returns a solver backed by repo, which treats the resolved
+// zone of each challenge as the TransIP domain.
+func newTestSolver(repo dnsRepository) (*transipDNSProviderSolver, *logBuffer) {
+	log, buf := newTestLogger()
+
+	return &transipDNSProviderSolver{
+		log:   log,
+		clock: &fakeClock{},
+		repositoryFactory: func(*v1alpha1.ChallengeRequest, *transipDNSProviderConfig) (dnsRepository, error) {
+			return repo, nil
+		},
+		findZoneByFqdn: func(_ context.Context, fqdn string, _ []string) (string, error) {
+			return fqdn, nil
+		},
+	}, buf
+}
+
+// newChallengeRequest returns a challenge for _acme-challenge.<zone> using the
+// given key and solver config.
+func newChallengeRequest(t *testing.T, zone, key string, cfg map[string]interface{}) *v1alpha1.ChallengeRequest {
+	t.Helper()
+
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge." + zone + ".",
+		ResolvedZone:      zone + ".",
+		Key:               key,
+		ResourceNamespace: "default",
+		Config:            &extapi.JSON{Raw: raw},
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// logServingInfo logs the API group and solver name that the webhook solver
+// of an Issuer must reference for cert-manager to route its challenges here.
+// A mismatch is never seen by the webhook, so this is the place to compare.
+func (c *transipDNSProviderSolver) logServingInfo(groupName string) {
+	c.logger().Info("serving DNS-01 challenges for Issuers whose webhook solver references this groupName and solverName",
+		"groupName", groupName, "solverName", c.Name())
+}
+
+// checkMisplacedSolverFields warns when the solver config holds groupName or
+// solverName, which belong next to the config in the webhook solver of the
+// Issuer, and points out when they differ from what this webhook serves.
+func (c *transipDNSProviderSolver) checkMisplacedSolverFields(raw []byte, groupName string) {
+	var fields struct {
+		GroupName  *string `json:"groupName"`
+		SolverName *string `json:"solverName"`
+	}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return
+	}
+
+	if fields.GroupName != nil {
+		c.logger().Info("WARNING: groupName is set inside the solver config, where it has no effect; set it on the webhook solver of the Issuer",
+			"configGroupName", *fields.GroupName, "groupName", groupName, "mismatch", *fields.GroupName != groupName)
+	}
+	if fields.SolverName != nil {
+		c.logger().Info("WARNING: solverName is set inside the solver config, where it has no effect; set it on the webhook solver of the Issuer",
+			"configSolverName", *fields.SolverName, "solverName", c.Name(), "mismatch", *fields.SolverName != c.Name())
+	}
+}
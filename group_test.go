@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLogServingInfo(t *testing.T) {
+	solver, logs := newTestSolver(newFakeDNSRepository("example.com"))
+	solver.logServingInfo("acme.example.com")
+
+	if !logs.Contains(`"groupName"="acme.example.com" "solverName"="transip"`) {
+		t.Errorf("expected the group and solver name to be logged, got logs:\n%s", logs)
+	}
+}
+
+func TestCheckMisplacedSolverFields(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		want   string
+	}{
+		"mismatching group": {
+			config: `{"groupName": "acme.other.com", "ttl": 300}`,
+			want:   `"configGroupName"="acme.other.com" "groupName"="acme.example.com" "mismatch"=true`,
+		},
+		"matching group": {
+			config: `{"groupName": "acme.example.com"}`,
+			want:   `"mismatch"=false`,
+		},
+		"solver name": {
+			config: `{"solverName": "transip-dns"}`,
+			want:   `"configSolverName"="transip-dns" "solverName"="transip" "mismatch"=true`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			solver, logs := newTestSolver(newFakeDNSRepository("example.com"))
+			solver.checkMisplacedSolverFields([]byte(tt.config), "acme.example.com")
+
+			if !logs.Contains(tt.want) {
+				t.Errorf("expected logs to contain %s, got:\n%s", tt.want, logs)
+			}
+		})
+	}
+
+	solver, logs := newTestSolver(newFakeDNSRepository("example.com"))
+	solver.checkMisplacedSolverFields([]byte(`{"ttl": 300}`), "acme.example.com")
+	if logs.Contains("WARNING") {
+		t.Errorf("expected no warning without misplaced fields, got logs:\n%s", logs)
+	}
+}
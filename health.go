@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// defaultHealthAddress is the address the health endpoints are served on
+// when healthAddressEnvVar is unset.
+const defaultHealthAddress = ":8081"
+
+// startHealthServer serves the liveness and readiness endpoints on addr until
+// stop is closed, returning the address it listens on. /healthz succeeds as
+// long as the process serves requests; /readyz succeeds once ready is set.
+func startHealthServer(addr string, ready *atomic.Bool, stop <-chan struct{}, log logr.Logger) (net.Addr, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if !ready.Load() {
+			http.Error(w, "initializing", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error(err, "health server stopped")
+		}
+	}()
+	go func() {
+		<-stop
+		server.Close()
+	}()
+
+	return listener.Addr(), nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/rest"
+)
+
+func getStatus(t *testing.T, url string) int {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("expected %s to be reachable: %v", url, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestHealthServerReadiness(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	var ready atomic.Bool
+	addr, err := startHealthServer(net.JoinHostPort(debugHost, "0"), &ready, stopCh, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := "http://" + addr.String()
+
+	if got := getStatus(t, base+"/healthz"); got != http.StatusOK {
+		t.Errorf("expected /healthz to succeed while initializing, got %d", got)
+	}
+	if got := getStatus(t, base+"/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("expected /readyz to fail while initializing, got %d", got)
+	}
+
+	ready.Store(true)
+	if got := getStatus(t, base+"/readyz"); got != http.StatusOK {
+		t.Errorf("expected /readyz to succeed once ready, got %d", got)
+	}
+}
+
+func TestInitializeServesHealth(t *testing.T) {
+	addr := net.JoinHostPort(debugHost, strconv.Itoa(freePort(t)))
+	t.Setenv(healthAddressEnvVar, addr)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	solver := &transipDNSProviderSolver{}
+	if err := solver.Initialize(&rest.Config{}, stopCh); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		if got := getStatus(t, "http://"+addr+path); got != http.StatusOK {
+			t.Errorf("expected %s to succeed once initialized, got %d", path, got)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// inflightCall is an operation in progress that callers with the same key
+// wait for.
+type inflightCall struct {
+	done    chan struct{}
+	err     error
+	waiters int
+}
+
+// inflightGroup coalesces identical operations in flight: callers of Do with
+// the key of an operation in progress wait for it and share its error instead
+// of running it again. The zero value is ready to use.
+type inflightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*inflightCall
+}
+
+// Do runs fn unless an operation with the same key is in progress, in which
+// case it waits for that operation. It reports whether the error was shared
+// with another caller.
+func (g *inflightGroup) Do(key string, fn func() error) (shared bool, err error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		call.waiters++
+		g.mu.Unlock()
+		<-call.done
+		return true, call.err
+	}
+
+	call := &inflightCall{done: make(chan struct{})}
+	if g.calls == nil {
+		g.calls = map[string]*inflightCall{}
+	}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.err = fn()
+	return false, call.err
+}
+
+// Waiters returns the number of callers waiting for the operation with key in
+// progress.
+func (g *inflightGroup) Waiters(key string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if call, ok := g.calls[key]; ok {
+		return call.waiters
+	}
+	return 0
+}
+
+// presentKey identifies identical presents of a challenge: the same key at
+// the same FQDN in the same zone, with the same config. The config is hashed
+// so that inline credentials are not kept as keys.
+func presentKey(ch *v1alpha1.ChallengeRequest) string {
+	h := sha256.New()
+	for _, s := range []string{ch.ResolvedZone, ch.ResolvedFQDN, ch.Key} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	if ch.Config != nil {
+		h.Write(ch.Config.Raw)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6/rest"
+)
+
+// waitForWaiters waits until n callers wait for the operation with key.
+func waitForWaiters(t *testing.T, g *inflightGroup, key string, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for g.Waiters(key) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d waiters, got %d", n, g.Waiters(key))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestInflightGroupSharesError(t *testing.T) {
+	var g inflightGroup
+	errFailed := errors.New("failed")
+	release := make(chan struct{})
+
+	var runs atomic.Int32
+	fn := func() error {
+		runs.Add(1)
+		<-release
+		return errFailed
+	}
+
+	const callers = 5
+	shared := make([]bool, callers)
+	errs := make([]error, callers)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		shared[0], errs[0] = g.Do("key", fn)
+	}()
+	for runs.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			shared[i], errs[i] = g.Do("key", fn)
+		}(i)
+	}
+	waitForWaiters(t, &g, "key", callers-1)
+	close(release)
+	wg.Wait()
+
+	if runs.Load() != 1 {
+		t.Errorf("expected a single run, got %d", runs.Load())
+	}
+	for i := range errs {
+		if !errors.Is(errs[i], errFailed) {
+			t.Errorf("caller %d: expected the shared error, got %v", i, errs[i])
+		}
+		if shared[i] != (i > 0) {
+			t.Errorf("caller %d: unexpected shared %v", i, shared[i])
+		}
+	}
+
+	// Once done, the next call runs again.
+	if shared, _ := g.Do("key", func() error { return nil }); shared {
+		t.Error("expected a call after completion not to be shared")
+	}
+}
+
+func TestPresentCoalescesIdenticalCalls(t *testing.T) {
+	tests := map[string]struct {
+		addErr  error
+		wantErr bool
+	}{
+		"success": {},
+		"failure": {addErr: &rest.Error{Message: "The TTL is invalid", StatusCode: 406}, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := newFakeDNSRepository("example.com")
+			repo.addErr = tt.addErr
+			solver, _ := newTestSolver(repo)
+
+			started := make(chan struct{})
+			release := make(chan struct{})
+			var repos atomic.Int32
+			solver.repositoryFactory = func(*v1alpha1.ChallengeRequest, *transipDNSProviderConfig) (dnsRepository, error) {
+				if repos.Add(1) == 1 {
+					close(started)
+					<-release
+				}
+				return repo, nil
+			}
+
+			ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+
+			const callers = 8
+			errs := make([]error, callers)
+			var wg sync.WaitGroup
+			for i := 0; i < callers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					errs[i] = solver.Present(ch)
+				}(i)
+			}
+
+			<-started
+			waitForWaiters(t, &solver.presents, presentKey(ch), callers-1)
+			close(release)
+			wg.Wait()
+
+			if got := repos.Load(); got != 1 {
+				t.Errorf("expected a single present to run, got %d", got)
+			}
+			if got := repo.Calls("AddDNSEntry"); got != 1 {
+				t.Errorf("expected a single AddDNSEntry call, got %d", got)
+			}
+			for i, err := range errs {
+				if (err != nil) != tt.wantErr || (err != nil && err.Error() != errs[0].Error()) {
+					t.Errorf("caller %d: unexpected error %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPresentKey(t *testing.T) {
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	other := newChallengeRequest(t, "example.com", otherTestKey, map[string]interface{}{"ttl": 300})
+	otherConfig := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 60})
+
+	if presentKey(ch) != presentKey(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})) {
+		t.Error("expected identical challenges to share a key")
+	}
+	if presentKey(ch) == presentKey(other) || presentKey(ch) == presentKey(otherConfig) {
+		t.Error("expected challenges with another key or config not to share a key")
+	}
+}
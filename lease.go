@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// domainLeaseDuration bounds how long a replica may hold the lease of a
+// domain: a lease that was not released within it, e.g. because the replica
+// crashed, may be taken over by another replica.
+const domainLeaseDuration = 2 * time.Minute
+
+// domainLeaseRenewInterval is how often a held lease is renewed, well within
+// domainLeaseDuration, so that it does not expire during a long mutation.
+const domainLeaseRenewInterval = domainLeaseDuration / 4
+
+// domainLeaseRequestTimeout bounds renewing and releasing a lease.
+const domainLeaseRequestTimeout = 10 * time.Second
+
+// domainLeaseRetryInterval is how long to wait before trying again to take a
+// lease held by another replica.
+const domainLeaseRetryInterval = time.Second
+
+// domainLeaseWaitTimeout is how long a mutation waits for the lease of its
+// domain; it outlasts a lease left behind by a replica that stopped.
+const domainLeaseWaitTimeout = domainLeaseDuration + 30*time.Second
+
+// domainLeasePrefix is prepended to the lowercase domain name to name its
+// Lease.
+const domainLeasePrefix = "transip-webhook."
+
+// leaseLocker serializes the mutations of a domain across webhook replicas
+// using a coordination.k8s.io Lease per domain.
+type leaseLocker struct {
+	client    kubernetes.Interface
+	namespace string
+	// identity is the holder identity of the leases taken by this replica.
+	identity string
+	clock    clock
+	now      func() time.Time
+	log      logr.Logger
+	// renewInterval replaces domainLeaseRenewInterval when set; it is used
+	// by the tests.
+	renewInterval time.Duration
+}
+
+// Lock blocks until the lease of domainName is held by this replica or ctx is
+// done, and returns the function releasing it. The lease is renewed until it
+// is released.
+func (l *leaseLocker) Lock(ctx context.Context, domainName string) (unlock func(), err error) {
+	name := domainLeasePrefix + strings.ToLower(domainName)
+
+	for {
+		lease, err := l.tryAcquire(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("acquiring lease %s/%s: %w", l.namespace, name, err)
+		}
+		if lease != nil {
+			stopRenewing := l.renew(lease)
+			return func() { l.release(stopRenewing()) }, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("acquiring lease %s/%s: %w", l.namespace, name, ctx.Err())
+		case <-l.clock.After(domainLeaseRetryInterval):
+		}
+	}
+}
+
+// tryAcquire takes the lease called name when it is free or expired. It
+// returns a nil lease, without an error, when another replica holds it or won
+// the race for it.
+func (l *leaseLocker) tryAcquire(ctx context.Context, name string) (*coordinationv1.Lease, error) {
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	now := metav1.NewMicroTime(l.now())
+	duration := int32(domainLeaseDuration / time.Second)
+
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: l.namespace},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.identity,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return nil, nil
+		}
+		return lease, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if held(lease, now.Time) {
+		l.log.V(1).Info("waiting for the lease of another replica", "lease", name, "holder", *lease.Spec.HolderIdentity)
+		return nil, nil
+	}
+
+	lease.Spec.HolderIdentity = &l.identity
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+
+	lease, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return nil, nil
+	}
+	return lease, err
+}
+
+// held reports whether lease is held by a replica and has not expired at now.
+func held(lease *coordinationv1.Lease, now time.Time) bool {
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return false
+	}
+
+	expiry := spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+	return now.Before(expiry)
+}
+
+// renew renews lease in the background until the returned function is
+// called, which returns the lease as last renewed. A lease that cannot be
+// renewed is retried at the next interval, and expires when renewing keeps
+// failing.
+func (l *leaseLocker) renew(lease *coordinationv1.Lease) (stop func() *coordinationv1.Lease) {
+	interval := l.renewInterval
+	if interval == 0 {
+		interval = domainLeaseRenewInterval
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			renewed, err := l.renewOnce(lease)
+			if err != nil {
+				l.log.Error(err, "could not renew lease", "lease", lease.Name)
+				continue
+			}
+			lease = renewed
+		}
+	}()
+
+	return func() *coordinationv1.Lease {
+		close(done)
+		<-stopped
+		return lease
+	}
+}
+
+// renewOnce moves the renew time of lease to now.
+func (l *leaseLocker) renewOnce(lease *coordinationv1.Lease) (*coordinationv1.Lease, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), domainLeaseRequestTimeout)
+	defer cancel()
+
+	lease = lease.DeepCopy()
+	now := metav1.NewMicroTime(l.now())
+	lease.Spec.RenewTime = &now
+
+	return l.client.CoordinationV1().Leases(l.namespace).Update(ctx, lease, metav1.UpdateOptions{})
+}
+
+// release frees lease by clearing its holder, so other replicas can take it
+// right away. A lease that cannot be released expires on its own.
+func (l *leaseLocker) release(lease *coordinationv1.Lease) {
+	ctx, cancel := context.WithTimeout(context.Background(), domainLeaseRequestTimeout)
+	defer cancel()
+
+	lease = lease.DeepCopy()
+	lease.Spec.HolderIdentity = nil
+
+	if _, err := l.client.CoordinationV1().Leases(l.namespace).Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		l.log.Error(err, "could not release lease, it expires on its own", "lease", lease.Name)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/transip/gotransip/v6/domain"
+)
+
+// leaseCheckingRepository records the holder of the lease of the domain
+// whenever an entry is added or removed.
+type leaseCheckingRepository struct {
+	*fakeDNSRepository
+	t       *testing.T
+	client  kubernetes.Interface
+	holders []string
+}
+
+func (r *leaseCheckingRepository) holder(domainName string) {
+	lease, err := r.client.CoordinationV1().Leases("cert-manager").Get(context.TODO(), domainLeasePrefix+domainName, metav1.GetOptions{})
+	if err != nil {
+		r.t.Errorf("expected the lease to exist during the mutation: %v", err)
+		return
+	}
+	if lease.Spec.HolderIdentity == nil {
+		r.holders = append(r.holders, "")
+		return
+	}
+	r.holders = append(r.holders, *lease.Spec.HolderIdentity)
+}
+
+func (r *leaseCheckingRepository) AddDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	r.holder(domainName)
+	return r.fakeDNSRepository.AddDNSEntry(domainName, dnsEntry)
+}
+
+func (r *leaseCheckingRepository) RemoveDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	r.holder(domainName)
+	return r.fakeDNSRepository.RemoveDNSEntry(domainName, dnsEntry)
+}
+
+func newTestLeaseLocker(client kubernetes.Interface, now time.Time) *leaseLocker {
+	log, _ := newTestLogger()
+	return &leaseLocker{
+		client:    client,
+		namespace: "cert-manager",
+		identity:  "replica-a",
+		clock:     &fakeClock{},
+		now:       func() time.Time { return now },
+		log:       log,
+	}
+}
+
+func TestLeaseHeldAroundMutations(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	repo := &leaseCheckingRepository{fakeDNSRepository: newFakeDNSRepository("example.com"), t: t, client: client}
+
+	solver, _ := newTestSolver(repo)
+	solver.leases = newTestLeaseLocker(client, time.Now())
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(repo.holders) != 2 || repo.holders[0] != "replica-a" || repo.holders[1] != "replica-a" {
+		t.Errorf("expected the lease to be held by replica-a during both mutations, got %v", repo.holders)
+	}
+
+	lease, err := client.CoordinationV1().Leases("cert-manager").Get(context.TODO(), domainLeasePrefix+"example.com", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.Spec.HolderIdentity != nil {
+		t.Errorf("expected the lease to be released, held by %q", *lease.Spec.HolderIdentity)
+	}
+}
+
+func heldLease(holder string, renewed time.Time) *coordinationv1.Lease {
+	duration := int32(domainLeaseDuration / time.Second)
+	renewTime := metav1.NewMicroTime(renewed)
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: domainLeasePrefix + "example.com", Namespace: "cert-manager"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			RenewTime:            &renewTime,
+		},
+	}
+}
+
+func TestLeaseHeldByOtherReplica(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	client := fake.NewSimpleClientset(heldLease("replica-b", now.Add(-time.Second)))
+	locker := newTestLeaseLocker(client, now)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := locker.Lock(ctx, "Example.com"); err == nil {
+		t.Fatal("expected the lease of another replica not to be taken")
+	}
+}
+
+func TestLeaseExpiredIsTakenOver(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	client := fake.NewSimpleClientset(heldLease("replica-b", now.Add(-domainLeaseDuration-time.Second)))
+	locker := newTestLeaseLocker(client, now)
+
+	unlock, err := locker.Lock(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer unlock()
+
+	lease, err := client.CoordinationV1().Leases("cert-manager").Get(context.TODO(), domainLeasePrefix+"example.com", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := *lease.Spec.HolderIdentity; got != "replica-a" {
+		t.Errorf("expected the expired lease to be taken over by replica-a, held by %q", got)
+	}
+}
+
+func TestLeaseRenewedWhileHeld(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var elapsed atomic.Int64
+
+	client := fake.NewSimpleClientset()
+	locker := newTestLeaseLocker(client, start)
+	locker.now = func() time.Time { return start.Add(time.Duration(elapsed.Load())) }
+	locker.renewInterval = 10 * time.Millisecond
+
+	unlock, err := locker.Lock(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A mutation outlasting the lease duration keeps the lease.
+	elapsed.Store(int64(domainLeaseDuration + time.Minute))
+	get := func() *coordinationv1.Lease {
+		lease, err := client.CoordinationV1().Leases("cert-manager").Get(context.TODO(), domainLeasePrefix+"example.com", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lease
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !held(get(), locker.now()) {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the lease to be renewed while held")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	unlock()
+	if lease := get(); lease.Spec.HolderIdentity != nil {
+		t.Errorf("expected the lease to be released, held by %q", *lease.Spec.HolderIdentity)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// defaultMaxConcurrentOperations is the number of read-modify-write cycles
+// against TransIP that may run at the same time, across all challenges and
+// domains, when maxConcurrentOperationsEnvVar is unset or zero.
+const defaultMaxConcurrentOperations = 5
+
+// operationLimiter bounds the number of read-modify-write cycles against
+// TransIP in progress at the same time. A nil limiter does not limit them.
+type operationLimiter struct {
+	slots chan struct{}
+}
+
+// newOperationLimiter returns a limiter allowing n operations at a time.
+func newOperationLimiter(n int) *operationLimiter {
+	return &operationLimiter{slots: make(chan struct{}, n)}
+}
+
+// Acquire blocks until an operation may start or ctx is done, and returns the
+// function ending the operation.
+func (l *operationLimiter) Acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for one of the %d concurrent TransIP operations to complete: %w", cap(l.slots), ctx.Err())
+	}
+}
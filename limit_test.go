@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/transip/gotransip/v6/domain"
+)
+
+// concurrencyRepository records the largest number of read-modify-write
+// cycles, from listing the entries of a domain to adding one, in progress at
+// the same time.
+type concurrencyRepository struct {
+	*fakeDNSRepository
+
+	mu     sync.Mutex
+	active int
+	max    int
+}
+
+func (r *concurrencyRepository) GetDNSEntries(domainName string) ([]domain.DNSEntry, error) {
+	r.mu.Lock()
+	r.active++
+	r.max = max(r.max, r.active)
+	r.mu.Unlock()
+
+	return r.fakeDNSRepository.GetDNSEntries(domainName)
+}
+
+func (r *concurrencyRepository) AddDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	defer func() {
+		r.mu.Lock()
+		r.active--
+		r.mu.Unlock()
+	}()
+
+	return r.fakeDNSRepository.AddDNSEntry(domainName, dnsEntry)
+}
+
+func TestPresentLimitsConcurrentOperations(t *testing.T) {
+	const domains, limit = 8, 2
+
+	fake := &fakeDNSRepository{entries: map[string][]domain.DNSEntry{}, getDelay: 10 * time.Millisecond}
+	for i := 0; i < domains; i++ {
+		fake.entries[fmt.Sprintf("example%d.com", i)] = nil
+	}
+	repo := &concurrencyRepository{fakeDNSRepository: fake}
+
+	solver, _ := newTestSolver(repo)
+	solver.operations = newOperationLimiter(limit)
+
+	var wg sync.WaitGroup
+	errs := make([]error, domains)
+	for i := 0; i < domains; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = solver.Present(newChallengeRequest(t, fmt.Sprintf("example%d.com", i), testKey, map[string]interface{}{"ttl": 300}))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("example%d.com: unexpected error: %v", i, err)
+		}
+	}
+	if repo.max > limit {
+		t.Errorf("expected at most %d concurrent operations, got %d", limit, repo.max)
+	}
+	if got := fake.Calls("AddDNSEntry"); got != domains {
+		t.Errorf("expected a record added to each domain, got %d", got)
+	}
+}
+
+func TestOperationLimiterRespectsContext(t *testing.T) {
+	l := newOperationLimiter(1)
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected waiting to stop with the context, got %v", err)
+	}
+
+	release()
+	release, err = l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("expected the released slot to be acquired, got %v", err)
+	}
+	release()
+}
+
+func TestNilOperationLimiter(t *testing.T) {
+	var l *operationLimiter
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("expected a nil limiter not to limit, got %v", err)
+	}
+	release()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// domainLocks serializes the read-modify-write cycles performed against the
+// DNS entries of a single TransIP domain, so concurrent challenges for the
+// same domain cannot act on a stale list of entries.
+// The zero value is ready to use.
+type domainLocks struct {
+	mu    sync.Mutex
+	locks map[string]*domainLock
+}
+
+type domainLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Lock blocks until the lock for domainName is acquired and returns the
+// function releasing it.
+func (l *domainLocks) Lock(domainName string) (unlock func()) {
+	key := strings.ToLower(domainName)
+
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*domainLock{}
+	}
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &domainLock{}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+
+	return func() {
+		lock.mu.Unlock()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, key)
+		}
+	}
+}
+
+// lockDomain takes the lock of domainName within this replica and, when
+// leases are configured, the lease of the domain across replicas, and then
+// waits for the operation limiter. It returns the function releasing all of
+// them. The limiter is only waited for once the domain is locked, so that
+// the operations holding it never wait for a domain lock.
+func (c *transipDNSProviderSolver) lockDomain(ctx context.Context, domainName string) (unlock func(), err error) {
+	locks := &c.domainLocks
+	operations := c.operations
+	if c.primary != nil {
+		locks = &c.primary.domainLocks
+		operations = c.primary.operations
+	}
+
+	unlockLocal := locks.Lock(domainName)
+	unlockLease := func() {}
+	if c.leases != nil {
+		leaseCtx, cancel := context.WithTimeout(ctx, domainLeaseWaitTimeout)
+		defer cancel()
+
+		unlockLease, err = c.leases.Lock(leaseCtx, domainName)
+		if err != nil {
+			unlockLocal()
+			return nil, err
+		}
+	}
+
+	release, err := operations.Acquire(ctx)
+	if err != nil {
+		unlockLease()
+		unlockLocal()
+		return nil, err
+	}
+
+	return func() {
+		release()
+		unlockLease()
+		unlockLocal()
+	}, nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDomainLocksSerializeSameDomain(t *testing.T) {
+	var locks domainLocks
+
+	unlock := locks.Lock("example.com")
+
+	acquired := make(chan struct{})
+	go func() {
+		defer close(acquired)
+		locks.Lock("EXAMPLE.com")()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("lock for the same domain acquired while held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("lock not acquired after release")
+	}
+
+	if len(locks.locks) != 0 {
+		t.Errorf("expected released locks to be removed, got %d", len(locks.locks))
+	}
+}
+
+func TestDomainLocksIndependentDomains(t *testing.T) {
+	var locks domainLocks
+
+	unlock := locks.Lock("example.com")
+	defer unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		locks.Lock("example.org")()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lock for another domain blocked")
+	}
+}
+
+func TestCleanUpConcurrentSameRecord(t *testing.T) {
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+
+	repo := newFakeDNSRepository("example.com")
+	repo.getDelay = 10 * time.Millisecond
+
+	solver, _ := newTestSolver(repo)
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const cleanups = 5
+	errs := make(chan error, cleanups)
+
+	var wg sync.WaitGroup
+	for i := 0; i < cleanups; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- solver.CleanUp(ch)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error from concurrent cleanup: %v", err)
+		}
+	}
+
+	if got := repo.Calls("RemoveDNSEntry"); got != 1 {
+		t.Errorf("expected the record to be removed once, got %d RemoveDNSEntry calls", got)
+	}
+	if entries := repo.Entries("example.com"); len(entries) != 0 {
+		t.Errorf("expected no entries left, got %v", entries)
+	}
+}
+
+func TestPresentConcurrentBatchUpdates(t *testing.T) {
+	cfg := map[string]interface{}{"ttl": 300, "batchUpdates": true}
+	challenges := []string{testKey, otherTestKey}
+
+	repo := newFakeDNSRepository("example.com")
+	repo.getDelay = 10 * time.Millisecond
+	solver, _ := newTestSolver(repo)
+
+	errs := make(chan error, len(challenges))
+	var wg sync.WaitGroup
+	for _, key := range challenges {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			errs <- solver.Present(newChallengeRequest(t, "example.com", key, cfg))
+		}(key)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error from concurrent present: %v", err)
+		}
+	}
+
+	// Replacing the entries from a stale listing would lose one of the
+	// records; the domain lock keeps both.
+	entries := repo.Entries("example.com")
+	if len(entries) != len(challenges) {
+		t.Fatalf("expected both records to survive, got %v", entries)
+	}
+	if got := repo.Calls("AddDNSEntry"); got != 0 {
+		t.Errorf("expected no AddDNSEntry calls with batchUpdates, got %d", got)
+	}
+	if got := repo.Calls("ReplaceDNSEntries"); got != len(challenges) {
+		t.Errorf("expected %d ReplaceDNSEntries calls, got %d", len(challenges), got)
+	}
+
+	if err := solver.CleanUp(newChallengeRequest(t, "example.com", testKey, cfg)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := repo.Calls("RemoveDNSEntry"); got != 0 {
+		t.Errorf("expected no RemoveDNSEntry calls with batchUpdates, got %d", got)
+	}
+	if entries := repo.Entries("example.com"); len(entries) != 1 || entries[0].Content != otherTestKey {
+		t.Errorf("expected only the other record to remain, got %v", entries)
+	}
+}
+
+func TestPresentConcurrentDistinctRecords(t *testing.T) {
+	const presents = 5
+
+	keys := make([]string, presents)
+	for i := range keys {
+		digest := sha256.Sum256([]byte{byte(i)})
+		keys[i] = base64.RawURLEncoding.EncodeToString(digest[:])
+	}
+
+	for _, batch := range []bool{false, true} {
+		t.Run(fmt.Sprintf("batchUpdates=%v", batch), func(t *testing.T) {
+			repo := newFakeDNSRepository("example.com")
+			repo.getDelay = 10 * time.Millisecond
+			solver, _ := newTestSolver(repo)
+
+			errs := make(chan error, presents)
+			var wg sync.WaitGroup
+			for _, key := range keys {
+				wg.Add(1)
+				go func(key string) {
+					defer wg.Done()
+					errs <- solver.Present(newChallengeRequest(t, "example.com", key, map[string]interface{}{"ttl": 300, "batchUpdates": batch}))
+				}(key)
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				if err != nil {
+					t.Errorf("unexpected error from concurrent present: %v", err)
+				}
+			}
+
+			present := map[string]bool{}
+			for _, e := range repo.Entries("example.com") {
+				present[e.Content] = true
+			}
+			for _, key := range keys {
+				if !present[key] {
+					t.Errorf("expected the record with key %s to be present, got %v", key, repo.Entries("example.com"))
+				}
+			}
+		})
+	}
+}
+
+func TestPresentReleasesDomainLockOnError(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	repo.getErr = errors.New("connection reset")
+	solver, _ := newTestSolver(repo)
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "retryAttempts": 1})
+
+	if err := solver.Present(ch); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(solver.domainLocks.locks) != 0 {
+		t.Fatalf("expected the domain lock to be released, got %d held", len(solver.domainLocks.locks))
+	}
+
+	// The next challenge for the domain is not blocked by the failed one.
+	repo.getErr = nil
+	done := make(chan error, 1)
+	go func() { done <- solver.Present(ch) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("present blocked on the lock of the failed present")
+	}
+}
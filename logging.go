@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/transip/gotransip/v6/domain"
+)
+
+// defaultEntryLogVerbosity is the verbosity at which the individual DNS
+// entries of a domain are logged, above the info level of the operations.
+const defaultEntryLogVerbosity = 4
+
+// challengeContentLogVerbosity is the verbosity at which the content of
+// challenge records, which holds the challenge key, is logged.
+const challengeContentLogVerbosity = 5
+
+// logEntries logs each of entries at the entry verbosity, so that listing
+// large domains only adds to the logs when asked for.
+func (c *transipDNSProviderSolver) logEntries(domainName string, entries []domain.DNSEntry) {
+	verbosity := c.entryVerbosity
+	if verbosity == 0 {
+		verbosity = defaultEntryLogVerbosity
+	}
+
+	log := c.logger().V(verbosity)
+	if !log.Enabled() {
+		return
+	}
+	for _, e := range entries {
+		log.Info("DNS entry", "domain", domainName, "name", e.Name, "type", e.Type, "ttl", e.Expire)
+	}
+}
+
+// logChallengeEntry logs the challenge record including its content, which is
+// only logged for debugging as it holds the challenge key.
+func (c *transipDNSProviderSolver) logChallengeEntry(domainName string, entry domain.DNSEntry) {
+	c.logger().V(challengeContentLogVerbosity).Info("challenge record", "domain", domainName, "name", entry.Name, "type", entry.Type, "ttl", entry.Expire, "content", entry.Content)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/transip/gotransip/v6/domain"
+)
+
+func TestEntryLogVerbosity(t *testing.T) {
+	tests := []struct {
+		verbosity   int
+		wantEntries bool
+	}{
+		{verbosity: 0, wantEntries: false},
+		{verbosity: defaultEntryLogVerbosity - 1, wantEntries: false},
+		{verbosity: defaultEntryLogVerbosity, wantEntries: true},
+	}
+
+	for _, tt := range tests {
+		repo := newFakeDNSRepository("example.com",
+			domain.DNSEntry{Name: "www", Expire: 300, Type: "CNAME", Content: "example.com."},
+		)
+		solver, _ := newTestSolver(repo)
+
+		var lines []string
+		solver.log = funcr.New(func(prefix, args string) {
+			lines = append(lines, args)
+		}, funcr.Options{Verbosity: tt.verbosity})
+
+		if err := solver.CleanUp(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		logs := strings.Join(lines, "\n")
+		if got := strings.Contains(logs, `"msg"="DNS entry" "domain"="example.com" "name"="www"`); got != tt.wantEntries {
+			t.Errorf("verbosity %d: entry logged = %v, want %v, logs:\n%s", tt.verbosity, got, tt.wantEntries, logs)
+		}
+		// The operation itself is always logged.
+		if !strings.Contains(logs, `"msg"="cleanup summary"`) {
+			t.Errorf("verbosity %d: expected the cleanup summary to be logged, logs:\n%s", tt.verbosity, logs)
+		}
+	}
+}
+
+func TestChallengeKeyLogVerbosity(t *testing.T) {
+	tests := []struct {
+		verbosity int
+		wantKey   bool
+	}{
+		{verbosity: 0, wantKey: false},
+		{verbosity: challengeContentLogVerbosity - 1, wantKey: false},
+		{verbosity: challengeContentLogVerbosity, wantKey: true},
+	}
+
+	for _, tt := range tests {
+		solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+
+		var lines []string
+		solver.log = funcr.New(func(prefix, args string) {
+			lines = append(lines, args)
+		}, funcr.Options{Verbosity: tt.verbosity})
+
+		if err := solver.Present(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		logs := strings.Join(lines, "\n")
+		if got := strings.Contains(logs, testKey); got != tt.wantKey {
+			t.Errorf("verbosity %d: key logged = %v, want %v, logs:\n%s", tt.verbosity, got, tt.wantKey, logs)
+		}
+		if !strings.Contains(logs, `"msg"="challenge record added"`) {
+			t.Errorf("verbosity %d: expected the added record to be logged, logs:\n%s", tt.verbosity, logs)
+		}
+	}
+}
@@ -1,22 +1,32 @@
 package main
 
 import (
-	"github.com/cert-manager/cert-manager/pkg/issuer/acme/dns/util"
-	"encoding/json"
-	"context"
-	"strings"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
 	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
 
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook/cmd"
+	"github.com/cert-manager/cert-manager/pkg/issuer/acme/dns/util"
 	"github.com/transip/gotransip/v6"
 	"github.com/transip/gotransip/v6/domain"
 	"github.com/transip/gotransip/v6/repository"
@@ -24,25 +34,118 @@ import (
 
 var GroupName = os.Getenv("GROUP_NAME")
 
+// errPaused is returned by Present and CleanUp while the webhook is paused.
+var errPaused = errors.New("the TransIP webhook is paused by " + pausedEnvVar + ": no DNS changes are made, cert-manager will retry the challenge later")
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == testCredentialsCommand {
+		os.Exit(runTestCredentials(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	if GroupName == "" {
 		panic("GROUP_NAME must be specified")
 	}
 
+	solvers, err := newSolvers()
+	if err != nil {
+		panic(err)
+	}
+
 	// This will register our custom DNS provider with the webhook serving
 	// library, making it available as an API under the provided GroupName.
 	// You can register multiple DNS provider implementations with a single
 	// webhook, where the Name() method will be used to disambiguate between
 	// the different implementations.
-	cmd.RunWebhookServer(GroupName,
-		&transipDNSProviderSolver{},
-	)
+	cmd.RunWebhookServer(GroupName, solvers...)
 }
 
 // transipDNSProviderSolver implements the provider-specific logic needed to
 // 'present' an ACME challenge TXT record for the TransIP DNS provider.
 type transipDNSProviderSolver struct {
-	client *kubernetes.Clientset
+	client kubernetes.Interface
+	log    logr.Logger
+
+	// name is the solver name Issuers reference, defaulting to
+	// defaultSolverName.
+	name string
+	// defaultConfig, when set, holds the config fields used for Issuers
+	// that do not set them.
+	defaultConfig json.RawMessage
+	// primary, when set, is the first solver registered by the webhook.
+	// It serves the process-wide endpoints, and its domain locks are used
+	// so that the solvers do not change the same domain concurrently.
+	primary *transipDNSProviderSolver
+
+	// paused makes Present and CleanUp fail with errPaused without
+	// contacting TransIP.
+	paused bool
+	// queue, when set, processes challenges on a bounded pool of workers.
+	queue *workQueue
+	// allowedNamespaces, when set, holds the only resource namespaces whose
+	// challenges are served.
+	allowedNamespaces map[string]bool
+	// entryVerbosity is the verbosity at which individual DNS entries are
+	// logged, when it differs from defaultEntryLogVerbosity.
+	entryVerbosity int
+	// minKeyBits is the smallest accepted RSA private key size, when it
+	// differs from defaultMinRSAKeySize.
+	minKeyBits int
+	// ambientCredentials, when set, are used by Issuers that configure no
+	// credentials of their own.
+	ambientCredentials *ambientCredentials
+
+	// stopCh is closed when the webhook shuts down, cancelling the
+	// challenge operations in progress.
+	stopCh <-chan struct{}
+	// root is the context challenge operations derive from, cancelled
+	// when stopCh is closed; see rootContext.
+	rootOnce sync.Once
+	root     context.Context
+	// ready is set once Initialize has completed, making the readiness
+	// endpoint succeed.
+	ready atomic.Bool
+
+	// repositoryFactory and findZoneByFqdn replace the TransIP API and the
+	// DNS zone lookup when set; they are used by the tests.
+	repositoryFactory func(ch *v1alpha1.ChallengeRequest, cfg *transipDNSProviderConfig) (dnsRepository, error)
+	findZoneByFqdn    func(ctx context.Context, fqdn string, nameservers []string) (string, error)
+	// dohClient replaces http.DefaultClient for DNS-over-HTTPS zone lookups
+	// when set.
+	dohClient *http.Client
+	// lookupCNAME replaces the CNAME lookup of followCNAME when set.
+	lookupCNAME func(ctx context.Context, fqdn string, nameservers []string) (string, error)
+	// newClient replaces gotransip.NewClient when set.
+	newClient func(cfg gotransip.ClientConfiguration) (repository.Client, error)
+	// checkPropagation replaces util.PreCheckDNS when measuring propagation.
+	checkPropagation func(ctx context.Context, fqdn, value string, nameservers []string, useAuthoritative bool) (bool, error)
+	// clock is used to wait between retries, defaulting to the real time.
+	clock clock
+	// randIntn returns a random number in [0, n), defaulting to rand.Intn.
+	randIntn func(n int) int
+	// timeNow returns the current time, defaulting to time.Now.
+	timeNow func() time.Time
+
+	credentialsMu  sync.Mutex
+	credentialDirs map[string]*dirCredentials
+
+	// leases, when set, serializes the changes to each domain across
+	// webhook replicas.
+	leases *leaseLocker
+	// events, when set, records the changes to DNS entries as Kubernetes
+	// Events.
+	events *eventRecorder
+	// operations, when set, bounds the number of domains changed at the
+	// same time.
+	operations *operationLimiter
+
+	clients          clientCache
+	domainLocks      domainLocks
+	domainLists      domainListCache
+	zones            zoneCache
+	cooldowns        domainCooldowns
+	presentedDomains domainSet
+	presents         inflightGroup
+	ttls             presentedTTLs
 }
 
 // transipDNSProviderConfig is a structure that is used to decode into when
@@ -63,7 +166,191 @@ type transipDNSProviderConfig struct {
 	AccountName         string               `json:"accountName"`
 	PrivateKey          []byte               `json:"privateKey"`
 	PrivateKeySecretRef v1.SecretKeySelector `json:"privateKeySecretRef"`
+	PrivateKeyPath      string               `json:"privateKeyPath"`
 	TTL                 int                  `json:"ttl"`
+	// AccountNameSecretRef reads the account name from a Secret in the
+	// namespace of the challenge, taking precedence over AccountName.
+	AccountNameSecretRef v1.SecretKeySelector `json:"accountNameSecretRef"`
+	// Token is a TransIP API access token to authenticate with instead of
+	// a private key, read from TokenSecretRef when not given inline.
+	Token          string               `json:"token"`
+	TokenSecretRef v1.SecretKeySelector `json:"tokenSecretRef"`
+	// Accounts holds the credentials of further TransIP accounts, keyed by
+	// the zone suffix they are authoritative for. Zones matching none of
+	// the suffixes use the credentials above.
+	Accounts map[string]zoneAccount `json:"accounts"`
+	// ReadOnly creates the TransIP client in read-only mode. Challenges
+	// cannot be presented or cleaned up with it; it exists so that the
+	// mode of the client is explicit in the config.
+	ReadOnly bool `json:"readOnly"`
+	// HTTPProxy is the URL of the HTTP(S) proxy to reach the TransIP API
+	// through, instead of the one set in the HTTPS_PROXY environment
+	// variable.
+	HTTPProxy string `json:"httpProxy"`
+	// TestMode uses the TransIP demo account instead of the configured
+	// credentials, and only logs the DNS changes challenges would make.
+	TestMode bool `json:"testMode"`
+	// FollowCNAME presents the challenge record at the target of the CNAME
+	// at its FQDN, for challenge records delegated to another zone.
+	FollowCNAME bool `json:"followCNAME"`
+	// BatchUpdates writes all entries of the domain in a single
+	// ReplaceDNSEntries call when adding or removing a record, instead of
+	// adding or removing the record on its own.
+	BatchUpdates bool `json:"batchUpdates"`
+	// TTLClampMode selects what happens to a TTL that TransIP does not
+	// offer: "reject" (the default) fails the challenge, "clamp" uses the
+	// nearest TTL TransIP offers and "none" sends it as is.
+	TTLClampMode ttlClampMode `json:"ttlClampMode"`
+	// TTLJitter raises the TTL of each challenge record by a random number
+	// of seconds between zero and TTLJitter, so that many records created
+	// together do not expire from caches at the same time.
+	TTLJitter int `json:"ttlJitter"`
+	// ContentPrefix and ContentSuffix are added around the challenge key in
+	// the content of the TXT record, for setups expecting the key to be
+	// wrapped.
+	ContentPrefix string `json:"contentPrefix"`
+	ContentSuffix string `json:"contentSuffix"`
+	// EntryTemplate controls the name and content of the challenge record,
+	// which are the record name and the challenge key by default. The
+	// content prefix and suffix are added around the templated content.
+	EntryTemplate *entryTemplate `json:"entryTemplate"`
+	// Environment is a DNS label appended to the name of the challenge
+	// record, to keep the records of blue/green environments apart.
+	Environment string `json:"environment"`
+	// RecordNameOverride is used as is as the name of the challenge record,
+	// relative to the domain, instead of the name computed from the FQDN of
+	// the challenge, for delegated setups with a validation subdomain.
+	RecordNameOverride string `json:"recordNameOverride"`
+
+	// CredentialsDir points at a directory inside the webhook pod, such as a
+	// projected volume, holding `accountName` and `privateKey` files. When
+	// set, it replaces accountName, privateKey and privateKeySecretRef.
+	CredentialsDir string `json:"credentialsDir"`
+
+	// VerifyTTL re-reads the DNS entries after adding the challenge record
+	// and warns when TransIP did not store the requested TTL.
+	VerifyTTL bool `json:"verifyTTL"`
+
+	// SkipKeyValidation disables the check that the challenge key is a
+	// base64url encoded SHA-256 digest, for uses outside of ACME.
+	SkipKeyValidation bool `json:"skipKeyValidation"`
+
+	// ConvertKeyFormat retries creating the TransIP client once with the
+	// private key converted between PKCS#1 and PKCS#8 when the key is
+	// rejected.
+	ConvertKeyFormat bool `json:"convertKeyFormat"`
+
+	// CheckDomainOwnership verifies that the challenge belongs to a domain
+	// registered under the TransIP account, using the longest matching
+	// domain of the account as the domain to update.
+	CheckDomainOwnership bool `json:"checkDomainOwnership"`
+	// DomainListCacheTTL is how long the domain list of the account is
+	// cached for ownership checks.
+	DomainListCacheTTL *metav1.Duration `json:"domainListCacheTTL"`
+	// ZoneCacheTTL is how long the zone looked up for a challenge FQDN is
+	// reused, defaulting to defaultZoneCacheTTL; zero disables the cache.
+	ZoneCacheTTL *metav1.Duration `json:"zoneCacheTTL"`
+	// ZoneMappings select the TransIP domain for challenges whose FQDN
+	// matches a pattern, evaluated in order before any other detection.
+	ZoneMappings []zoneMapping `json:"zoneMappings"`
+
+	// DNSOverHTTPSResolver is the URL of a DNS-over-HTTPS resolver, such
+	// as https://cloudflare-dns.com/dns-query, used instead of the
+	// recursive nameservers to detect the zone of a challenge.
+	DNSOverHTTPSResolver string `json:"dnsOverHTTPSResolver"`
+	// Nameservers, when set, replace the recursive nameservers used to
+	// detect the zone of a challenge. AlternateNameservers are tried when
+	// the zone cannot be detected through the primary nameservers.
+	Nameservers          []string `json:"nameservers"`
+	AlternateNameservers []string `json:"alternateNameservers"`
+
+	// APITimeout bounds each TransIP API call, including its retries, and
+	// each DNS lookup, defaulting to defaultAPITimeout. RequestTimeout
+	// bounds each attempt of a TransIP API call, defaulting to
+	// defaultRequestTimeout.
+	APITimeout     *metav1.Duration `json:"apiTimeout"`
+	RequestTimeout *metav1.Duration `json:"requestTimeout"`
+
+	// RetryAttempts is the number of attempts of a TransIP API call that
+	// fails transiently, defaulting to defaultRetryAttempts. RetryBaseDelay
+	// is the backoff delay before the first retry, doubling for each retry
+	// after it, defaulting to defaultRetryBaseDelay.
+	RetryAttempts  int              `json:"retryAttempts"`
+	RetryBaseDelay *metav1.Duration `json:"retryBaseDelay"`
+	// RetryJitter selects how the delay between retries of failed TransIP API
+	// calls is randomized: "full" (the default), "equal" or "none".
+	RetryJitter string `json:"retryJitter"`
+
+	// PropagationCheck makes Present wait until the added record is visible
+	// on the nameservers, for at most PropagationCheckTimeout, defaulting
+	// to defaultPropagationCheckTimeout.
+	PropagationCheck        bool             `json:"propagationCheck"`
+	PropagationCheckTimeout *metav1.Duration `json:"propagationCheckTimeout"`
+	// MeasurePropagation times how long added records take to become
+	// visible on the authoritative nameservers, for the
+	// transip_webhook_propagation_seconds histogram.
+	MeasurePropagation bool `json:"measurePropagation"`
+	// PropagationResolvers, when set, are the recursive resolvers queried to
+	// decide that a record is visible, instead of the authoritative
+	// nameservers. At least PropagationQuorum of them, a majority by
+	// default, must return the record.
+	PropagationResolvers []string `json:"propagationResolvers"`
+	PropagationQuorum    int      `json:"propagationQuorum"`
+
+	// CleanupCooldown makes presents in a domain wait for this long after a
+	// record was cleaned up from it, at most maxCleanupCooldown, so that
+	// records are not added and removed in quick succession.
+	CleanupCooldown *metav1.Duration `json:"cleanupCooldown"`
+
+	// CleanupNotFound is the severity of a cleanup that finds no record
+	// matching the challenge: "silent", "warn" (the default) or "error".
+	CleanupNotFound string `json:"cleanupNotFound"`
+
+	// CleanupMarker adds a TXT record named _cleaned.<record name> after
+	// the challenge record is removed, to show that cleanup ran. Markers
+	// older than CleanupMarkerMaxAge are removed by later cleanups of the
+	// domain.
+	CleanupMarker       bool             `json:"cleanupMarker"`
+	CleanupMarkerMaxAge *metav1.Duration `json:"cleanupMarkerMaxAge"`
+
+	// EntryComment, when set, is stored in a TXT record named
+	// _managed.<record name> next to each challenge record, to tell the
+	// records of the webhook from manually created ones.
+	EntryComment string `json:"entryComment"`
+
+	// StrictZoneDetection makes any fallback or ambiguity while computing
+	// the domain and record name of a challenge an error, instead of a
+	// warning after which the challenge proceeds.
+	StrictZoneDetection bool `json:"strictZoneDetection"`
+
+	// InitializeEmptyZone sets the entries of a domain that has none yet,
+	// e.g. one provisioned on the fly, to the challenge record with
+	// ReplaceDNSEntries, instead of adding the record to them.
+	InitializeEmptyZone bool `json:"initializeEmptyZone"`
+
+	// ForceUpdate removes the existing copies of the challenge record and
+	// adds it again on present, instead of leaving an existing record as
+	// it is, to normalize records that were edited by hand.
+	ForceUpdate bool `json:"forceUpdate"`
+
+	// TolerateListForbidden supports keys that may add and remove DNS
+	// entries but not list them: when listing is forbidden, the record is
+	// added or removed without checking the existing entries first.
+	TolerateListForbidden bool `json:"tolerateListForbidden"`
+}
+
+// accountKey identifies the TransIP account the config authenticates as.
+func (cfg *transipDNSProviderConfig) accountKey() string {
+	if cfg.CredentialsDir != "" {
+		return "dir:" + cfg.CredentialsDir
+	}
+	if cfg.AccountNameSecretRef.Name != "" {
+		return "account-secret:" + cfg.AccountNameSecretRef.Name + "/" + cfg.AccountNameSecretRef.Key
+	}
+	if cfg.usesToken() && cfg.AccountName == "" {
+		return cfg.tokenAccountKey()
+	}
+	return cfg.AccountName
 }
 
 // Name is used as the name for this DNS solver when referencing it on the ACME
@@ -73,45 +360,183 @@ type transipDNSProviderConfig struct {
 // within a single webhook deployment**.
 // For example, `cloudflare` may be used as the name of a solver.
 func (c *transipDNSProviderSolver) Name() string {
-	return "transip"
+	if c.name != "" {
+		return c.name
+	}
+	return defaultSolverName
+}
+
+// now returns the current time.
+func (c *transipDNSProviderSolver) now() time.Time {
+	if c.timeNow != nil {
+		return c.timeNow()
+	}
+	return time.Now()
+}
+
+// intn returns a random number in [0, n).
+func (c *transipDNSProviderSolver) intn(n int) int {
+	if c.randIntn != nil {
+		return c.randIntn(n)
+	}
+	return rand.Intn(n)
+}
+
+// logger returns the logger of the solver, defaulting to klog.
+func (c *transipDNSProviderSolver) logger() logr.Logger {
+	if c.log.GetSink() == nil {
+		return klog.Background()
+	}
+	return c.log
 }
 
-func (c *transipDNSProviderSolver) NewTransipClient(ch *v1alpha1.ChallengeRequest, cfg *transipDNSProviderConfig) (*repository.Client, error) {
+func (c *transipDNSProviderSolver) NewTransipClient(ctx context.Context, ch *v1alpha1.ChallengeRequest, cfg *transipDNSProviderConfig) (*repository.Client, error) {
+	if cfg.TestMode {
+		return c.newDemoClient(cfg.HTTPProxy, cfg.requestTimeout())
+	}
+
+	cfg = c.credentialsFor(ch, cfg)
+	if err := c.checkAmbientCredentials(ch, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.checkCredentials(); err != nil {
+		return nil, err
+	}
+	cfg, err := c.resolveAccountName(ctx, ch, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.usesToken() {
+		return c.newTokenClient(ctx, ch, cfg)
+	}
+
+	accountName := cfg.AccountName
 	privateKey := cfg.PrivateKey
+	source := credentialSourceInline
 
-	if len(privateKey) == 0 {
-		secret, err := c.client.CoreV1().Secrets(ch.ResourceNamespace).Get(context.TODO(), cfg.PrivateKeySecretRef.Name, metav1.GetOptions{})
+	if cfg.CredentialsDir != "" {
+		var err error
+		source = credentialSourceFile
+		accountName, privateKey, err = c.dirCredentials(cfg.CredentialsDir).Load()
+		if err != nil {
+			return nil, err
+		}
+	} else if len(privateKey) == 0 && cfg.PrivateKeySecretRef.Name != "" {
+		source = credentialSourceSecret
+		secret, err := c.getSecret(ctx, ch.ResourceNamespace, cfg.PrivateKeySecretRef.Name)
 		if err != nil {
 			return nil, err
 		}
 
-		ok := false
-		privateKey, ok = secret.Data[cfg.PrivateKeySecretRef.Key]
-		if !ok {
-			return nil, fmt.Errorf("no private key for %q in secret '%s/%s'", cfg.PrivateKeySecretRef.Name, cfg.PrivateKeySecretRef.Key, ch.ResourceNamespace)
+		privateKey, err = secretKey(secret, cfg.PrivateKeySecretRef.Key, "private key")
+		if err != nil {
+			return nil, err
+		}
+	} else if len(privateKey) == 0 {
+		var err error
+		source = credentialSourceFile
+		privateKey, err = readPrivateKeyFile(cfg.PrivateKeyPath)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	fmt.Printf("creating SOAP client ...\n")
+	if normalized, changed := normalizePrivateKey(privateKey); changed {
+		c.logger().V(1).Info("trimmed whitespace and line endings around the private key", "account", accountName, "source", source)
+		privateKey = normalized
+	}
+	if err := validatePrivateKey(privateKey); err != nil {
+		return nil, err
+	}
 
-	client, err := gotransip.NewClient(gotransip.ClientConfiguration{
-		AccountName:      cfg.AccountName,
-		PrivateKeyReader: bytes.NewReader(privateKey),
-	})
-	if err != nil {
+	minKeyBits := c.minKeyBits
+	if minKeyBits == 0 {
+		minKeyBits = defaultMinRSAKeySize
+	}
+	if err := checkRSAKeySize(privateKey, minKeyBits); err != nil {
 		return nil, err
 	}
 
-	return &client, nil
+	return c.clients.Get(clientCacheKey(accountName, privateKey, cfg.ReadOnly, cfg.HTTPProxy, cfg.requestTimeout()), func() (repository.Client, error) {
+		// Only the account and where its credentials came from are logged,
+		// never the private key.
+		c.logger().Info("creating TransIP client", "account", accountName, "source", source)
+
+		newClient := gotransip.NewClient
+		if c.newClient != nil {
+			newClient = c.newClient
+		}
+
+		httpClient := c.httpClient(cfg.HTTPProxy, cfg.requestTimeout())
+		client, err := newClient(gotransip.ClientConfiguration{
+			AccountName:      accountName,
+			PrivateKeyReader: bytes.NewReader(privateKey),
+			ReadOnly:         cfg.ReadOnly,
+			HTTPClient:       httpClient,
+		})
+		if err != nil && cfg.ConvertKeyFormat {
+			converted, from, to, convErr := convertPrivateKey(privateKey)
+			if convErr != nil {
+				return client, fmt.Errorf("%v; converting the private key failed: %v", err, convErr)
+			}
+
+			c.logger().Info("the TransIP client rejected the private key, retrying with the key converted", "account", accountName, "from", from, "to", to, "error", err.Error())
+			client, err = newClient(gotransip.ClientConfiguration{
+				AccountName:      accountName,
+				PrivateKeyReader: bytes.NewReader(converted),
+				ReadOnly:         cfg.ReadOnly,
+				HTTPClient:       httpClient,
+			})
+		}
+		if err != nil {
+			return client, err
+		}
+
+		credentialSourceTotal.WithLabelValues(source).Inc()
+
+		return client, nil
+	})
 }
 
-func (c *transipDNSProviderSolver) NewDNSEntryFromChallenge(ch *v1alpha1.ChallengeRequest, cfg *transipDNSProviderConfig, domainName string) domain.DNSEntry {
+// NewDNSEntryFromChallenge returns the challenge record to present in, or
+// clean up from, the domain, applying the entry template of the config.
+func (c *transipDNSProviderSolver) NewDNSEntryFromChallenge(ch *v1alpha1.ChallengeRequest, cfg *transipDNSProviderConfig, domainName string) (domain.DNSEntry, error) {
+	recordName, ok := extractRecordName(ch.ResolvedFQDN, domainName)
+	if !ok && cfg.RecordNameOverride == "" {
+		if cfg.StrictZoneDetection {
+			return domain.DNSEntry{}, fmt.Errorf("strict zone detection: %s is not within domain %s", ch.ResolvedFQDN, domainName)
+		}
+		c.logger().Info("WARNING: challenge FQDN is not within the domain, using the full name as the record name", "fqdn", ch.ResolvedFQDN, "domain", domainName)
+	}
+
+	name, content, err := cfg.EntryTemplate.render(ch, recordName, domainName)
+	if err != nil {
+		return domain.DNSEntry{}, err
+	}
+
+	// TransIP names the record of the domain itself @.
+	if name == "" {
+		name = "@"
+	}
+	name = withEnvironment(name, cfg.Environment)
+	if cfg.RecordNameOverride != "" {
+		name = cfg.RecordNameOverride
+	}
+	if err := validateRecordName(name); err != nil {
+		return domain.DNSEntry{}, err
+	}
+
+	content = cfg.ContentPrefix + content + cfg.ContentSuffix
+	if err := validateTXTContent(content); err != nil {
+		return domain.DNSEntry{}, err
+	}
+
 	return domain.DNSEntry{
-		Name:    extractRecordName(ch.ResolvedFQDN, domainName),
+		Name:    name,
 		Expire:  cfg.TTL,
 		Type:    "TXT",
-		Content: ch.Key,
-	}
+		Content: content,
+	}, nil
 }
 
 // Present is responsible for actually presenting the DNS record with the
@@ -120,47 +545,198 @@ func (c *transipDNSProviderSolver) NewDNSEntryFromChallenge(ch *v1alpha1.Challen
 // cert-manager itself will later perform a self check to ensure that the
 // solver has correctly configured the DNS provider.
 func (c *transipDNSProviderSolver) Present(ch *v1alpha1.ChallengeRequest) error {
-	domainName := extractDomainName(ch.ResolvedZone)
-	cfg, err := loadConfig(ch.Config)
+	if c.paused {
+		return errPaused
+	}
+	if err := c.checkAllowedNamespace(ch); err != nil {
+		return err
+	}
+
+	// cert-manager may present the same challenge several times at once;
+	// identical presents in flight share a single run.
+	start := c.now()
+	shared, err := c.presents.Do(presentKey(ch), func() error {
+		return c.run(ch, c.present)
+	})
+	if shared {
+		c.logger().V(1).Info("shared the result of an identical present in flight", "fqdn", ch.ResolvedFQDN)
+	}
+	c.observeOperation(operationPresent, presentTotal, start, err)
+
+	return err
+}
+
+func (c *transipDNSProviderSolver) present(ctx context.Context, ch *v1alpha1.ChallengeRequest) error {
+	cfg, err := c.loadConfig(ch)
 	if err != nil {
-		fmt.Printf("Error while loading config: %s\n", err)
+		c.logger().Error(err, "could not load the solver config", "fqdn", ch.ResolvedFQDN)
 		return err
 	}
+	if ch.Config != nil {
+		c.checkMisplacedSolverFields(ch.Config.Raw, GroupName)
+	}
 
-	client, err := c.NewTransipClient(ch, cfg)
+	if err := cfg.checkWritable(); err != nil {
+		return err
+	}
+
+	if !cfg.SkipKeyValidation {
+		if err := validateChallengeKey(ch.Key); err != nil {
+			c.logger().Error(err, "invalid challenge", "fqdn", ch.ResolvedFQDN)
+			return err
+		}
+	}
+
+	if cfg.FollowCNAME {
+		followed, err := c.followCNAME(ctx, ch, cfg)
+		if err != nil {
+			c.logger().Error(err, "could not follow the CNAME of the challenge record", "fqdn", ch.ResolvedFQDN)
+			return err
+		}
+		ch = followed
+	}
+
+	domainRepo, err := c.newDNSRepository(ctx, ch, cfg)
 	if err != nil {
-		fmt.Printf("Error while creating SOAP client: %s\n", err)
+		c.logger().Error(err, "could not create the TransIP client", "fqdn", ch.ResolvedFQDN)
 		return err
 	}
 
-	fmt.Printf("presenting record for %s (%s)\n", ch.ResolvedFQDN, domainName)
+	domainName, err := c.resolveDomainName(ctx, ch, cfg, domainRepo)
+	if err != nil {
+		c.logger().Error(err, "could not resolve the TransIP domain", "fqdn", ch.ResolvedFQDN)
+		return err
+	}
 
-	domainRepo := domain.Repository{Client: *client}
-	dnsEntries, err := domainRepo.GetDNSEntries(domainName)
+	acmeDnsEntry, err := c.NewDNSEntryFromChallenge(ch, cfg, domainName)
 	if err != nil {
-		fmt.Printf("Error while getting domain info for %s: %s\n", domainName, err)
+		c.logger().Error(err, "could not build the challenge record", "fqdn", ch.ResolvedFQDN, "domain", domainName)
 		return err
 	}
+	acmeDnsEntry.Expire = jitteredTTL(acmeDnsEntry.Expire, cfg.TTLJitter, c.intn)
 
-	acmeDnsEntry := c.NewDNSEntryFromChallenge(ch, cfg, domainName)
+	c.logger().Info("presenting challenge record", "fqdn", ch.ResolvedFQDN, "domain", domainName, "name", acmeDnsEntry.Name)
+	c.logChallengeEntry(domainName, acmeDnsEntry)
+
+	cooldownCtx, cancel := context.WithTimeout(ctx, maxCleanupCooldown)
+	defer cancel()
+	if err := c.waitCooldown(cooldownCtx, domainName); err != nil {
+		return err
+	}
+
+	unlockDomain, err := c.lockDomain(ctx, domainName)
+	if err != nil {
+		return err
+	}
+	unlock := sync.OnceFunc(unlockDomain)
+	defer unlock()
+
+	listed := true
+	dnsEntries, err := domainRepo.GetDNSEntries(domainName)
+	if err != nil {
+		if !cfg.TolerateListForbidden || !isForbidden(err) {
+			err = describeDomainError(err, domainName, c.credentialsFor(ch, cfg).accountKey())
+			c.logger().Error(err, "could not list the DNS entries", "domain", domainName)
+			return err
+		}
+
+		c.logger().Info("listing DNS entries is forbidden, adding the record without checking for an existing one", "domain", domainName)
+		listed = false
+	}
+	c.logEntries(domainName, dnsEntries)
+
+	if cfg.ForceUpdate {
+		dnsEntries, err = c.removeExistingRecord(domainRepo, cfg, domainName, dnsEntries, acmeDnsEntry)
+		if err != nil {
+			return err
+		}
+	}
 
 	// This method should tolerate being called multiple times
 	// with the same value. If a TXT record for this request
-	// already exists, we'll simply exit.
+	// already exists, we'll simply exit, after correcting its TTL when it
+	// differs from the configured one. The live entries are the only
+	// state consulted, so this also holds across webhook restarts.
 	for _, s := range dnsEntries {
-		if s == acmeDnsEntry {
-			fmt.Printf("ACME DNS entry already exists, skip\n")
-			return nil
+		if !sameRecord(s, acmeDnsEntry) {
+			continue
+		}
+
+		if !acceptedTTL(s.Expire, cfg) {
+			c.logger().Info("updating the TTL of the existing challenge record", "domain", domainName, "name", acmeDnsEntry.Name, "existingTTL", s.Expire, "ttl", acmeDnsEntry.Expire)
+			if err := replaceEntry(domainRepo, domainName, dnsEntries, s, acmeDnsEntry, cfg.BatchUpdates); err != nil {
+				c.logger().Error(err, "could not update the TTL of the challenge record", "domain", domainName, "name", acmeDnsEntry.Name)
+				return err
+			}
+			if cfg.TestMode {
+				return nil
+			}
+			c.ttls.Record(domainName, acmeDnsEntry)
+			c.audit(ctx, ch, cfg, auditUpdated, domainName, acmeDnsEntry)
+		} else {
+			c.logger().Info("challenge record already exists", "domain", domainName, "name", acmeDnsEntry.Name)
+			c.ttls.Record(domainName, s)
 		}
+		c.recordPresentedDomain(domainName)
+		return nil
+	}
+
+	// Jittered TTLs differ on purpose.
+	if cfg.TTLJitter == 0 {
+		c.warnConflictingTTLs(domainName, acmeDnsEntry, dnsEntries)
 	}
 
-	err = domainRepo.AddDNSEntry(domainName, acmeDnsEntry)
+	batch := cfg.BatchUpdates
+	if cfg.InitializeEmptyZone && listed && len(dnsEntries) == 0 {
+		c.logger().Info("the domain has no DNS entries yet, initializing them with the challenge record", "domain", domainName)
+		batch = true
+	}
+
+	err = addEntry(domainRepo, domainName, dnsEntries, acmeDnsEntry, batch)
 	if err != nil {
-		fmt.Printf("Error while setting DNS entries for domain %s: %s\n", domainName, err)
+		// Without the list of entries, an existing record is only noticed
+		// when TransIP refuses to add it again. The same goes for a record
+		// added since the entries were listed, e.g. from another replica
+		// without leases.
+		if isConflict(err) {
+			c.logger().Info("DNS entry already exists", "domain", domainName, "name", acmeDnsEntry.Name)
+			c.recordPresentedDomain(domainName)
+			return nil
+		}
+
+		c.logger().Error(err, "could not add the challenge record", "domain", domainName, "name", acmeDnsEntry.Name)
 		return err
 	}
 
-	fmt.Printf("new record has been set %v", acmeDnsEntry)
+	// In test mode the record was not added, so there is nothing to
+	// record, comment on, verify or wait for.
+	if cfg.TestMode {
+		return nil
+	}
+
+	c.logger().Info("challenge record added", "domain", domainName, "name", acmeDnsEntry.Name, "ttl", acmeDnsEntry.Expire)
+	c.recordPresentedDomain(domainName)
+	c.ttls.Record(domainName, acmeDnsEntry)
+	c.audit(ctx, ch, cfg, auditCreated, domainName, acmeDnsEntry)
+
+	if cfg.EntryComment != "" {
+		c.addEntryComment(domainRepo, cfg, ch, domainName, acmeDnsEntry)
+	}
+
+	if cfg.MeasurePropagation {
+		go c.measurePropagation(recordFQDN(acmeDnsEntry.Name, domainName), acmeDnsEntry.Content, cfg, c.now())
+	}
+
+	if cfg.VerifyTTL && listed {
+		c.verifyStoredTTL(domainRepo, domainName, acmeDnsEntry)
+	}
+
+	if cfg.PropagationCheck {
+		// Other challenges for the domain need not wait for this one
+		// to propagate.
+		unlock()
+		c.waitForPropagation(ctx, recordFQDN(acmeDnsEntry.Name, domainName), acmeDnsEntry.Content, cfg)
+	}
 
 	return nil
 }
@@ -172,50 +748,162 @@ func (c *transipDNSProviderSolver) Present(ch *v1alpha1.ChallengeRequest) error
 // This is in order to facilitate multiple DNS validations for the same domain
 // concurrently.
 func (c *transipDNSProviderSolver) CleanUp(ch *v1alpha1.ChallengeRequest) error {
-	domainName := extractDomainName(ch.ResolvedZone)
+	if c.paused {
+		return errPaused
+	}
+	if err := c.checkAllowedNamespace(ch); err != nil {
+		return err
+	}
 
-	cfg, err := loadConfig(ch.Config)
+	start := c.now()
+	err := c.run(ch, c.cleanUp)
+	c.observeOperation(operationCleanUp, cleanUpTotal, start, err)
+
+	return err
+}
+
+func (c *transipDNSProviderSolver) cleanUp(ctx context.Context, ch *v1alpha1.ChallengeRequest) error {
+	cfg, err := c.loadConfig(ch)
+	if err != nil {
+		return err
+	}
+	if err := cfg.checkWritable(); err != nil {
+		return err
+	}
+
+	if cfg.FollowCNAME {
+		followed, err := c.followCNAME(ctx, ch, cfg)
+		if err != nil {
+			return err
+		}
+		ch = followed
+	}
+
+	domainRepo, err := c.newDNSRepository(ctx, ch, cfg)
 	if err != nil {
 		return err
 	}
 
-	client, err := c.NewTransipClient(ch, cfg)
+	domainName, err := c.resolveDomainName(ctx, ch, cfg, domainRepo)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("cleaning up record for %s (%s)", ch.ResolvedFQDN, domainName)
+	c.logger().Info("cleaning up challenge record", "fqdn", ch.ResolvedFQDN, "domain", domainName)
 
-	domainRepo := domain.Repository{Client: *client}
-	dnsEntries, err := domainRepo.GetDNSEntries(domainName)
+	// Concurrent cleanups of the same record are serialized by the domain
+	// lock: the first removes the record, the others no longer find it in
+	// the re-read entries and succeed without removing anything.
+	unlock, err := c.lockDomain(ctx, domainName)
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	acmeDnsEntry := c.NewDNSEntryFromChallenge(ch, cfg, domainName)
+	acmeDnsEntry, err := c.NewDNSEntryFromChallenge(ch, cfg, domainName)
+	if err != nil {
+		return err
+	}
+
+	dnsEntries, err := domainRepo.GetDNSEntries(domainName)
+	if err != nil {
+		if !cfg.TolerateListForbidden || !isForbidden(err) {
+			return describeDomainError(err, domainName, c.credentialsFor(ch, cfg).accountKey())
+		}
+
+		c.logger().Info("listing DNS entries is forbidden, removing the record without checking for it first", "domain", domainName)
+		return c.removeUnlistedEntry(ctx, ch, domainRepo, cfg, domainName, acmeDnsEntry)
+	}
+	c.logEntries(domainName, dnsEntries)
 
 	// If multiple TXT records exist with the same record name (e.g.
 	// _acme-challenge.example.com) then **only** the record with the same `key`
-	// value provided on the ChallengeRequest should be cleaned up.
+	// value provided on the ChallengeRequest should be cleaned up, whatever
+	// its TTL.
+	// Duplicates of the record, e.g. left behind by an earlier run, are
+	// removed along with it.
+	var summary cleanupSummary
+	var removed []int
+	for i, s := range dnsEntries {
+		switch {
+		case !sameRecordName(s.Name, acmeDnsEntry.Name) || s.Type != "TXT":
+			continue
+		case !matchesChallenge(s, acmeDnsEntry):
+			// Other challenges for the same name, or TXT records created
+			// by hand, are never removed.
+			c.logger().Info("keeping a TXT record with the same name that does not match the challenge", "domain", domainName, "name", s.Name, "ttl", s.Expire)
+			summary.Skipped++
+		default:
+			removed = append(removed, i)
+		}
+	}
 
-	for _, s := range dnsEntries {
-		if s == acmeDnsEntry {
-			fmt.Printf("deleting dns record %v", s)
+	for _, i := range removed {
+		// The stored entry is removed, as its TTL may have been jittered or
+		// normalized by TransIP.
+		c.logger().Info("removing challenge record", "domain", domainName, "name", dnsEntries[i].Name, "ttl", dnsEntries[i].Expire)
+		c.logChallengeEntry(domainName, dnsEntries[i])
+	}
+	if len(removed) > 0 {
+		done, err := removeEntries(domainRepo, domainName, dnsEntries, removed, acmeDnsEntry, cfg.BatchUpdates)
+		for _, e := range done {
+			c.audit(ctx, ch, cfg, auditRemoved, domainName, e)
+		}
+		summary.Removed = len(done)
+		if err != nil {
+			c.logger().Error(err, "could not remove the challenge record", "domain", domainName, "name", acmeDnsEntry.Name)
+			return err
+		}
+		// Records TransIP could no longer find are absent, which is what
+		// the cleanup is after.
+		summary.Gone = len(removed) - summary.Removed
+		if summary.Gone > 0 {
+			c.logger().Info("the challenge record was already removed, probably by a concurrent cleanup", "domain", domainName, "name", acmeDnsEntry.Name)
+		}
+	}
 
-			err = domainRepo.RemoveDNSEntry(domainName, acmeDnsEntry)
-			if err != nil {
-				return err
-			}
+	summary.log(c.logger(), domainName, acmeDnsEntry.Name)
+	// In test mode nothing was removed, and the record was never added.
+	if cfg.TestMode {
+		return nil
+	}
+	c.ttls.Forget(domainName, acmeDnsEntry)
 
-			return nil
-		}
+	if cfg.EntryComment != "" {
+		c.removeEntryComment(domainRepo, cfg, ch, domainName, acmeDnsEntry)
+	}
+
+	if summary.notFound() {
+		return c.reportNotFound(cfg, domainName, acmeDnsEntry)
 	}
 
-	fmt.Printf("did not find a dns record matching %v", acmeDnsEntry)
+	if cfg.CleanupCooldown != nil && summary.Removed > 0 {
+		c.cooldowns.Start(domainName, c.now().Add(cfg.CleanupCooldown.Duration))
+	}
+
+	if cfg.CleanupMarker && summary.Removed > 0 {
+		c.markCleanedUp(domainRepo, cfg, ch, domainName, acmeDnsEntry, dnsEntries)
+	}
 
 	return nil
 }
 
+// run performs op for the challenge. When a work queue is configured, op is
+// queued on the worker responsible for the challenge's zone and run blocks
+// until it has completed.
+func (c *transipDNSProviderSolver) run(ch *v1alpha1.ChallengeRequest, op func(context.Context, *v1alpha1.ChallengeRequest) error) error {
+	ctx, cancel := c.newContext()
+	defer cancel()
+
+	if c.queue == nil {
+		return op(ctx, ch)
+	}
+
+	return c.queue.Do(ch.ResolvedZone, func() error {
+		return op(ctx, ch)
+	})
+}
+
 // Initialize will be called when the webhook first starts.
 // This method can be used to instantiate the webhook, i.e. initialising
 // connections or warming up caches.
@@ -232,8 +920,184 @@ func (c *transipDNSProviderSolver) Initialize(kubeClientConfig *rest.Config, sto
 	}
 
 	c.client = cl
+	c.stopCh = stopCh
+	c.rootContext()
 
 	///// END OF CODE TO MAKE KUBERNETES CLIENTSET AVAILABLE
+
+	// The endpoints are served once per process, by the first solver.
+	if c.primary == nil {
+		c.startHealthServer(stopCh)
+	}
+
+	c.logServingInfo(GroupName)
+
+	c.paused, err = envBool(pausedEnvVar)
+	if err != nil {
+		return err
+	}
+	if c.paused {
+		c.logger().Info("webhook is paused, challenges will be rejected until " + pausedEnvVar + " is unset")
+	}
+
+	if namespaces := envList(allowedNamespacesEnvVar); namespaces != nil {
+		c.allowedNamespaces = map[string]bool{}
+		for _, namespace := range namespaces {
+			c.allowedNamespaces[namespace] = true
+		}
+		c.logger().Info("only serving challenges for allowed namespaces", "namespaces", namespaces)
+	}
+
+	c.entryVerbosity, err = envInt(entryLogVerbosityEnvVar)
+	if err != nil {
+		return err
+	}
+
+	if namespace := os.Getenv(leaseNamespaceEnvVar); namespace != "" {
+		identity, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+
+		c.leases = &leaseLocker{
+			client:    cl,
+			namespace: namespace,
+			identity:  identity,
+			clock:     c.clock,
+			now:       c.now,
+			log:       c.logger(),
+		}
+		if c.leases.clock == nil {
+			c.leases.clock = realClock{}
+		}
+		c.logger().Info("serializing domain changes across replicas with leases", "namespace", namespace, "identity", identity)
+	}
+
+	// An invalid default TTL, or one TransIP does not accept, would only
+	// fail the challenges of Issuers without a ttl, so it is reported when
+	// the webhook starts.
+	if _, err := configuredDefaultTTL(); err != nil {
+		return err
+	}
+
+	auditEvents, err := envBool(auditEventsEnvVar)
+	if err != nil {
+		return err
+	}
+	if auditEvents {
+		pod, namespace := os.Getenv(podNameEnvVar), os.Getenv(podNamespaceEnvVar)
+		if pod == "" || namespace == "" {
+			return fmt.Errorf("%s requires %s and %s to be set", auditEventsEnvVar, podNameEnvVar, podNamespaceEnvVar)
+		}
+
+		c.events = &eventRecorder{client: cl, namespace: namespace, pod: pod, log: c.logger()}
+		c.logger().Info("recording changes to DNS entries as events", "namespace", namespace, "pod", pod)
+	}
+
+	workers, err := envInt(workersEnvVar)
+	if err != nil {
+		return err
+	}
+	if workers > 0 {
+		c.queue = newWorkQueue(workers, workQueueDepth, stopCh)
+	}
+
+	maxOperations, err := envInt(maxConcurrentOperationsEnvVar)
+	if err != nil {
+		return err
+	}
+	if maxOperations == 0 {
+		maxOperations = defaultMaxConcurrentOperations
+	}
+	c.operations = newOperationLimiter(maxOperations)
+
+	c.minKeyBits, err = envInt(minRSAKeySizeEnvVar)
+	if err != nil {
+		return err
+	}
+
+	c.ambientCredentials, err = loadAmbientCredentials()
+	if err != nil {
+		return err
+	}
+	if c.ambientCredentials != nil {
+		c.logger().Info("Issuers without credentials use the ambient TransIP credentials", "account", c.ambientCredentials.accountName)
+	}
+
+	if c.primary == nil {
+		if err := c.serveEndpoints(stopCh); err != nil {
+			return err
+		}
+	}
+
+	c.ready.Store(true)
+
+	return nil
+}
+
+// startHealthServer starts the health server on the configured address.
+// Probes pointing at a health server that failed to start fail as well,
+// which makes the failure visible without stopping the webhook here.
+func (c *transipDNSProviderSolver) startHealthServer(stopCh <-chan struct{}) {
+	healthAddr := os.Getenv(healthAddressEnvVar)
+	if healthAddr == "" {
+		healthAddr = defaultHealthAddress
+	}
+	if addr, err := startHealthServer(healthAddr, &c.ready, stopCh, c.logger()); err != nil {
+		c.logger().Error(err, "could not start the health server, serving challenges without it", "address", healthAddr)
+	} else {
+		c.logger().Info("serving health endpoints", "address", addr.String())
+	}
+}
+
+// serveEndpoints checks the credentials the webhook is deployed with and
+// starts the metrics and debug servers, which are shared by all solvers of
+// the process.
+func (c *transipDNSProviderSolver) serveEndpoints(stopCh <-chan struct{}) error {
+	// Only credentials the webhook is deployed with can be checked here;
+	// those of Issuers are read from their Secrets per challenge. A failed
+	// check is not fatal, as Issuers with other credentials still work.
+	if dir := os.Getenv(checkCredentialsDirEnvVar); dir != "" {
+		if err := c.checkStartupCredentials(dir); err != nil {
+			c.logger().Error(err, "checking the TransIP credentials failed, challenges using them will fail", "credentialsDir", dir)
+		}
+	}
+
+	metricsAddr := os.Getenv(metricsAddressEnvVar)
+	if metricsAddr == "" {
+		metricsAddr = defaultMetricsAddress
+	}
+	// Like the debug endpoints, the metrics are not needed to serve
+	// challenges, so failing to serve them is not fatal.
+	if addr, err := startMetricsServer(metricsAddr, stopCh, c.logger()); err != nil {
+		c.logger().Error(err, "could not start the metrics server, serving challenges without it", "address", metricsAddr)
+	} else {
+		c.logger().Info("serving metrics", "address", addr.String())
+	}
+
+	pprofPort, err := envInt(pprofPortEnvVar)
+	if err != nil {
+		return err
+	}
+	if pprofPort > 0 {
+		required, err := envBool(debugRequiredEnvVar)
+		if err != nil {
+			return err
+		}
+
+		// The debug endpoints are not needed to serve challenges, so they
+		// cannot take the webhook down unless configured otherwise.
+		addr, err := startDebugServer(net.JoinHostPort(debugHost, strconv.Itoa(pprofPort)), stopCh, c.logger())
+		switch {
+		case err != nil && required:
+			return fmt.Errorf("starting debug server: %w", err)
+		case err != nil:
+			c.logger().Error(err, "could not start the debug server, serving challenges without it", "port", pprofPort)
+		default:
+			c.logger().Info("serving pprof and the effective config endpoint", "address", addr.String())
+		}
+	}
+
 	return nil
 }
 
@@ -241,29 +1105,148 @@ func (c *transipDNSProviderSolver) Initialize(kubeClientConfig *rest.Config, sto
 // the typed config struct.
 func loadConfig(cfgJSON *extapi.JSON) (*transipDNSProviderConfig, error) {
 	cfg := transipDNSProviderConfig{}
-	// handle the 'base case' where no configuration has been provided
-	if cfgJSON == nil {
-		return &cfg, nil
+	// Without a config block there are no credentials to use; an empty
+	// object is decoded as usual and its missing fields reported later.
+	if cfgJSON == nil || len(bytes.TrimSpace(cfgJSON.Raw)) == 0 || string(bytes.TrimSpace(cfgJSON.Raw)) == "null" {
+		return &cfg, errNoConfig
 	}
 	if err := json.Unmarshal(cfgJSON.Raw, &cfg); err != nil {
-		return &cfg, fmt.Errorf("error decoding solver config: %v", err)
+		return &cfg, fmt.Errorf("error decoding solver config: %v", describeJSONError(cfgJSON.Raw, err))
+	}
+
+	if cfg.TTL <= 0 {
+		ttl, err := configuredDefaultTTL()
+		if err != nil {
+			return &cfg, err
+		}
+		klog.Background().V(1).Info("no positive ttl configured, using the default", "ttl", cfg.TTL, "default", ttl)
+		cfg.TTL = ttl
+	}
+	ttl, err := validateTTL(cfg.TTL, cfg.TTLClampMode)
+	if err != nil {
+		return &cfg, err
+	}
+	cfg.TTL = ttl
+
+	if err := cfg.compileZoneMappings(); err != nil {
+		return &cfg, err
+	}
+	if err := cfg.compileEntryTemplate(); err != nil {
+		return &cfg, err
+	}
+	if err := validateEnvironment(cfg.Environment); err != nil {
+		return &cfg, err
+	}
+	if cfg.RecordNameOverride != "" {
+		if err := validateRecordName(cfg.RecordNameOverride); err != nil {
+			return &cfg, fmt.Errorf("recordNameOverride: %w", err)
+		}
+	}
+	if err := cfg.validateAccounts(); err != nil {
+		return &cfg, err
+	}
+
+	if err := validateHTTPProxy(cfg.HTTPProxy); err != nil {
+		return &cfg, err
+	}
+
+	if cfg.DNSOverHTTPSResolver != "" && !strings.HasPrefix(cfg.DNSOverHTTPSResolver, "https://") {
+		return &cfg, fmt.Errorf("dnsOverHTTPSResolver must be an https:// URL, got %q", cfg.DNSOverHTTPSResolver)
+	}
+
+	if cfg.Nameservers, err = normalizeNameservers("nameservers", cfg.Nameservers); err != nil {
+		return &cfg, err
+	}
+	if cfg.AlternateNameservers, err = normalizeNameservers("alternateNameservers", cfg.AlternateNameservers); err != nil {
+		return &cfg, err
+	}
+	if cfg.DNSOverHTTPSResolver != "" && len(cfg.Nameservers) > 0 {
+		return &cfg, errors.New("dnsOverHTTPSResolver and nameservers cannot both be set")
+	}
+
+	if cfg.ZoneCacheTTL != nil && (cfg.ZoneCacheTTL.Duration < 0 || cfg.ZoneCacheTTL.Duration > maxZoneCacheTTL) {
+		return &cfg, fmt.Errorf("zoneCacheTTL must be between 0 and %v, got %v", maxZoneCacheTTL, cfg.ZoneCacheTTL.Duration)
+	}
+	if cfg.PropagationCheckTimeout != nil && cfg.PropagationCheckTimeout.Duration <= 0 {
+		return &cfg, fmt.Errorf("propagationCheckTimeout must be positive, got %v", cfg.PropagationCheckTimeout.Duration)
+	}
+	if cfg.PropagationQuorum < 0 || cfg.PropagationQuorum > len(cfg.PropagationResolvers) {
+		return &cfg, fmt.Errorf("propagationQuorum must be between 0 and the number of propagationResolvers (%d), got %d", len(cfg.PropagationResolvers), cfg.PropagationQuorum)
+	}
+
+	if _, err := parseNotFoundSeverity(cfg.CleanupNotFound); err != nil {
+		return &cfg, err
+	}
+
+	if cfg.CleanupCooldown != nil && (cfg.CleanupCooldown.Duration < 0 || cfg.CleanupCooldown.Duration > maxCleanupCooldown) {
+		return &cfg, fmt.Errorf("cleanupCooldown must be between 0 and %v, got %v", maxCleanupCooldown, cfg.CleanupCooldown.Duration)
+	}
+
+	if cfg.RetryAttempts < 0 {
+		return &cfg, fmt.Errorf("retryAttempts must not be negative, got %d", cfg.RetryAttempts)
+	}
+	if cfg.RetryBaseDelay != nil && cfg.RetryBaseDelay.Duration <= 0 {
+		return &cfg, fmt.Errorf("retryBaseDelay must be positive, got %v", cfg.RetryBaseDelay.Duration)
+	}
+
+	if cfg.APITimeout != nil && cfg.APITimeout.Duration <= 0 {
+		return &cfg, fmt.Errorf("apiTimeout must be positive, got %v", cfg.APITimeout.Duration)
+	}
+	if cfg.RequestTimeout != nil && cfg.RequestTimeout.Duration <= 0 {
+		return &cfg, fmt.Errorf("requestTimeout must be positive, got %v", cfg.RequestTimeout.Duration)
+	}
+
+	if cfg.TTLJitter < 0 {
+		return &cfg, fmt.Errorf("ttlJitter must not be negative, got %d", cfg.TTLJitter)
+	}
+	// Removing a record that cannot be listed requires knowing its exact
+	// TTL, which jitter makes unpredictable.
+	if cfg.TTLJitter > 0 && cfg.TolerateListForbidden {
+		return &cfg, errors.New("ttlJitter cannot be combined with tolerateListForbidden")
+	}
+	// Replacing the entries of a domain requires knowing all of them.
+	if cfg.BatchUpdates && cfg.TolerateListForbidden {
+		return &cfg, errors.New("batchUpdates cannot be combined with tolerateListForbidden")
+	}
+
+	if cfg.EntryComment != "" {
+		if err := validateEntryComment(cfg.EntryComment); err != nil {
+			return &cfg, err
+		}
 	}
 
 	return &cfg, nil
 }
 
-func extractRecordName(fqdn, domain string) string {
-	if idx := strings.Index(fqdn, "."+domain); idx != -1 {
-		return fqdn[:idx]
+// extractRecordName returns the name of fqdn relative to domain, or @ when
+// fqdn is the domain itself. Both are compared in lower case and without
+// trailing dots, as DNS names are case-insensitive. When fqdn is not within
+// domain, it falls back to fqdn, normalized the same way, and reports false.
+func extractRecordName(fqdn, domain string) (string, bool) {
+	fqdn = normalizeZone(fqdn)
+	domain = normalizeZone(domain)
+
+	switch {
+	case fqdn == domain:
+		return "@", true
+	case strings.HasSuffix(fqdn, "."+domain):
+		return strings.TrimSuffix(fqdn, "."+domain), true
+	default:
+		return fqdn, false
 	}
-	return util.UnFqdn(fqdn)
 }
 
-func extractDomainName(zone string) string {
-	authZone, err := util.FindZoneByFqdn(context.TODO(), zone, util.RecursiveNameservers)
+// extractDomainName returns the zone containing zone according to DNS. When
+// it cannot be found, zone is returned together with the error.
+func (c *transipDNSProviderSolver) extractDomainName(ctx context.Context, zone string, nameservers []string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	authZone, err := c.findZone(ctx, zone, nameservers)
 	if err != nil {
-		fmt.Printf("could not get zone by fqdn %v", err)
-		return zone
+		// TransIP does not accept the trailing dot of the zone as part of
+		// a domain name.
+		return util.UnFqdn(zone), fmt.Errorf("could not get zone by fqdn: %w", err)
 	}
-	return util.UnFqdn(authZone)
+	return util.UnFqdn(authZone), nil
 }
@@ -4,9 +4,7 @@ import (
 	"os"
 	"testing"
 
-	"github.com/jetstack/cert-manager/test/acme/dns"
-
-	"github.com/quanbylab/cert-manager-webhook-transip"
+	acme "github.com/cert-manager/cert-manager/test/acme"
 )
 
 var (
@@ -19,11 +17,10 @@ func TestRunsSuite(t *testing.T) {
 	// ChallengeRequest passed as part of the test cases.
 	//
 
-	fixture := dns.NewFixture(&transipDNSProviderSolver{},
-		dns.SetResolvedZone(zone),
-		dns.SetAllowAmbientCredentials(false),
-		dns.SetManifestPath("testdata/transip"),
-		dns.SetBinariesPath("bin"),
+	fixture := acme.NewFixture(&transipDNSProviderSolver{},
+		acme.SetResolvedZone(zone),
+		acme.SetAllowAmbientCredentials(false),
+		acme.SetManifestPath("testdata/transip"),
 	)
 	//need to uncomment and  RunConformance delete runBasic and runExtended once https://github.com/jetstack/cert-manager/pull/4835 is merged
 	//fixture.RunConformance(t)
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6/domain"
+)
+
+// cleanupMarkerPrefix is prepended to the name of a challenge record to name
+// the TXT record marking that it was cleaned up.
+const cleanupMarkerPrefix = "_cleaned."
+
+// cleanupMarkerTTL is the TTL of cleanup markers, in seconds.
+const cleanupMarkerTTL = 60
+
+// defaultCleanupMarkerMaxAge is how long cleanup markers are kept before a
+// later cleanup of the same domain removes them.
+const defaultCleanupMarkerMaxAge = time.Hour
+
+// challengeIDLength is the number of hex digits of a challenge ID.
+const challengeIDLength = 12
+
+// challengeID returns a short identifier of the challenge: the start of the
+// SHA-256 digest of its FQDN and key. cert-manager does not set the UID of
+// the ChallengeRequests of DNS-01 webhooks, and the digest identifies the
+// challenge without revealing its key.
+func challengeID(ch *v1alpha1.ChallengeRequest) string {
+	digest := sha256.Sum256([]byte(ch.ResolvedFQDN + " " + ch.Key))
+	return hex.EncodeToString(digest[:])[:challengeIDLength]
+}
+
+// newCleanupMarker returns the marker recording that the challenge record
+// entry was removed at now. Its content holds the removal time, as a Unix
+// timestamp, and the challengeID of the challenge. The marker of an apex
+// record is named _cleaned.
+func newCleanupMarker(ch *v1alpha1.ChallengeRequest, entry domain.DNSEntry, now time.Time) domain.DNSEntry {
+	name := cleanupMarkerPrefix + entry.Name
+	if sameRecordName(entry.Name, "@") {
+		name = strings.TrimSuffix(cleanupMarkerPrefix, ".")
+	}
+
+	return domain.DNSEntry{
+		Name:    name,
+		Expire:  cleanupMarkerTTL,
+		Type:    "TXT",
+		Content: fmt.Sprintf("cleaned %d %s", now.Unix(), challengeID(ch)),
+	}
+}
+
+// cleanupMarkerTime returns the removal time recorded by the cleanup marker e,
+// or false when e is not a cleanup marker.
+func cleanupMarkerTime(e domain.DNSEntry) (time.Time, bool) {
+	isMarker := strings.HasPrefix(e.Name, cleanupMarkerPrefix) || e.Name == strings.TrimSuffix(cleanupMarkerPrefix, ".")
+	if e.Type != "TXT" || !isMarker {
+		return time.Time{}, false
+	}
+
+	fields := strings.Fields(e.Content)
+	if len(fields) < 2 || fields[0] != "cleaned" {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(unix, 0), true
+}
+
+// markCleanedUp adds the cleanup marker of entry and removes the markers of
+// earlier cleanups listed in entries that are older than the configured
+// maximum age. Failures are logged without failing the cleanup, which has
+// already succeeded.
+func (c *transipDNSProviderSolver) markCleanedUp(repo dnsRepository, cfg *transipDNSProviderConfig, ch *v1alpha1.ChallengeRequest, domainName string, entry domain.DNSEntry, entries []domain.DNSEntry) {
+	log := c.logger().WithValues("domain", domainName, "name", entry.Name)
+	now := c.now()
+
+	marker := newCleanupMarker(ch, entry, now)
+	if err := repo.AddDNSEntry(domainName, marker); err != nil {
+		log.Error(err, "could not add the cleanup marker")
+	} else {
+		log.Info("added cleanup marker", "marker", marker.Name)
+	}
+
+	maxAge := defaultCleanupMarkerMaxAge
+	if cfg.CleanupMarkerMaxAge != nil {
+		maxAge = cfg.CleanupMarkerMaxAge.Duration
+	}
+
+	for _, e := range entries {
+		cleaned, ok := cleanupMarkerTime(e)
+		if !ok || now.Sub(cleaned) < maxAge {
+			continue
+		}
+
+		if err := repo.RemoveDNSEntry(domainName, e); err != nil && !isNotFound(err) {
+			log.Error(err, "could not remove an expired cleanup marker", "marker", e.Name)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/transip/gotransip/v6/domain"
+)
+
+func TestCleanUpMarker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	stale := domain.DNSEntry{Name: "_cleaned._acme-challenge", Expire: 60, Type: "TXT", Content: "cleaned 1704096000 old-uid"}
+	recent := domain.DNSEntry{Name: "_cleaned._acme-challenge", Expire: 60, Type: "TXT", Content: "cleaned 1704110000 recent-uid"}
+
+	repo := newFakeDNSRepository("example.com", stale, recent)
+	solver, _ := newTestSolver(repo)
+	solver.timeNow = func() time.Time { return now }
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "cleanupMarker": true})
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var markers []string
+	for _, e := range repo.Entries("example.com") {
+		if e.Content == testKey {
+			t.Errorf("expected the challenge record to be removed")
+		}
+		if strings.HasPrefix(e.Name, cleanupMarkerPrefix) {
+			markers = append(markers, e.Content)
+		}
+	}
+
+	want := []string{recent.Content, "cleaned 1704110400 " + challengeID(ch)}
+	if strings.Join(markers, ",") != strings.Join(want, ",") {
+		t.Errorf("expected markers %v, got %v", want, markers)
+	}
+}
+
+func TestCleanUpMarkerDisabled(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if entries := repo.Entries("example.com"); len(entries) != 0 {
+		t.Errorf("expected no marker without cleanupMarker, got %v", entries)
+	}
+}
+
+func TestCleanUpMarkerApex(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	stale := domain.DNSEntry{Name: "_cleaned", Expire: 60, Type: "TXT", Content: "cleaned 1704096000 old-uid"}
+
+	repo := newFakeDNSRepository("example.com", stale)
+	solver, _ := newTestSolver(repo)
+	solver.timeNow = func() time.Time { return now }
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "cleanupMarker": true})
+	ch.ResolvedFQDN = "example.com."
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The marker of the record at @ is named _cleaned, and replaces the
+	// stale one.
+	want := []domain.DNSEntry{{Name: "_cleaned", Expire: 60, Type: "TXT", Content: "cleaned 1704110400 " + challengeID(ch)}}
+	if got := repo.Entries("example.com"); len(got) != 1 || got[0] != want[0] {
+		t.Errorf("expected entries %+v, got %+v", want, got)
+	}
+}
+
+func TestChallengeID(t *testing.T) {
+	// cert-manager leaves the UID of the ChallengeRequest empty.
+	ch := newChallengeRequest(t, "example.com", testKey, nil)
+	other := newChallengeRequest(t, "example.com", otherTestKey, nil)
+	otherName := newChallengeRequest(t, "example.org", testKey, nil)
+
+	id := challengeID(ch)
+	if len(id) != challengeIDLength {
+		t.Fatalf("expected an ID of %d characters, got %q", challengeIDLength, id)
+	}
+	if strings.Contains(testKey, id) {
+		t.Errorf("expected the ID not to reveal the key, got %q", id)
+	}
+	if challengeID(ch) != id {
+		t.Errorf("expected the same ID for the same challenge")
+	}
+	if challengeID(other) == id || challengeID(otherName) == id {
+		t.Errorf("expected challenges with another key or FQDN to get another ID")
+	}
+}
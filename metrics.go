@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Credential sources reported by credentialSourceTotal.
+const (
+	credentialSourceInline = "inline"
+	credentialSourceSecret = "secret"
+	credentialSourceFile   = "file"
+	// credentialSourceToken counts the clients authenticating with an
+	// access token, whether inline or from a Secret.
+	credentialSourceToken = "token"
+)
+
+// Operations reported by operationDuration.
+const (
+	operationPresent = "present"
+	operationCleanUp = "cleanup"
+)
+
+// Results reported by presentTotal and cleanUpTotal.
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+)
+
+// defaultMetricsAddress is the address the metrics are served on when
+// metricsAddressEnvVar is unset.
+const defaultMetricsAddress = ":9402"
+
+// metricsRegistry holds the metrics of the webhook.
+var metricsRegistry = prometheus.NewRegistry()
+
+var credentialSourceTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "transip_webhook_credential_source_total",
+	Help: "Number of TransIP clients created, by the source of their credentials.",
+}, []string{"source"})
+
+var managedDomains = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "transip_webhook_managed_domains",
+	Help: "Number of distinct TransIP domains records have been presented into since the webhook started.",
+})
+
+var cleanupNotFoundTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "transip_webhook_cleanup_not_found_total",
+	Help: "Number of cleanups that found no record matching the challenge, unless cleanupNotFound is silent.",
+})
+
+var presentTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "transip_webhook_present_total",
+	Help: "Number of challenges presented, by result.",
+}, []string{"result"})
+
+var cleanUpTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "transip_webhook_cleanup_total",
+	Help: "Number of challenges cleaned up, by result.",
+}, []string{"result"})
+
+var operationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "transip_webhook_operation_duration_seconds",
+	Help:    "Time taken to present or clean up a challenge, by operation.",
+	Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+}, []string{"operation"})
+
+func init() {
+	metricsRegistry.MustRegister(credentialSourceTotal, managedDomains, cleanupNotFoundTotal, presentTotal, cleanUpTotal, operationDuration)
+
+	for _, result := range []string{resultSuccess, resultError} {
+		presentTotal.WithLabelValues(result)
+		cleanUpTotal.WithLabelValues(result)
+	}
+	for _, operation := range []string{operationPresent, operationCleanUp} {
+		operationDuration.WithLabelValues(operation)
+	}
+
+	// Initialize every source so all of them are exported from the start.
+	for _, source := range []string{credentialSourceInline, credentialSourceSecret, credentialSourceFile, credentialSourceToken} {
+		credentialSourceTotal.WithLabelValues(source)
+	}
+}
+
+// domainSet is a set of domain names, compared case-insensitively. The zero
+// value is ready to use.
+type domainSet struct {
+	mu    sync.Mutex
+	names map[string]struct{}
+}
+
+// Add adds name to the set and returns the size of the set.
+func (s *domainSet) Add(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.names == nil {
+		s.names = map[string]struct{}{}
+	}
+	s.names[strings.ToLower(name)] = struct{}{}
+
+	return len(s.names)
+}
+
+// recordPresentedDomain counts domainName towards managedDomains.
+func (c *transipDNSProviderSolver) recordPresentedDomain(domainName string) {
+	managedDomains.Set(float64(c.presentedDomains.Add(domainName)))
+}
+
+// observeOperation records the result of operation, which started at start,
+// in total and operationDuration.
+func (c *transipDNSProviderSolver) observeOperation(operation string, total *prometheus.CounterVec, start time.Time, err error) {
+	operationDuration.WithLabelValues(operation).Observe(c.now().Sub(start).Seconds())
+
+	result := resultSuccess
+	if err != nil {
+		result = resultError
+	}
+	total.WithLabelValues(result).Inc()
+}
+
+// startMetricsServer serves the metrics in metricsRegistry on addr until stop
+// is closed, returning the address it listens on.
+func startMetricsServer(addr string, stop <-chan struct{}, log logr.Logger) (net.Addr, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error(err, "metrics server stopped")
+		}
+	}()
+	go func() {
+		<-stop
+		server.Close()
+	}()
+
+	return listener.Addr(), nil
+}
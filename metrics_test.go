@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6"
+)
+
+// counterValue returns the current value of the counter with the given
+// label values.
+func counterValue(t *testing.T, counter *prometheus.CounterVec, labels ...string) float64 {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := counter.WithLabelValues(labels...).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestNewTransipClientCountsCredentialSource(t *testing.T) {
+	privateKey := testPrivateKey(t)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, credentialsDirAccountNameFile), []byte("user"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, credentialsDirPrivateKeyFile), privateKey, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "transip-credentials", Namespace: "default"},
+		Data:       map[string][]byte{"privateKey": privateKey},
+	})
+	ch := &v1alpha1.ChallengeRequest{ResourceNamespace: "default"}
+
+	tests := map[string]*transipDNSProviderConfig{
+		credentialSourceInline: {AccountName: "user", PrivateKey: privateKey},
+		credentialSourceSecret: {
+			AccountName:         "user",
+			PrivateKeySecretRef: v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "transip-credentials"}, Key: "privateKey"},
+		},
+		credentialSourceFile: {CredentialsDir: dir},
+	}
+
+	for source, cfg := range tests {
+		t.Run(source, func(t *testing.T) {
+			before := map[string]float64{}
+			for s := range tests {
+				before[s] = counterValue(t, credentialSourceTotal, s)
+			}
+
+			// All sources hold the same credentials, which a single solver
+			// would create only one client for.
+			solver := &transipDNSProviderSolver{client: client}
+			if _, err := solver.NewTransipClient(context.Background(), ch, cfg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for s := range tests {
+				want := before[s]
+				if s == source {
+					want++
+				}
+				if got := counterValue(t, credentialSourceTotal, s); got != want {
+					t.Errorf("source %q: counter = %v, want %v", s, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCredentialSourceMetricToken(t *testing.T) {
+	before := map[string]float64{}
+	for _, s := range []string{credentialSourceInline, credentialSourceSecret, credentialSourceToken} {
+		before[s] = counterValue(t, credentialSourceTotal, s)
+	}
+
+	var configs []gotransip.ClientConfiguration
+	solver := &transipDNSProviderSolver{newClient: recordClientConfigs(&configs)}
+	cfg := &transipDNSProviderConfig{AccountName: "user", Token: testToken}
+	if _, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{}, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := counterValue(t, credentialSourceTotal, credentialSourceToken); got != before[credentialSourceToken]+1 {
+		t.Errorf("token counter = %v, want %v", got, before[credentialSourceToken]+1)
+	}
+	for _, s := range []string{credentialSourceInline, credentialSourceSecret} {
+		if got := counterValue(t, credentialSourceTotal, s); got != before[s] {
+			t.Errorf("source %q: counter = %v, want %v", s, got, before[s])
+		}
+	}
+}
+
+func TestPresentCountsManagedDomains(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	repo.entries["example.org"] = nil
+	solver, _ := newTestSolver(repo)
+
+	for _, zone := range []string{"example.com", "example.org", "example.com"} {
+		for _, key := range []string{testKey, otherTestKey} {
+			if err := solver.Present(newChallengeRequest(t, zone, key, map[string]interface{}{"ttl": 300})); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+
+	m := &dto.Metric{}
+	if err := managedDomains.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetGauge().GetValue(); got != 2 {
+		t.Errorf("managed domains = %v, want 2", got)
+	}
+}
+
+func TestPresentCleanUpCountsResults(t *testing.T) {
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+
+	presentSuccess := counterValue(t, presentTotal, resultSuccess)
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := counterValue(t, presentTotal, resultSuccess); got != presentSuccess+1 {
+		t.Errorf("expected the present success counter to be %v, got %v", presentSuccess+1, got)
+	}
+
+	cleanUpSuccess := counterValue(t, cleanUpTotal, resultSuccess)
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := counterValue(t, cleanUpTotal, resultSuccess); got != cleanUpSuccess+1 {
+		t.Errorf("expected the cleanup success counter to be %v, got %v", cleanUpSuccess+1, got)
+	}
+
+	presentError := counterValue(t, presentTotal, resultError)
+	if err := solver.Present(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 301})); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := counterValue(t, presentTotal, resultError); got != presentError+1 {
+		t.Errorf("expected the present error counter to be %v, got %v", presentError+1, got)
+	}
+}
+
+func TestInitializeServesMetrics(t *testing.T) {
+	port := freePort(t)
+	addr := net.JoinHostPort(debugHost, strconv.Itoa(port))
+	t.Setenv(metricsAddressEnvVar, addr)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	solver := &transipDNSProviderSolver{}
+	if err := solver.Initialize(&rest.Config{}, stopCh); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatalf("expected the metrics endpoint to be reachable: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "transip_webhook_present_total") {
+		t.Errorf("expected the present counter to be served, got:\n%s", body)
+	}
+}
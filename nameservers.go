@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// defaultNameserverPort is the port appended to nameservers configured
+// without one.
+const defaultNameserverPort = "53"
+
+// normalizeNameservers validates the nameservers configured in field and
+// returns them as host:port addresses, appending the default port where it
+// is missing and dropping duplicates. DNS-over-HTTPS URLs are kept as is. A
+// nil list is returned unchanged, but an empty one is rejected, as it most
+// likely results from a templating mistake. All malformed entries are
+// reported together.
+func normalizeNameservers(field string, nameservers []string) ([]string, error) {
+	if nameservers == nil {
+		return nil, nil
+	}
+	if len(nameservers) == 0 {
+		return nil, fmt.Errorf("%s must not be empty", field)
+	}
+
+	var errs []error
+	normalized := make([]string, 0, len(nameservers))
+	seen := map[string]bool{}
+	for i, ns := range nameservers {
+		address, err := normalizeNameserver(strings.TrimSpace(ns))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s[%d]: %v", field, i, err))
+			continue
+		}
+
+		if !seen[address] {
+			seen[address] = true
+			normalized = append(normalized, address)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return normalized, nil
+}
+
+// normalizeNameserver returns ns as a host:port address, or as is when it is
+// a DNS-over-HTTPS URL.
+func normalizeNameserver(ns string) (string, error) {
+	if ns == "" {
+		return "", errors.New("empty nameserver")
+	}
+
+	if strings.HasPrefix(ns, "https://") {
+		u, err := url.Parse(ns)
+		if err != nil || u.Host == "" {
+			return "", fmt.Errorf("invalid DNS-over-HTTPS URL %q", ns)
+		}
+		return ns, nil
+	}
+
+	host, port, err := net.SplitHostPort(ns)
+	if err != nil {
+		// The port is missing, unless ns is malformed in another way, which
+		// the host check below reports.
+		host, port = strings.TrimSuffix(strings.TrimPrefix(ns, "["), "]"), defaultNameserverPort
+	}
+
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid port %q in nameserver %q", port, ns)
+	}
+
+	if net.ParseIP(host) == nil {
+		if errs := validation.IsDNS1123Subdomain(strings.ToLower(strings.TrimSuffix(host, "."))); len(errs) > 0 {
+			return "", fmt.Errorf("invalid host %q in nameserver %q: %s", host, ns, strings.Join(errs, ", "))
+		}
+	}
+
+	return net.JoinHostPort(strings.ToLower(host), port), nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestNormalizeNameservers(t *testing.T) {
+	tests := map[string]struct {
+		nameservers []string
+		want        []string
+	}{
+		"unset": {},
+		"missing ports": {
+			nameservers: []string{"10.0.0.1", "ns1.example.com", "2001:db8::1", "[2001:db8::2]"},
+			want:        []string{"10.0.0.1:53", "ns1.example.com:53", "[2001:db8::1]:53", "[2001:db8::2]:53"},
+		},
+		"explicit ports": {
+			nameservers: []string{"10.0.0.1:5353", "[2001:db8::1]:5353"},
+			want:        []string{"10.0.0.1:5353", "[2001:db8::1]:5353"},
+		},
+		"duplicates": {
+			nameservers: []string{"10.0.0.1", "10.0.0.1:53", " NS1.example.com ", "ns1.example.com:53", "10.0.0.2"},
+			want:        []string{"10.0.0.1:53", "ns1.example.com:53", "10.0.0.2:53"},
+		},
+		"DNS-over-HTTPS": {
+			nameservers: []string{"https://cloudflare-dns.com/dns-query"},
+			want:        []string{"https://cloudflare-dns.com/dns-query"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := normalizeNameservers("nameservers", tt.nameservers)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeNameserversInvalid(t *testing.T) {
+	tests := map[string]struct {
+		nameservers []string
+		want        []string
+	}{
+		"empty list": {
+			nameservers: []string{},
+			want:        []string{"nameservers must not be empty"},
+		},
+		"invalid hosts": {
+			nameservers: []string{"10.0.0.1", "ns_1.example.com", "", "bad host:53"},
+			want:        []string{`nameservers[1]: invalid host "ns_1.example.com"`, "nameservers[2]: empty nameserver", `nameservers[3]: invalid host "bad host"`},
+		},
+		"invalid ports": {
+			nameservers: []string{"10.0.0.1:dns", "10.0.0.1:0", "10.0.0.1:65536"},
+			want:        []string{`nameservers[0]: invalid port "dns"`, `nameservers[1]: invalid port "0"`, `nameservers[2]: invalid port "65536"`},
+		},
+		"invalid URL": {
+			nameservers: []string{"https://"},
+			want:        []string{"nameservers[0]: invalid DNS-over-HTTPS URL"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := normalizeNameservers("nameservers", tt.nameservers)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected the error to contain %q, got:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigNormalizesNameservers(t *testing.T) {
+	cfg, err := loadConfig(&extapi.JSON{Raw: []byte(`{"nameservers": ["10.0.0.1", "10.0.0.1:53"], "alternateNameservers": ["ns1.example.com"]}`)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"10.0.0.1:53"}; !reflect.DeepEqual(cfg.Nameservers, want) {
+		t.Errorf("nameservers = %q, want %q", cfg.Nameservers, want)
+	}
+	if want := []string{"ns1.example.com:53"}; !reflect.DeepEqual(cfg.AlternateNameservers, want) {
+		t.Errorf("alternateNameservers = %q, want %q", cfg.AlternateNameservers, want)
+	}
+
+	if _, err := loadConfig(&extapi.JSON{Raw: []byte(`{"alternateNameservers": ["ns1.example.com:x"]}`)}); err == nil {
+		t.Error("expected an error for invalid alternate nameservers")
+	}
+}
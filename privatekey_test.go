@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6"
+	"github.com/transip/gotransip/v6/repository"
+)
+
+// generateRSAKey returns a PEM encoded PKCS#1 RSA private key of the given
+// size.
+func generateRSAKey(t *testing.T, bits int) []byte {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+var (
+	testPrivateKeyOnce sync.Once
+	testPrivateKeyPEM  []byte
+)
+
+// testPrivateKey returns a valid 2048 bit private key, shared between tests
+// as generating it is slow.
+func testPrivateKey(t *testing.T) []byte {
+	t.Helper()
+
+	testPrivateKeyOnce.Do(func() {
+		testPrivateKeyPEM = generateRSAKey(t, 2048)
+	})
+	return testPrivateKeyPEM
+}
+
+func TestCheckRSAKeySize(t *testing.T) {
+	small := generateRSAKey(t, 1024)
+	large := testPrivateKey(t)
+
+	if err := checkRSAKeySize(small, 2048); err == nil || !strings.Contains(err.Error(), "1024 bit RSA key, at least 2048 bits are required") {
+		t.Errorf("expected a key size error for a 1024 bit key, got %v", err)
+	}
+	if err := checkRSAKeySize(large, 2048); err != nil {
+		t.Errorf("unexpected error for a 2048 bit key: %v", err)
+	}
+	if err := checkRSAKeySize(small, 1024); err != nil {
+		t.Errorf("unexpected error for a 1024 bit key with a 1024 bit minimum: %v", err)
+	}
+}
+
+func TestCheckRSAKeySizePKCS8(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := checkRSAKeySize(pemKey, 2048); err == nil {
+		t.Error("expected a key size error for a 1024 bit PKCS#8 key")
+	}
+}
+
+func TestNewTransipClientRejectsSmallKey(t *testing.T) {
+	solver := &transipDNSProviderSolver{}
+	cfg := &transipDNSProviderConfig{AccountName: "user", PrivateKey: generateRSAKey(t, 1024)}
+
+	_, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{}, cfg)
+	if err == nil || !strings.Contains(err.Error(), "private key is too small") {
+		t.Fatalf("expected a key size error, got %v", err)
+	}
+}
+
+func TestConvertPrivateKey(t *testing.T) {
+	pkcs1 := testPrivateKey(t)
+	original, err := x509.ParsePKCS1PrivateKey(mustDecodePEM(t, pkcs1, pemTypePKCS1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8, from, to, err := convertPrivateKey(pkcs1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if from != "PKCS#1" || to != "PKCS#8" {
+		t.Errorf("expected a PKCS#1 to PKCS#8 conversion, got %s to %s", from, to)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(mustDecodePEM(t, pkcs8, pemTypePKCS8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !original.Equal(key) {
+		t.Error("expected the converted key to be the same key")
+	}
+
+	back, from, to, err := convertPrivateKey(pkcs8)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if from != "PKCS#8" || to != "PKCS#1" || string(back) != string(pkcs1) {
+		t.Errorf("expected the PKCS#8 key to convert back to the PKCS#1 key, got %s to %s:\n%s", from, to, back)
+	}
+}
+
+func TestConvertPrivateKeyInvalid(t *testing.T) {
+	for _, privateKey := range [][]byte{
+		[]byte("not a key"),
+		pem.EncodeToMemory(&pem.Block{Type: pemTypePKCS1, Bytes: []byte("garbage")}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("garbage")}),
+	} {
+		if _, _, _, err := convertPrivateKey(privateKey); err == nil {
+			t.Errorf("expected an error converting %q", privateKey)
+		}
+	}
+}
+
+func TestNewTransipClientConvertsKeyFormat(t *testing.T) {
+	for _, convert := range []bool{false, true} {
+		log, logs := newTestLogger()
+		var keys []string
+		solver := &transipDNSProviderSolver{
+			log: log,
+			// Only PKCS#8 keys are accepted, like the keys TransIP generates.
+			newClient: func(cfg gotransip.ClientConfiguration) (repository.Client, error) {
+				key, err := io.ReadAll(cfg.PrivateKeyReader)
+				if err != nil {
+					return repository.Client{}, err
+				}
+				keys = append(keys, string(key))
+
+				block, _ := pem.Decode(key)
+				if block == nil || block.Type != pemTypePKCS8 {
+					return repository.Client{}, errors.New("could not parse private key")
+				}
+				return repository.Client{}, nil
+			},
+		}
+		cfg := &transipDNSProviderConfig{AccountName: "user", PrivateKey: testPrivateKey(t), ConvertKeyFormat: convert}
+
+		_, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{}, cfg)
+		if !convert {
+			if err == nil || len(keys) != 1 {
+				t.Errorf("expected the key to be rejected without a retry, got %v after %d attempts", err, len(keys))
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(keys) != 2 || !strings.Contains(keys[1], "BEGIN PRIVATE KEY") {
+			t.Errorf("expected a retry with a PKCS#8 key, got %d attempts", len(keys))
+		}
+		if !logs.Contains(`"from"="PKCS#1" "to"="PKCS#8"`) {
+			t.Errorf("expected the conversion to be logged, got logs:\n%s", logs)
+		}
+		if logs.Contains("PRIVATE KEY") {
+			t.Errorf("expected the private key not to be logged, got logs:\n%s", logs)
+		}
+	}
+}
+
+func TestNewTransipClientDoesNotConvertInvalidKey(t *testing.T) {
+	attempts := 0
+	solver := &transipDNSProviderSolver{
+		newClient: func(gotransip.ClientConfiguration) (repository.Client, error) {
+			attempts++
+			return repository.Client{}, errors.New("could not parse private key")
+		},
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: pemTypePKCS1, Bytes: []byte("garbage")})
+	cfg := &transipDNSProviderConfig{AccountName: "user", PrivateKey: privateKey, ConvertKeyFormat: true}
+
+	// Invalid keys are rejected before any client is created, let alone
+	// retried with the key converted.
+	_, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{}, cfg)
+	if err == nil || !strings.Contains(err.Error(), "private key is not a valid RSA PRIVATE KEY block") {
+		t.Errorf("expected an invalid private key error, got %v", err)
+	}
+	if attempts != 0 {
+		t.Errorf("expected no client to be created with an invalid key, got %d attempts", attempts)
+	}
+}
+
+func TestValidatePrivateKey(t *testing.T) {
+	privateKey := testPrivateKey(t)
+	block, _ := pem.Decode(privateKey)
+	rsaKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPKCS8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		privateKey []byte
+		wantErr    string
+	}{
+		"PKCS#1":    {privateKey: privateKey},
+		"PKCS#8":    {privateKey: pem.EncodeToMemory(&pem.Block{Type: pemTypePKCS8, Bytes: pkcs8})},
+		"empty":     {privateKey: nil, wantErr: "private key is empty"},
+		"blank":     {privateKey: []byte(" \n"), wantErr: "private key is empty"},
+		"garbage":   {privateKey: []byte("c2VjcmV0LWtleQ=="), wantErr: "private key is not valid PEM"},
+		"truncated": {privateKey: privateKey[:len(privateKey)/2], wantErr: "private key is not valid PEM"},
+		"public key": {
+			privateKey: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("garbage")}),
+			wantErr:    `private key is a PEM block of type "PUBLIC KEY"`,
+		},
+		"corrupt": {
+			privateKey: pem.EncodeToMemory(&pem.Block{Type: pemTypePKCS8, Bytes: []byte("garbage")}),
+			wantErr:    "private key is not a valid PRIVATE KEY block",
+		},
+		"EC key": {
+			privateKey: pem.EncodeToMemory(&pem.Block{Type: pemTypePKCS8, Bytes: ecPKCS8}),
+			wantErr:    "expected an RSA private key",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validatePrivateKey(tt.privateKey)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewTransipClientRejectsInvalidKey(t *testing.T) {
+	attempts := 0
+	solver := &transipDNSProviderSolver{
+		newClient: func(gotransip.ClientConfiguration) (repository.Client, error) {
+			attempts++
+			return repository.Client{}, nil
+		},
+	}
+
+	for _, privateKey := range [][]byte{[]byte("c2VjcmV0LWtleQ=="), testPrivateKey(t)[:100]} {
+		cfg := &transipDNSProviderConfig{AccountName: "user", PrivateKey: privateKey}
+		_, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{}, cfg)
+		if err == nil || !strings.Contains(err.Error(), "private key is not valid PEM") {
+			t.Errorf("expected an invalid PEM error, got %v", err)
+		}
+	}
+	if attempts != 0 {
+		t.Errorf("expected no client to be created, got %d attempts", attempts)
+	}
+}
+
+// mustDecodePEM returns the bytes of the PEM block in data, which must be of
+// type blockType.
+func mustDecodePEM(t *testing.T, data []byte, blockType string) []byte {
+	t.Helper()
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		t.Fatalf("expected a %s PEM block, got %q", blockType, data)
+	}
+	return block.Bytes
+}
+
+func TestNormalizePrivateKey(t *testing.T) {
+	privateKey := testPrivateKey(t)
+	crlf := "  " + strings.ReplaceAll(string(privateKey), "\n", "\r\n") + " \r\n\r\n"
+	indented := strings.ReplaceAll("\n"+string(privateKey), "\n", "\n    ")
+
+	for name, input := range map[string]string{"CRLF and spaces": crlf, "indented": indented} {
+		normalized, changed := normalizePrivateKey([]byte(input))
+		if !changed || string(normalized) != string(privateKey) {
+			t.Errorf("%s: expected the key to be normalized to the original, got %q (changed %v)", name, normalized, changed)
+		}
+	}
+
+	for _, input := range [][]byte{privateKey, nil, []byte(" \n")} {
+		if normalized, changed := normalizePrivateKey(input); changed || string(normalized) != string(input) {
+			t.Errorf("expected %q to be left as it is, got %q", input, normalized)
+		}
+	}
+}
+
+func TestNewTransipClientNormalizesKey(t *testing.T) {
+	privateKey := testPrivateKey(t)
+
+	var logs logBuffer
+	log := funcr.New(func(prefix, args string) {
+		logs.mu.Lock()
+		defer logs.mu.Unlock()
+		logs.lines = append(logs.lines, prefix+" "+args)
+	}, funcr.Options{Verbosity: 1})
+
+	var keys []string
+	solver := &transipDNSProviderSolver{
+		log: log,
+		newClient: func(cfg gotransip.ClientConfiguration) (repository.Client, error) {
+			key, err := io.ReadAll(cfg.PrivateKeyReader)
+			keys = append(keys, string(key))
+			return repository.Client{}, err
+		},
+	}
+	pasted := "  " + strings.ReplaceAll(string(privateKey), "\n", "\r\n")
+	cfg := &transipDNSProviderConfig{AccountName: "user", PrivateKey: []byte(pasted)}
+
+	if _, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{}, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != string(privateKey) {
+		t.Errorf("expected the client to be created with the normalized key, got %q", keys)
+	}
+	if !logs.Contains(`"msg"="trimmed whitespace and line endings around the private key" "account"="user" "source"="inline"`) {
+		t.Errorf("expected the normalization to be logged, got logs:\n%s", &logs)
+	}
+	if logs.Contains("PRIVATE KEY") {
+		t.Errorf("expected the private key not to be logged, got logs:\n%s", &logs)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/issuer/acme/dns/util"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// propagationPollInterval is how often the authoritative nameservers are
+// queried while measuring how long a record takes to become visible.
+const propagationPollInterval = 5 * time.Second
+
+// propagationTimeout is how long a record is waited for before the
+// measurement is given up.
+const propagationTimeout = 10 * time.Minute
+
+// defaultPropagationCheckTimeout is how long Present waits for a record to
+// become visible when propagationCheck is set, unless the config sets
+// propagationCheckTimeout.
+const defaultPropagationCheckTimeout = 2 * time.Minute
+
+var propagationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "transip_webhook_propagation_seconds",
+	Help:    "Time from adding a challenge record until it is visible on the authoritative nameservers.",
+	Buckets: prometheus.ExponentialBuckets(1, 2, 11),
+})
+
+func init() {
+	metricsRegistry.MustRegister(propagationSeconds)
+}
+
+// measurePropagation polls until the record at fqdn with content is visible,
+// and records the time since added in propagationSeconds. It is diagnostic
+// only: failures are logged and the measurement is dropped, as it is when the
+// webhook shuts down.
+func (c *transipDNSProviderSolver) measurePropagation(fqdn, content string, cfg *transipDNSProviderConfig, added time.Time) {
+	log := c.logger().WithValues("fqdn", fqdn)
+
+	clk := c.clock
+	if clk == nil {
+		clk = realClock{}
+	}
+
+	ctx, cancel := context.WithTimeout(c.rootContext(), propagationTimeout)
+	defer cancel()
+
+	for {
+		visible, err := c.recordVisible(ctx, fqdn, content, cfg)
+		if err != nil {
+			log.V(1).Info("could not check whether the record is visible", "error", err.Error())
+		}
+		if visible {
+			elapsed := c.now().Sub(added)
+			propagationSeconds.Observe(elapsed.Seconds())
+			log.V(1).Info("record is visible", "elapsed", elapsed.String())
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.Canceled) {
+				log.V(1).Info("the webhook is shutting down, dropping the propagation measurement")
+				return
+			}
+			log.Info("record did not become visible, dropping the propagation measurement", "timeout", propagationTimeout.String())
+			return
+		case <-clk.After(propagationPollInterval):
+		}
+	}
+}
+
+// propagationCheckTimeout returns how long Present waits for a record to
+// become visible.
+func (cfg *transipDNSProviderConfig) propagationCheckTimeout() time.Duration {
+	if cfg.PropagationCheckTimeout != nil {
+		return cfg.PropagationCheckTimeout.Duration
+	}
+	return defaultPropagationCheckTimeout
+}
+
+// waitForPropagation polls until the record at fqdn with content is visible,
+// for at most the configured propagation check timeout, so that the self
+// check of cert-manager finds the record on its first attempt. A record that
+// does not become visible in time is logged, without failing the challenge:
+// it has been added, and cert-manager keeps checking for it.
+func (c *transipDNSProviderSolver) waitForPropagation(ctx context.Context, fqdn, content string, cfg *transipDNSProviderConfig) {
+	log := c.logger().WithValues("fqdn", fqdn)
+
+	clk := c.clock
+	if clk == nil {
+		clk = realClock{}
+	}
+
+	timeout := cfg.propagationCheckTimeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := c.now()
+	for {
+		visible, err := c.recordVisible(ctx, fqdn, content, cfg)
+		if err != nil {
+			log.V(1).Info("could not check whether the record is visible", "error", err.Error())
+		}
+		if visible {
+			log.Info("challenge record is visible on the nameservers", "elapsed", c.now().Sub(start).String())
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info("WARNING: challenge record did not become visible before the propagation check timed out, leaving the check to cert-manager", "timeout", timeout.String())
+			return
+		case <-clk.After(propagationPollInterval):
+		}
+	}
+}
+
+// recordVisible reports whether the record at fqdn with content is visible:
+// on all authoritative nameservers by default or, when propagation resolvers
+// are configured, on at least a quorum of them, so that a single stale or
+// early resolver does not decide. The authoritative nameservers are queried
+// on port 53, so with a DNS-over-HTTPS resolver and no propagation resolvers,
+// the record is looked up through the DNS-over-HTTPS resolver instead.
+func (c *transipDNSProviderSolver) recordVisible(ctx context.Context, fqdn, content string, cfg *transipDNSProviderConfig) (bool, error) {
+	checkPropagation := util.PreCheckDNS
+	if c.checkPropagation != nil {
+		checkPropagation = c.checkPropagation
+	}
+
+	if len(cfg.PropagationResolvers) == 0 {
+		if cfg.DNSOverHTTPSResolver != "" {
+			return checkPropagation(ctx, fqdn, content, []string{cfg.DNSOverHTTPSResolver}, false)
+		}
+		return checkPropagation(ctx, fqdn, content, cfg.nameservers(), true)
+	}
+
+	var errs []error
+	agreeing := 0
+	for _, resolver := range cfg.PropagationResolvers {
+		visible, err := checkPropagation(ctx, fqdn, content, []string{resolver}, false)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", resolver, err))
+			continue
+		}
+		if visible {
+			agreeing++
+		}
+	}
+
+	return agreeing >= cfg.propagationQuorum(), errors.Join(errs...)
+}
+
+// propagationQuorum returns the number of propagation resolvers that must
+// see a record, defaulting to a majority of them.
+func (cfg *transipDNSProviderConfig) propagationQuorum() int {
+	if cfg.PropagationQuorum > 0 {
+		return cfg.PropagationQuorum
+	}
+	return len(cfg.PropagationResolvers)/2 + 1
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMeasurePropagation(t *testing.T) {
+	added := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := added
+
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+	solver.timeNow = func() time.Time { return now }
+
+	checks := 0
+	solver.checkPropagation = func(_ context.Context, fqdn, value string, _ []string, useAuthoritative bool) (bool, error) {
+		if fqdn != "_acme-challenge.example.com." || value != testKey || !useAuthoritative {
+			t.Errorf("unexpected check of %q = %q (authoritative: %v)", fqdn, value, useAuthoritative)
+		}
+		checks++
+		// The record becomes visible on the third query, 20 seconds after
+		// it was added.
+		now = added.Add(time.Duration(checks-1) * 10 * time.Second)
+		return checks == 3, nil
+	}
+
+	before := &dto.Metric{}
+	if err := propagationSeconds.Write(before); err != nil {
+		t.Fatal(err)
+	}
+
+	solver.measurePropagation("_acme-challenge.example.com.", testKey, &transipDNSProviderConfig{}, added)
+
+	after := &dto.Metric{}
+	if err := propagationSeconds.Write(after); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := after.GetHistogram().GetSampleCount() - before.GetHistogram().GetSampleCount(); got != 1 {
+		t.Fatalf("expected one propagation sample, got %d", got)
+	}
+	if got := after.GetHistogram().GetSampleSum() - before.GetHistogram().GetSampleSum(); got != 20 {
+		t.Errorf("expected a propagation time of 20s, got %vs", got)
+	}
+	if got := solver.clock.(*fakeClock).Delays(); len(got) != 2 || got[0] != propagationPollInterval {
+		t.Errorf("expected two polls %v apart, got delays %v", propagationPollInterval, got)
+	}
+}
+
+func TestMeasurePropagationDNSOverHTTPS(t *testing.T) {
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+
+	solver.checkPropagation = func(_ context.Context, _, _ string, nameservers []string, useAuthoritative bool) (bool, error) {
+		if useAuthoritative || len(nameservers) != 1 || nameservers[0] != "https://cloudflare-dns.com/dns-query" {
+			t.Errorf("expected the record to be looked up through the DNS-over-HTTPS resolver, got %v (authoritative: %v)", nameservers, useAuthoritative)
+		}
+		return true, nil
+	}
+
+	before := &dto.Metric{}
+	if err := propagationSeconds.Write(before); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &transipDNSProviderConfig{DNSOverHTTPSResolver: "https://cloudflare-dns.com/dns-query"}
+	solver.measurePropagation("_acme-challenge.example.com.", testKey, cfg, solver.now())
+
+	after := &dto.Metric{}
+	if err := propagationSeconds.Write(after); err != nil {
+		t.Fatal(err)
+	}
+	if got := after.GetHistogram().GetSampleCount() - before.GetHistogram().GetSampleCount(); got != 1 {
+		t.Errorf("expected one propagation sample, got %d", got)
+	}
+}
+
+func TestMeasurePropagationStopsOnShutdown(t *testing.T) {
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+	solver.clock = blockingClock{}
+	stopCh := make(chan struct{})
+	solver.stopCh = stopCh
+	solver.checkPropagation = func(context.Context, string, string, []string, bool) (bool, error) {
+		return false, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		solver.measurePropagation("_acme-challenge.example.com.", testKey, &transipDNSProviderConfig{}, time.Now())
+		close(done)
+	}()
+
+	close(stopCh)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the propagation measurement to stop when the webhook shuts down")
+	}
+}
+
+func TestRecordVisibleQuorum(t *testing.T) {
+	// Each resolver either sees the record, does not see it yet, or fails.
+	responses := map[string]error{
+		"visible-1:53": nil,
+		"visible-2:53": nil,
+		"stale:53":     errNotVisible,
+		"broken:53":    errors.New("i/o timeout"),
+	}
+
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+	solver.checkPropagation = func(_ context.Context, _, _ string, nameservers []string, useAuthoritative bool) (bool, error) {
+		if len(nameservers) != 1 || useAuthoritative {
+			t.Fatalf("expected a single recursive resolver to be queried, got %v (authoritative: %v)", nameservers, useAuthoritative)
+		}
+		switch err := responses[nameservers[0]]; err {
+		case nil:
+			return true, nil
+		case errNotVisible:
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	tests := []struct {
+		resolvers []string
+		quorum    int
+		want      bool
+	}{
+		// Two of three agree: a majority.
+		{resolvers: []string{"visible-1:53", "visible-2:53", "stale:53"}, want: true},
+		// One of three: no majority, even though one resolver sees it.
+		{resolvers: []string{"visible-1:53", "stale:53", "broken:53"}, want: false},
+		// Two of four is not a majority, but meets an explicit quorum.
+		{resolvers: []string{"visible-1:53", "visible-2:53", "stale:53", "broken:53"}, want: false},
+		{resolvers: []string{"visible-1:53", "visible-2:53", "stale:53", "broken:53"}, quorum: 2, want: true},
+		{resolvers: []string{"visible-1:53", "visible-2:53", "stale:53"}, quorum: 3, want: false},
+	}
+
+	for _, tt := range tests {
+		cfg := &transipDNSProviderConfig{PropagationResolvers: tt.resolvers, PropagationQuorum: tt.quorum}
+		got, _ := solver.recordVisible(context.Background(), "_acme-challenge.example.com.", testKey, cfg)
+		if got != tt.want {
+			t.Errorf("recordVisible(%v, quorum %d) = %v, want %v", tt.resolvers, tt.quorum, got, tt.want)
+		}
+	}
+}
+
+// errNotVisible marks a resolver that does not return the record yet in
+// TestRecordVisibleQuorum.
+var errNotVisible = errors.New("not visible")
+
+func TestPresentPropagationCheck(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, logs := newTestSolver(repo)
+
+	checks := 0
+	solver.checkPropagation = func(_ context.Context, fqdn, value string, _ []string, useAuthoritative bool) (bool, error) {
+		if fqdn != "_acme-challenge.example.com." || value != testKey || !useAuthoritative {
+			t.Errorf("unexpected check of %q = %q (authoritative: %v)", fqdn, value, useAuthoritative)
+		}
+		if len(repo.Entries("example.com")) == 0 {
+			t.Error("expected the record to be added before checking for it")
+		}
+		if len(solver.domainLocks.locks) != 0 {
+			t.Error("expected the domain lock to be released while waiting")
+		}
+		checks++
+		// The nameservers become consistent on the third query.
+		return checks == 3, nil
+	}
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "propagationCheck": true})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if checks != 3 {
+		t.Errorf("expected Present to return once the record is visible, after 3 checks, got %d", checks)
+	}
+	if got := solver.clock.(*fakeClock).Delays(); len(got) != 2 || got[0] != propagationPollInterval {
+		t.Errorf("expected two polls %v apart, got delays %v", propagationPollInterval, got)
+	}
+	if !logs.Contains("challenge record is visible on the nameservers") {
+		t.Errorf("expected the visible record to be logged, got logs:\n%s", logs)
+	}
+}
+
+func TestPresentPropagationCheckApex(t *testing.T) {
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+
+	var checked []string
+	solver.checkPropagation = func(_ context.Context, fqdn, _ string, _ []string, _ bool) (bool, error) {
+		checked = append(checked, fqdn)
+		return true, nil
+	}
+
+	// The challenge record is the domain itself, which TransIP names @.
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "propagationCheck": true})
+	ch.ResolvedFQDN = "example.com."
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(checked) != 1 || checked[0] != "example.com." {
+		t.Errorf("expected the domain itself to be checked once, got %v", checked)
+	}
+}
+
+func TestPresentPropagationCheckTimeout(t *testing.T) {
+	solver, logs := newTestSolver(newFakeDNSRepository("example.com"))
+	solver.checkPropagation = func(context.Context, string, string, []string, bool) (bool, error) {
+		return false, nil
+	}
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "propagationCheck": true, "propagationCheckTimeout": "50ms"})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("expected a record that does not propagate in time not to fail Present, got %v", err)
+	}
+	if !logs.Contains("did not become visible before the propagation check timed out") {
+		t.Errorf("expected the timeout to be logged, got logs:\n%s", logs)
+	}
+}
+
+func TestPresentPropagationCheckDisabled(t *testing.T) {
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+	solver.checkPropagation = func(context.Context, string, string, []string, bool) (bool, error) {
+		t.Error("expected no propagation check without propagationCheck")
+		return true, nil
+	}
+
+	if err := solver.Present(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPresentPropagationCheckNameservers(t *testing.T) {
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+
+	var queried [][]string
+	solver.checkPropagation = func(_ context.Context, _, _ string, nameservers []string, _ bool) (bool, error) {
+		queried = append(queried, nameservers)
+		return true, nil
+	}
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{
+		"ttl":              300,
+		"propagationCheck": true,
+		"nameservers":      []string{"ns0.transip.net:53"},
+	})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(queried) != 1 || len(queried[0]) != 1 || queried[0][0] != "ns0.transip.net:53" {
+		t.Errorf("expected the configured nameservers to be used for the propagation check, got %v", queried)
+	}
+}
+
+func TestPresentPropagationCheckDNSOverHTTPS(t *testing.T) {
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+
+	var queried [][]string
+	solver.checkPropagation = func(_ context.Context, _, _ string, nameservers []string, useAuthoritative bool) (bool, error) {
+		if useAuthoritative {
+			t.Error("expected the authoritative nameservers, which are queried on port 53, not to be looked up")
+		}
+		queried = append(queried, nameservers)
+		return true, nil
+	}
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{
+		"ttl":                  300,
+		"propagationCheck":     true,
+		"dnsOverHTTPSResolver": "https://cloudflare-dns.com/dns-query",
+	})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(queried) != 1 || len(queried[0]) != 1 || queried[0][0] != "https://cloudflare-dns.com/dns-query" {
+		t.Errorf("expected the record to be looked up through the DNS-over-HTTPS resolver, got %v", queried)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// validateHTTPProxy checks that the httpProxy of the config is an http:// or
+// https:// URL with a host. The errors show the URL without its password.
+func validateHTTPProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		// The error of url.Parse holds the URL as it was given.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("invalid httpProxy: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid httpProxy %q: must be an http:// or https:// URL", u.Redacted())
+	}
+	return nil
+}
+
+// proxyWithoutUserinfo returns proxy without the user name and password it
+// may hold, so that it can be shown.
+func proxyWithoutUserinfo(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return redacted
+	}
+	u.User = nil
+	return u.String()
+}
+
+// proxyTransport returns the transport to reach the TransIP API with: the
+// default transport, which honors the HTTPS_PROXY and NO_PROXY environment
+// variables, or a copy of it sending every request through proxy when set.
+// TLS certificates are verified either way.
+func proxyTransport(proxy string) http.RoundTripper {
+	if proxy == "" {
+		return http.DefaultTransport
+	}
+
+	// The proxy was validated when the config was loaded.
+	u, _ := url.Parse(proxy)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(u)
+	return transport
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"hash/fnv"
+	"strings"
+)
+
+// errQueueStopped is returned for operations submitted after the work queue
+// has been stopped.
+var errQueueStopped = errors.New("work queue stopped, the webhook is shutting down")
+
+// workQueue runs operations on a bounded pool of workers. Operations are
+// assigned to a worker by key, so all operations for the same domain are
+// handled by the same worker, one at a time and in submission order.
+type workQueue struct {
+	workers []chan workItem
+	stop    <-chan struct{}
+}
+
+type workItem struct {
+	fn   func() error
+	done chan error
+}
+
+// newWorkQueue starts a work queue with the given number of workers, each
+// buffering up to depth pending operations. The workers exit when stop is
+// closed.
+func newWorkQueue(workers, depth int, stop <-chan struct{}) *workQueue {
+	q := &workQueue{
+		workers: make([]chan workItem, workers),
+		stop:    stop,
+	}
+
+	for i := range q.workers {
+		q.workers[i] = make(chan workItem, depth)
+		go q.work(q.workers[i])
+	}
+
+	return q
+}
+
+func (q *workQueue) work(items <-chan workItem) {
+	for {
+		select {
+		case item := <-items:
+			item.done <- item.fn()
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// Do queues fn on the worker responsible for key and blocks until it has run,
+// returning its error.
+func (q *workQueue) Do(key string, fn func() error) error {
+	select {
+	case <-q.stop:
+		return errQueueStopped
+	default:
+	}
+
+	item := workItem{fn: fn, done: make(chan error, 1)}
+
+	select {
+	case q.workers[q.workerIndex(key)] <- item:
+	case <-q.stop:
+		return errQueueStopped
+	}
+
+	select {
+	case err := <-item.done:
+		return err
+	case <-q.stop:
+		return errQueueStopped
+	}
+}
+
+// workerIndex returns the index of the worker handling key.
+func (q *workQueue) workerIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(strings.ToLower(key)))
+	return int(h.Sum32() % uint32(len(q.workers)))
+}
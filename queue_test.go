@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkQueueCompletesAllOperations(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	q := newWorkQueue(2, 1, stop)
+
+	var completed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := q.Do(fmt.Sprintf("domain-%d.com", i), func() error {
+				atomic.AddInt32(&completed, 1)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if completed != 20 {
+		t.Errorf("expected 20 completed operations, got %d", completed)
+	}
+}
+
+func TestWorkQueueBoundsConcurrency(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	const workers = 3
+	q := newWorkQueue(workers, 10, stop)
+
+	var running, maxRunning int32
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			q.Do(fmt.Sprintf("domain-%d.com", i), func() error {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					cur := atomic.LoadInt32(&maxRunning)
+					if n <= cur || atomic.CompareAndSwapInt32(&maxRunning, cur, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	if maxRunning > workers {
+		t.Errorf("expected at most %d concurrent operations, got %d", workers, maxRunning)
+	}
+}
+
+func TestWorkQueueDomainAffinity(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	q := newWorkQueue(4, 10, stop)
+
+	if q.workerIndex("example.com.") != q.workerIndex("EXAMPLE.com.") {
+		t.Error("expected the same worker regardless of case")
+	}
+
+	release := make(chan struct{})
+	firstStarted := make(chan struct{})
+	go q.Do("example.com.", func() error {
+		close(firstStarted)
+		<-release
+		return nil
+	})
+	<-firstStarted
+
+	secondDone := make(chan struct{})
+	go func() {
+		defer close(secondDone)
+		q.Do("example.com.", func() error { return nil })
+	}()
+
+	select {
+	case <-secondDone:
+		t.Fatal("second operation for the same domain ran while the first was in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case <-secondDone:
+	case <-time.After(time.Second):
+		t.Fatal("second operation did not complete")
+	}
+}
+
+func TestWorkQueueReturnsOperationResult(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	q := newWorkQueue(1, 1, stop)
+
+	wantErr := errors.New("operation failed")
+	var ran bool
+	err := q.Do("example.com.", func() error {
+		time.Sleep(10 * time.Millisecond)
+		ran = true
+		return wantErr
+	})
+
+	if !ran {
+		t.Error("expected Do to block until the operation ran")
+	}
+	if !errors.Is(err, wantErr) {
+		t.Errorf("Do() error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestWorkQueueStopped(t *testing.T) {
+	stop := make(chan struct{})
+	q := newWorkQueue(1, 0, stop)
+	close(stop)
+
+	if err := q.Do("example.com.", func() error { return nil }); !errors.Is(err, errQueueStopped) {
+		t.Errorf("Do() error = %v, want %v", err, errQueueStopped)
+	}
+}
+
+func TestPresentThroughWorkQueue(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+	solver.queue = newWorkQueue(2, 1, stop)
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if entries := repo.Entries("example.com"); len(entries) != 1 {
+		t.Errorf("expected the record to be present once Present returns, got %v", entries)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// The headers TransIP reports its rate limit in: the number of calls allowed
+// per window, the number left in the current window, and the Unix time at
+// which the window resets.
+const (
+	rateLimitLimitHeader     = "X-Rate-Limit-Limit"
+	rateLimitRemainingHeader = "X-Rate-Limit-Remaining"
+	rateLimitResetHeader     = "X-Rate-Limit-Reset"
+)
+
+// rateLimitLowFraction is the share of the rate limit below which the calls
+// left in the window are spread out evenly until it resets.
+const rateLimitLowFraction = 0.1
+
+// rateLimiter throttles calls to the TransIP API by the rate limit TransIP
+// reported in its last response. Until a response reported one, calls are not
+// throttled.
+type rateLimiter struct {
+	now   func() time.Time
+	clock clock
+	log   logr.Logger
+
+	mu        sync.Mutex
+	known     bool
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// Observe records the rate limit reported in the headers of a response.
+// Responses without complete rate limit headers are ignored.
+func (l *rateLimiter) Observe(header http.Header) {
+	limit, err := strconv.Atoi(header.Get(rateLimitLimitHeader))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(header.Get(rateLimitRemainingHeader))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get(rateLimitResetHeader), 10, 64)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.known = true
+	l.limit = limit
+	l.remaining = remaining
+	l.reset = time.Unix(reset, 0)
+}
+
+// reserve takes a call from the remaining budget, returning how long to wait
+// before making it: until the window resets when the budget is exhausted, an
+// even share of the time left when it is low, and zero otherwise.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	left := l.reset.Sub(l.now())
+	if !l.known || left <= 0 {
+		return 0
+	}
+
+	remaining := l.remaining
+	l.remaining--
+
+	switch {
+	case remaining <= 0:
+		return left
+	case float64(remaining) < float64(l.limit)*rateLimitLowFraction:
+		return left / time.Duration(remaining+1)
+	default:
+		return 0
+	}
+}
+
+// Wait blocks until the next call may be made, or ctx is done.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	delay := l.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	l.log.Info("throttling TransIP API calls to stay within the rate limit", "delay", delay.String())
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for the TransIP rate limit: %w", ctx.Err())
+	case <-l.clock.After(delay):
+		return nil
+	}
+}
+
+// rateLimitTransport waits for the rate limiter before each request and feeds
+// it the rate limit headers of each response.
+type rateLimitTransport struct {
+	limiter *rateLimiter
+	next    http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		t.limiter.Observe(resp.Header)
+	}
+	return resp, err
+}
+
+// httpClient returns the HTTP client for a new TransIP API client, throttled
+// by a rate limiter of its own, as TransIP limits the rate per account,
+// identifying the webhook in the User-Agent and going through httpProxy when
+// set. gotransip does not take a context, so each request is bounded by
+// timeout here; a request that times out is cancelled rather than left to
+// complete after the call gave up.
+func (c *transipDNSProviderSolver) httpClient(httpProxy string, timeout time.Duration) *http.Client {
+	clk := c.clock
+	if clk == nil {
+		clk = realClock{}
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &rateLimitTransport{
+			limiter: &rateLimiter{now: c.now, clock: clk, log: c.logger()},
+			next:    &userAgentTransport{next: proxyTransport(httpProxy)},
+		},
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// rateLimitHeader returns response headers reporting limit calls per window,
+// remaining of them left, and the window resetting at reset.
+func rateLimitHeader(limit, remaining int, reset time.Time) http.Header {
+	h := http.Header{}
+	h.Set(rateLimitLimitHeader, strconv.Itoa(limit))
+	h.Set(rateLimitRemainingHeader, strconv.Itoa(remaining))
+	h.Set(rateLimitResetHeader, strconv.FormatInt(reset.Unix(), 10))
+	return h
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := map[string]struct {
+		header http.Header
+		want   []time.Duration
+	}{
+		"no rate limit reported": {
+			header: http.Header{},
+		},
+		"budget left": {
+			header: rateLimitHeader(100, 50, now.Add(30*time.Second)),
+		},
+		"budget exhausted": {
+			header: rateLimitHeader(100, 0, now.Add(30*time.Second)),
+			want:   []time.Duration{30 * time.Second},
+		},
+		"budget low": {
+			header: rateLimitHeader(100, 4, now.Add(50*time.Second)),
+			want:   []time.Duration{10 * time.Second},
+		},
+		"window reset": {
+			header: rateLimitHeader(100, 0, now.Add(-time.Second)),
+		},
+		"malformed reset": {
+			header: http.Header{
+				rateLimitLimitHeader:     {"100"},
+				rateLimitRemainingHeader: {"0"},
+				rateLimitResetHeader:     {"soon"},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			clk := &fakeClock{}
+			limiter := &rateLimiter{now: func() time.Time { return now }, clock: clk, log: logr.Discard()}
+
+			limiter.Observe(tt.header)
+			if err := limiter.Wait(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := clk.Delays(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected delays %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRateLimiterBlocksWhenExhausted(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := &rateLimiter{now: func() time.Time { return now }, clock: blockingClock{}, log: logr.Discard()}
+	limiter.Observe(rateLimitHeader(100, 0, now.Add(time.Minute)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to block until the context is done, got %v", err)
+	}
+}
+
+func TestRateLimiterReservesBudget(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	clk := &fakeClock{}
+	limiter := &rateLimiter{now: func() time.Time { return now }, clock: clk, log: logr.Discard()}
+	limiter.Observe(rateLimitHeader(100, 20, now.Add(time.Minute)))
+
+	for i := 0; i < 20; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Calls are made freely while at least ten of the hundred remain; the
+	// last nine share the minute left, the very last waiting half of it.
+	delays := clk.Delays()
+	if len(delays) != 9 || delays[len(delays)-1] != time.Minute/2 {
+		t.Fatalf("expected the last nine calls to be throttled, got %v", delays)
+	}
+
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if delays := clk.Delays(); delays[len(delays)-1] != time.Minute {
+		t.Errorf("expected a call beyond the budget to wait for the reset, got %v", delays)
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range rateLimitHeader(100, 0, now.Add(20*time.Second)) {
+			w.Header()[k] = v
+		}
+	}))
+	defer server.Close()
+
+	clk := &fakeClock{}
+	solver := &transipDNSProviderSolver{clock: clk, timeNow: func() time.Time { return now }}
+	client := solver.httpClient("", time.Second)
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if got := clk.Delays(); !reflect.DeepEqual(got, []time.Duration{20 * time.Second}) {
+		t.Errorf("expected the second request to wait for the reset, got %v", got)
+	}
+}
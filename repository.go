@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6/domain"
+)
+
+// dnsRepository is the part of the gotransip domain repository used to manage
+// the DNS entries of a domain. It is satisfied by *domain.Repository.
+//
+// GetDNSEntries returns all entries of the domain: the TransIP API does not
+// paginate the DNS entries of a domain, and gotransip reads them in a single
+// request. Present and CleanUp rely on this to find existing challenge
+// records, and so does ReplaceDNSEntries, which drops every entry of the
+// domain that is not passed to it.
+type dnsRepository interface {
+	GetAll() ([]domain.Domain, error)
+	GetDNSEntries(domainName string) ([]domain.DNSEntry, error)
+	AddDNSEntry(domainName string, dnsEntry domain.DNSEntry) error
+	RemoveDNSEntry(domainName string, dnsEntry domain.DNSEntry) error
+	ReplaceDNSEntries(domainName string, dnsEntries []domain.DNSEntry) error
+}
+
+// newDNSRepository returns the repository used to solve the given challenge,
+// bounding each call by the API timeout and ctx and retrying failed calls.
+// Unless the solver was set up with a repositoryFactory, it is backed by a
+// cached TransIP API client. In test mode, changes are only logged.
+func (c *transipDNSProviderSolver) newDNSRepository(ctx context.Context, ch *v1alpha1.ChallengeRequest, cfg *transipDNSProviderConfig) (dnsRepository, error) {
+	retrier, err := c.newRetrier(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var repo dnsRepository
+	if c.repositoryFactory != nil {
+		repo, err = c.repositoryFactory(ch, cfg)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		client, err := c.NewTransipClient(ctx, ch, cfg)
+		if err != nil {
+			return nil, err
+		}
+		repo = &evictingRepository{
+			repo: &domain.Repository{Client: *client},
+			evict: func() {
+				c.logger().Info("TransIP rejected the authentication of a cached client, creating a new client for the next challenge")
+				c.clients.Evict(client)
+			},
+		}
+	}
+
+	if cfg.TestMode {
+		repo = &dryRunRepository{repo: repo, log: c.logger()}
+	}
+
+	repo = &retryingRepository{
+		repo:           repo,
+		retrier:        retrier,
+		ctx:            ctx,
+		apiTimeout:     cfg.apiTimeout(),
+		requestTimeout: cfg.requestTimeout(),
+	}
+
+	return &apiErrorRepository{repo: repo}, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/transip/gotransip/v6/domain"
+)
+
+// truncatedRepository lists at most limit DNS entries, as a paginated API
+// would on its first page.
+type truncatedRepository struct {
+	*fakeDNSRepository
+	limit int
+}
+
+func (r *truncatedRepository) GetDNSEntries(domainName string) ([]domain.DNSEntry, error) {
+	entries, err := r.fakeDNSRepository.GetDNSEntries(domainName)
+	if len(entries) > r.limit {
+		entries = entries[:r.limit]
+	}
+	return entries, err
+}
+
+func TestPresentConsidersAllEntries(t *testing.T) {
+	// The challenge records are listed after 500 other entries, more than
+	// a single page of any paginated TransIP endpoint.
+	repo := newFakeDNSRepository("example.com", largeDomain(500)...)
+	solver, _ := newTestSolver(repo)
+
+	if err := solver.Present(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := repo.Calls("AddDNSEntry"); got != 0 {
+		t.Errorf("expected the existing record to be found, got %d AddDNSEntry calls", got)
+	}
+	if got := repo.Calls("GetDNSEntries"); got != 1 {
+		t.Errorf("expected the entries to be listed in a single call, got %d", got)
+	}
+}
+
+func TestPresentIncompleteEntryList(t *testing.T) {
+	fake := newFakeDNSRepository("example.com", largeDomain(10)...)
+	fake.rejectDuplicates = true
+	repo := &truncatedRepository{fakeDNSRepository: fake, limit: 5}
+	solver, logs := newTestSolver(repo)
+
+	// The existing record is not listed, so it is only found when TransIP
+	// refuses to add it again.
+	if err := solver.Present(newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})); err != nil {
+		t.Fatalf("expected a refused duplicate to be accepted, got %v", err)
+	}
+
+	if got := len(fake.Entries("example.com")); got != 12 {
+		t.Errorf("expected no duplicate record, got %d entries", got)
+	}
+	if !logs.Contains("DNS entry already exists") {
+		t.Errorf("expected the existing record to be logged, got logs:\n%s", logs)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/transip/gotransip/v6/domain"
+)
+
+const (
+	defaultRetryAttempts  = 3
+	defaultRetryBaseDelay = time.Second
+	retryMaxDelay         = 30 * time.Second
+)
+
+// jitterStrategy selects how the exponential backoff delay between retries is
+// randomized.
+type jitterStrategy string
+
+const (
+	// jitterFull waits a random duration between zero and the backoff delay.
+	jitterFull jitterStrategy = "full"
+	// jitterEqual waits half the backoff delay plus a random duration of up
+	// to the other half.
+	jitterEqual jitterStrategy = "equal"
+	// jitterNone waits exactly the backoff delay.
+	jitterNone jitterStrategy = "none"
+)
+
+// parseJitterStrategy returns the jitter strategy named s, defaulting to full
+// jitter.
+func parseJitterStrategy(s string) (jitterStrategy, error) {
+	switch jitterStrategy(s) {
+	case "":
+		return jitterFull, nil
+	case jitterFull, jitterEqual, jitterNone:
+		return jitterStrategy(s), nil
+	default:
+		return "", fmt.Errorf("invalid retryJitter %q: expected one of %q, %q or %q", s, jitterFull, jitterEqual, jitterNone)
+	}
+}
+
+// clock abstracts waiting so retry delays can be observed in tests.
+type clock interface {
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// retrier calls an operation until it succeeds or the attempts run out,
+// waiting an exponentially growing, jittered delay between attempts.
+type retrier struct {
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	jitter    jitterStrategy
+	clock     clock
+	// randInt63n returns a random number in [0, n).
+	randInt63n func(n int64) int64
+	log        logr.Logger
+}
+
+// newRetrier returns the retrier for the given config.
+func (c *transipDNSProviderSolver) newRetrier(cfg *transipDNSProviderConfig) (*retrier, error) {
+	jitter, err := parseJitterStrategy(cfg.RetryJitter)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &retrier{
+		attempts:   defaultRetryAttempts,
+		baseDelay:  defaultRetryBaseDelay,
+		maxDelay:   retryMaxDelay,
+		jitter:     jitter,
+		clock:      c.clock,
+		randInt63n: rand.Int63n,
+		log:        c.logger(),
+	}
+	if r.clock == nil {
+		r.clock = realClock{}
+	}
+	if cfg.RetryAttempts > 0 {
+		r.attempts = cfg.RetryAttempts
+	}
+	if cfg.RetryBaseDelay != nil {
+		r.baseDelay = cfg.RetryBaseDelay.Duration
+	}
+
+	return r, nil
+}
+
+// Do calls op until it succeeds, returning the error of the last attempt when
+// all attempts failed. No attempt is started once ctx is done, so that a call
+// its caller gave up on does not change the domain later on.
+func (r *retrier) Do(ctx context.Context, name string, op func() error) error {
+	var err error
+	for attempt := 1; attempt <= r.attempts; attempt++ {
+		if attempt > 1 {
+			delay := r.delay(attempt - 1)
+			r.log.V(1).Info("retrying TransIP API call", "call", name, "attempt", attempt, "delay", delay, "error", err.Error())
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("TransIP API call %s: %w", name, ctx.Err())
+			case <-r.clock.After(delay):
+			}
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("TransIP API call %s: %w", name, ctx.Err())
+		}
+
+		if err = op(); err == nil || !isRetryable(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// isRetryable reports whether a failed call may succeed when retried: when
+// TransIP is rate limiting or failing (HTTP 429 or 5xx), or when the call
+// failed without a response, e.g. on a network error. Other API errors, such
+// as authentication or validation failures, fail the same way when retried.
+// Calls that failed because their context was cancelled or timed out are not
+// retried either, even when gotransip wrapped the context error.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	switch status := apiStatusCode(err); {
+	case status == 0:
+		return true
+	case status == http.StatusTooManyRequests, status >= 500:
+		return true
+	default:
+		return false
+	}
+}
+
+// delay returns the time to wait before the given retry, counting from 1.
+func (r *retrier) delay(retry int) time.Duration {
+	backoff := r.maxDelay
+	if retry < 32 {
+		if d := r.baseDelay << (retry - 1); d > 0 && d < r.maxDelay {
+			backoff = d
+		}
+	}
+
+	switch r.jitter {
+	case jitterNone:
+		return backoff
+	case jitterEqual:
+		half := backoff / 2
+		return half + r.random(backoff-half)
+	default:
+		return r.random(backoff)
+	}
+}
+
+// random returns a random duration in [0, limit].
+func (r *retrier) random(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(r.randInt63n(int64(limit) + 1))
+}
+
+// retryingRepository retries the calls of a dnsRepository that fail. Each
+// call, including its retries, is bounded by apiTimeout and ctx, and each
+// attempt by requestTimeout, so one slow request does not use up the time left
+// for the call's other attempts. No attempt is started after the call gave up.
+//
+// gotransip does not take a context, so a read that times out is abandoned
+// and keeps running in the background until its HTTP request returns. Writes
+// are never abandoned: a late write could land after the domain lock is
+// released and undo the changes of a concurrent operation. They wait for their
+// HTTP request instead, which the HTTP client of the TransIP client cancels
+// after requestTimeout; see httpClient.
+type retryingRepository struct {
+	repo           dnsRepository
+	retrier        *retrier
+	ctx            context.Context
+	apiTimeout     time.Duration
+	requestTimeout time.Duration
+}
+
+// retryCall calls call through the retrier of r, bounding the attempts and the
+// call as a whole by their timeouts.
+func retryCall[T any](r *retryingRepository, name string, call func() (T, error)) (T, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, r.apiTimeout)
+	defer cancel()
+
+	var value T
+	err := r.retrier.Do(ctx, name, func() error {
+		var err error
+		value, err = callWithTimeout(ctx, r.requestTimeout, name, call)
+		return err
+	})
+	return value, err
+}
+
+// retryWrite calls write through the retrier of r like retryCall, but waits for
+// each attempt to return rather than abandoning it when it times out.
+func (r *retryingRepository) retryWrite(name string, write func() error) error {
+	ctx, cancel := context.WithTimeout(r.ctx, r.apiTimeout)
+	defer cancel()
+
+	return r.retrier.Do(ctx, name, write)
+}
+
+func (r *retryingRepository) GetAll() ([]domain.Domain, error) {
+	return retryCall(r, "GetAll", r.repo.GetAll)
+}
+
+func (r *retryingRepository) GetDNSEntries(domainName string) ([]domain.DNSEntry, error) {
+	return retryCall(r, "GetDNSEntries", func() ([]domain.DNSEntry, error) {
+		return r.repo.GetDNSEntries(domainName)
+	})
+}
+
+func (r *retryingRepository) AddDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	return r.retryWrite("AddDNSEntry", func() error {
+		return r.repo.AddDNSEntry(domainName, dnsEntry)
+	})
+}
+
+func (r *retryingRepository) RemoveDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	return r.retryWrite("RemoveDNSEntry", func() error {
+		return r.repo.RemoveDNSEntry(domainName, dnsEntry)
+	})
+}
+
+func (r *retryingRepository) ReplaceDNSEntries(domainName string, dnsEntries []domain.DNSEntry) error {
+	return r.retryWrite("ReplaceDNSEntries", func() error {
+		return r.repo.ReplaceDNSEntries(domainName, dnsEntries)
+	})
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/transip/gotransip/v6/domain"
+	"github.com/transip/gotransip/v6/rest"
+)
+
+func newTestRetrier(jitter jitterStrategy, clock clock) *retrier {
+	return &retrier{
+		attempts:   5,
+		baseDelay:  100 * time.Millisecond,
+		maxDelay:   time.Second,
+		jitter:     jitter,
+		clock:      clock,
+		randInt63n: rand.New(rand.NewSource(1)).Int63n,
+		log:        logr.Discard(),
+	}
+}
+
+func TestRetrierJitterStrategies(t *testing.T) {
+	// The backoff delays before each retry for a base delay of 100ms,
+	// capped at one second.
+	backoffs := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond}
+
+	tests := map[jitterStrategy]func(delay, backoff time.Duration) bool{
+		jitterNone: func(delay, backoff time.Duration) bool {
+			return delay == backoff
+		},
+		jitterEqual: func(delay, backoff time.Duration) bool {
+			return delay >= backoff/2 && delay <= backoff
+		},
+		jitterFull: func(delay, backoff time.Duration) bool {
+			return delay >= 0 && delay <= backoff
+		},
+	}
+
+	for jitter, inRange := range tests {
+		t.Run(string(jitter), func(t *testing.T) {
+			for run := 0; run < 50; run++ {
+				clock := &fakeClock{}
+				r := newTestRetrier(jitter, clock)
+
+				r.Do(context.Background(), "test", func() error { return errors.New("failed") })
+
+				delays := clock.Delays()
+				if len(delays) != len(backoffs) {
+					t.Fatalf("expected %d delays, got %v", len(backoffs), delays)
+				}
+				for i, delay := range delays {
+					if !inRange(delay, backoffs[i]) {
+						t.Fatalf("retry %d: delay %s out of range for backoff %s", i+1, delay, backoffs[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRetrierFullJitterVaries(t *testing.T) {
+	clock := &fakeClock{}
+	r := newTestRetrier(jitterFull, clock)
+	r.attempts = 20
+	r.baseDelay = time.Second
+	r.maxDelay = time.Second
+
+	r.Do(context.Background(), "test", func() error { return errors.New("failed") })
+
+	seen := map[time.Duration]bool{}
+	for _, delay := range clock.Delays() {
+		seen[delay] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("expected full jitter to produce varying delays, got %v", clock.Delays())
+	}
+}
+
+func TestRetrierDelayCapped(t *testing.T) {
+	r := newTestRetrier(jitterNone, &fakeClock{})
+
+	if got := r.delay(10); got != time.Second {
+		t.Errorf("delay(10) = %s, want the max delay of 1s", got)
+	}
+	if got := r.delay(100); got != time.Second {
+		t.Errorf("delay(100) = %s, want the max delay of 1s", got)
+	}
+}
+
+func TestRetrierStopsOnSuccess(t *testing.T) {
+	clock := &fakeClock{}
+	r := newTestRetrier(jitterNone, clock)
+
+	calls := 0
+	err := r.Do(context.Background(), "test", func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+	if len(clock.Delays()) != 2 {
+		t.Errorf("expected 2 delays, got %v", clock.Delays())
+	}
+}
+
+func TestParseJitterStrategy(t *testing.T) {
+	if got, err := parseJitterStrategy(""); err != nil || got != jitterFull {
+		t.Errorf(`parseJitterStrategy("") = %q, %v, want full jitter`, got, err)
+	}
+	if got, err := parseJitterStrategy("equal"); err != nil || got != jitterEqual {
+		t.Errorf(`parseJitterStrategy("equal") = %q, %v, want equal jitter`, got, err)
+	}
+	if _, err := parseJitterStrategy("random"); err == nil {
+		t.Error(`expected an error for parseJitterStrategy("random")`)
+	}
+}
+
+func TestRetrierDoesNotRetryContextErrors(t *testing.T) {
+	for _, ctxErr := range []error{context.Canceled, context.DeadlineExceeded} {
+		t.Run(ctxErr.Error(), func(t *testing.T) {
+			clock := &fakeClock{}
+			r := newTestRetrier(jitterNone, clock)
+
+			calls := 0
+			err := r.Do(context.Background(), "test", func() error {
+				calls++
+				return fmt.Errorf("request to TransIP failed: %w", ctxErr)
+			})
+
+			if !errors.Is(err, ctxErr) {
+				t.Errorf("Do() error = %v, want wrapped %v", err, ctxErr)
+			}
+			if calls != 1 {
+				t.Errorf("expected 1 call, got %d", calls)
+			}
+			if len(clock.Delays()) != 0 {
+				t.Errorf("expected no delays, got %v", clock.Delays())
+			}
+		})
+	}
+}
+
+func TestRetrierStopsWhenContextDone(t *testing.T) {
+	r := newTestRetrier(jitterNone, blockingClock{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Do(ctx, "test", func() error {
+			calls++
+			return errors.New("failed")
+		})
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Do() error = %v, want a cancellation error", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected Do to stop waiting for the retry when the context is done")
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+
+	if err := r.Do(ctx, "test", func() error {
+		t.Error("expected no attempt once the context is done")
+		return nil
+	}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() error = %v, want a cancellation error", err)
+	}
+}
+
+func TestPresentNoRetriesAfterAPITimeout(t *testing.T) {
+	repo := &flakyRepository{fakeDNSRepository: newFakeDNSRepository("example.com"), failures: 10, err: &rest.Error{Message: "service unavailable", StatusCode: 503}}
+	solver, _ := newTestSolver(repo)
+	solver.clock = blockingClock{}
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "apiTimeout": "50ms"})
+	if err := solver.Present(ch); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline exceeded error, got %v", err)
+	}
+
+	// The retry of the timed out call was abandoned along with it, rather
+	// than made after Present returned.
+	time.Sleep(50 * time.Millisecond)
+	if got := repo.calls["GetDNSEntries"]; got != 1 {
+		t.Errorf("expected a single attempt, got %d", got)
+	}
+}
+
+// flakyRepository fails the first failures calls to each method with err
+// before passing them on to the fake repository.
+type flakyRepository struct {
+	*fakeDNSRepository
+	failures int
+	err      error
+	calls    map[string]int
+}
+
+func (r *flakyRepository) fail(method string) error {
+	if r.calls == nil {
+		r.calls = map[string]int{}
+	}
+	r.calls[method]++
+	if r.calls[method] <= r.failures {
+		return r.err
+	}
+	return nil
+}
+
+func (r *flakyRepository) GetDNSEntries(domainName string) ([]domain.DNSEntry, error) {
+	if err := r.fail("GetDNSEntries"); err != nil {
+		return nil, err
+	}
+	return r.fakeDNSRepository.GetDNSEntries(domainName)
+}
+
+func (r *flakyRepository) AddDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	if err := r.fail("AddDNSEntry"); err != nil {
+		return err
+	}
+	return r.fakeDNSRepository.AddDNSEntry(domainName, dnsEntry)
+}
+
+func (r *flakyRepository) RemoveDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	if err := r.fail("RemoveDNSEntry"); err != nil {
+		return err
+	}
+	return r.fakeDNSRepository.RemoveDNSEntry(domainName, dnsEntry)
+}
+
+func TestPresentCleanUpRetriesTransientErrors(t *testing.T) {
+	transient := map[string]error{
+		"rate limited":  &rest.Error{Message: "rate limit exceeded", StatusCode: 429},
+		"server error":  &rest.Error{Message: "service unavailable", StatusCode: 503},
+		"network error": errors.New("dial tcp: connection reset by peer"),
+	}
+
+	for name, transientErr := range transient {
+		t.Run(name, func(t *testing.T) {
+			repo := &flakyRepository{fakeDNSRepository: newFakeDNSRepository("example.com"), failures: 2, err: transientErr}
+			solver, _ := newTestSolver(repo)
+			ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+
+			if err := solver.Present(ch); err != nil {
+				t.Fatalf("unexpected error presenting: %v", err)
+			}
+			if err := solver.CleanUp(ch); err != nil {
+				t.Fatalf("unexpected error cleaning up: %v", err)
+			}
+
+			// Each call fails twice before succeeding on the third attempt.
+			for _, method := range []string{"GetDNSEntries", "AddDNSEntry", "RemoveDNSEntry"} {
+				if got := repo.calls[method]; got < 3 {
+					t.Errorf("expected %s to be attempted 3 times, got %d", method, got)
+				}
+			}
+			if entries := repo.Entries("example.com"); len(entries) != 0 {
+				t.Errorf("expected the record to be cleaned up, got %v", entries)
+			}
+		})
+	}
+}
+
+func TestPresentDoesNotRetryPermanentErrors(t *testing.T) {
+	for _, status := range []int{400, 401, 403, 404, 409} {
+		t.Run(fmt.Sprint(status), func(t *testing.T) {
+			repo := &flakyRepository{fakeDNSRepository: newFakeDNSRepository("example.com"), failures: 2, err: &rest.Error{Message: "rejected", StatusCode: status}}
+			solver, _ := newTestSolver(repo)
+			ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+
+			if err := solver.Present(ch); err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := repo.calls["GetDNSEntries"]; got != 1 {
+				t.Errorf("expected a single attempt, got %d", got)
+			}
+		})
+	}
+}
+
+func TestPresentRetryAttempts(t *testing.T) {
+	repo := &flakyRepository{fakeDNSRepository: newFakeDNSRepository("example.com"), failures: 4, err: &rest.Error{Message: "service unavailable", StatusCode: 503}}
+	solver, _ := newTestSolver(repo)
+	clock := &fakeClock{}
+	solver.clock = clock
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "retryAttempts": 5, "retryBaseDelay": "10ms", "retryJitter": "none"})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := repo.calls["GetDNSEntries"]; got != 5 {
+		t.Errorf("expected 5 attempts, got %d", got)
+	}
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond}
+	if got := clock.Delays(); len(got) < len(want) || fmt.Sprint(got[:len(want)]) != fmt.Sprint(want) {
+		t.Errorf("expected delays %v, got %v", want, got)
+	}
+}
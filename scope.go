@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// checkAllowedNamespace rejects challenges from resource namespaces outside of
+// the allowed ones, so an Issuer in another namespace cannot use the webhook.
+// The resource namespace is the namespace of the Issuer, or cert-manager's
+// cluster resource namespace for ClusterIssuers.
+func (c *transipDNSProviderSolver) checkAllowedNamespace(ch *v1alpha1.ChallengeRequest) error {
+	if c.allowedNamespaces == nil || c.allowedNamespaces[ch.ResourceNamespace] {
+		return nil
+	}
+
+	return fmt.Errorf("challenges for resources in namespace %q are not allowed by %s", ch.ResourceNamespace, allowedNamespacesEnvVar)
+}
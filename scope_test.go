@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestInitializeAllowedNamespaces(t *testing.T) {
+	t.Setenv(allowedNamespacesEnvVar, " cert-manager, default ,,")
+
+	solver := &transipDNSProviderSolver{}
+	if err := solver.Initialize(&rest.Config{}, make(chan struct{})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(solver.allowedNamespaces) != 2 || !solver.allowedNamespaces["cert-manager"] || !solver.allowedNamespaces["default"] {
+		t.Errorf("unexpected allowed namespaces %v", solver.allowedNamespaces)
+	}
+}
+
+func TestAllowedNamespaces(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+	solver.allowedNamespaces = map[string]bool{"cert-manager": true}
+
+	allowed := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	allowed.ResourceNamespace = "cert-manager"
+	if err := solver.Present(allowed); err != nil {
+		t.Fatalf("unexpected error for an allowed namespace: %v", err)
+	}
+	if err := solver.CleanUp(allowed); err != nil {
+		t.Fatalf("unexpected error for an allowed namespace: %v", err)
+	}
+
+	rejected := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	rejected.ResourceNamespace = "tenant"
+	if err := solver.Present(rejected); err == nil || !strings.Contains(err.Error(), `namespace "tenant" are not allowed`) {
+		t.Errorf("expected Present to be rejected, got %v", err)
+	}
+	if err := solver.CleanUp(rejected); err == nil {
+		t.Error("expected CleanUp to be rejected")
+	}
+
+	if got := repo.Calls("AddDNSEntry"); got != 1 {
+		t.Errorf("expected only the allowed challenge to be presented, got %d AddDNSEntry calls", got)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook"
+)
+
+// defaultSolverName is the name of the solver when the webhook serves a
+// single one.
+const defaultSolverName = "transip"
+
+// newSolvers returns the solvers the webhook registers: one per entry of
+// solversEnvVar, or a single solver named defaultSolverName when it is unset.
+// The solvers are sorted by name. The first one serves the process-wide
+// endpoints, and all of them serialize changes to a domain through its domain
+// locks.
+func newSolvers() ([]webhook.Solver, error) {
+	value := os.Getenv(solversEnvVar)
+	if value == "" {
+		return []webhook.Solver{&transipDNSProviderSolver{}}, nil
+	}
+
+	var defaults map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &defaults); err != nil {
+		return nil, fmt.Errorf("invalid value for %s: expected a JSON object of solver names and their default configs: %w", solversEnvVar, err)
+	}
+	if len(defaults) == 0 {
+		return nil, fmt.Errorf("invalid value for %s: no solvers configured", solversEnvVar)
+	}
+
+	names := make([]string, 0, len(defaults))
+	for name := range defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var primary *transipDNSProviderSolver
+	solvers := make([]webhook.Solver, 0, len(names))
+	for _, name := range names {
+		if name == "" {
+			return nil, fmt.Errorf("invalid value for %s: empty solver name", solversEnvVar)
+		}
+		if _, err := loadConfig(&extapi.JSON{Raw: defaults[name]}); err != nil {
+			return nil, fmt.Errorf("invalid default config of solver %s in %s: %w", name, solversEnvVar, err)
+		}
+
+		solver := &transipDNSProviderSolver{name: name, defaultConfig: defaults[name], primary: primary}
+		if primary == nil {
+			primary = solver
+		}
+		solvers = append(solvers, solver)
+	}
+
+	return solvers, nil
+}
+
+// withDefaultConfig returns the config of a challenge on top of the default
+// config of the solver: top-level fields set by the Issuer replace those of
+// the defaults. Without defaults, cfgJSON is returned as it is.
+func (c *transipDNSProviderSolver) withDefaultConfig(cfgJSON *extapi.JSON) (*extapi.JSON, error) {
+	if len(c.defaultConfig) == 0 {
+		return cfgJSON, nil
+	}
+	if cfgJSON == nil || len(bytes.TrimSpace(cfgJSON.Raw)) == 0 {
+		return &extapi.JSON{Raw: c.defaultConfig}, nil
+	}
+
+	var merged, fields map[string]json.RawMessage
+	if err := json.Unmarshal(c.defaultConfig, &merged); err != nil {
+		return nil, fmt.Errorf("error decoding the default config of solver %s: %w", c.Name(), err)
+	}
+	// A config that cannot be decoded is reported by loadConfig.
+	if err := json.Unmarshal(cfgJSON.Raw, &fields); err != nil {
+		return cfgJSON, nil
+	}
+	if merged == nil {
+		merged = map[string]json.RawMessage{}
+	}
+	for field, value := range fields {
+		merged[field] = value
+	}
+
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	return &extapi.JSON{Raw: raw}, nil
+}
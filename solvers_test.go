@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestNewSolversDefault(t *testing.T) {
+	t.Setenv(solversEnvVar, "")
+
+	solvers, err := newSolvers()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(solvers) != 1 || solvers[0].Name() != defaultSolverName {
+		t.Fatalf("expected a single solver named %s, got %v", defaultSolverName, solvers)
+	}
+}
+
+func TestNewSolvers(t *testing.T) {
+	t.Setenv(solversEnvVar, `{"transip-staging": {"testMode": true, "ttl": 120}, "transip": {}}`)
+
+	solvers, err := newSolvers()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(solvers) != 2 {
+		t.Fatalf("expected 2 solvers, got %d", len(solvers))
+	}
+	production := solvers[0].(*transipDNSProviderSolver)
+	staging := solvers[1].(*transipDNSProviderSolver)
+	if production.Name() != "transip" || staging.Name() != "transip-staging" {
+		t.Fatalf("expected solvers transip and transip-staging, got %s and %s", production.Name(), staging.Name())
+	}
+	if production.primary != nil || staging.primary != production {
+		t.Error("expected the first solver to be the primary of the others")
+	}
+
+	issuerConfig := &extapi.JSON{Raw: []byte(`{"accountName": "user", "ttl": 300}`)}
+
+	cfg, err := production.loadConfig(issuerConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TestMode || cfg.TTL != 300 || cfg.AccountName != "user" {
+		t.Errorf("expected the Issuer config without defaults, got %+v", cfg)
+	}
+
+	cfg, err = staging.loadConfig(issuerConfig)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.TestMode || cfg.TTL != 300 || cfg.AccountName != "user" {
+		t.Errorf("expected the Issuer config on top of the defaults, got %+v", cfg)
+	}
+
+	cfg, err = staging.loadConfig(nil)
+	if err != nil {
+		t.Fatalf("expected the defaults to be used without an Issuer config, got %v", err)
+	}
+	if !cfg.TestMode || cfg.TTL != 120 {
+		t.Errorf("expected the defaults, got %+v", cfg)
+	}
+}
+
+func TestNewSolversInvalid(t *testing.T) {
+	for name, value := range map[string]string{
+		"not json":        `transip,transip-staging`,
+		"no solvers":      `{}`,
+		"empty name":      `{"": {}}`,
+		"invalid default": `{"transip": {"apiTimeout": "0s"}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(solversEnvVar, value)
+			if _, err := newSolvers(); err == nil {
+				t.Errorf("expected an error for %s=%s", solversEnvVar, value)
+			}
+		})
+	}
+}
+
+func TestSolversShareDomainLocks(t *testing.T) {
+	primary := &transipDNSProviderSolver{}
+	secondary := &transipDNSProviderSolver{name: "transip-staging", primary: primary}
+
+	unlock, err := secondary.lockDomain(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.domainLocks.locks) != 1 {
+		t.Errorf("expected the lock to be taken in the domain locks of the primary solver")
+	}
+	unlock()
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// checkStartupCredentials verifies the credentials in the credentials
+// directory dir by listing the domains of their account, so that unusable
+// credentials are reported when the webhook starts rather than by the first
+// challenge using them.
+func (c *transipDNSProviderSolver) checkStartupCredentials(dir string) error {
+	ctx, cancel := c.newContext()
+	defer cancel()
+
+	repo, err := c.newDNSRepository(ctx, &v1alpha1.ChallengeRequest{}, &transipDNSProviderConfig{CredentialsDir: dir})
+	if err != nil {
+		return err
+	}
+
+	domains, err := repo.GetAll()
+	if err != nil {
+		return err
+	}
+
+	c.logger().Info("verified the TransIP credentials", "credentialsDir", dir, "domains", len(domains))
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	transiprest "github.com/transip/gotransip/v6/rest"
+)
+
+func TestInitializeChecksCredentials(t *testing.T) {
+	tests := map[string]struct {
+		getAllErr error
+		want      []string
+	}{
+		"valid": {
+			want: []string{`"msg"="verified the TransIP credentials" "credentialsDir"="/etc/transip" "domains"=1`},
+		},
+		"rejected": {
+			getAllErr: &transiprest.Error{Message: "Signature could not be verified", StatusCode: 401},
+			want:      []string{`"msg"="checking the TransIP credentials failed, challenges using them will fail"`, "Signature could not be verified"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(checkCredentialsDirEnvVar, "/etc/transip")
+			t.Setenv(metricsAddressEnvVar, "127.0.0.1:0")
+
+			repo := newFakeDNSRepository("example.com")
+			repo.getAllErr = tt.getAllErr
+			solver, logs := newTestSolver(repo)
+
+			var checked *transipDNSProviderConfig
+			factory := solver.repositoryFactory
+			solver.repositoryFactory = func(ch *v1alpha1.ChallengeRequest, cfg *transipDNSProviderConfig) (dnsRepository, error) {
+				checked = cfg
+				return factory(ch, cfg)
+			}
+
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+
+			// A failing check does not keep the webhook from starting.
+			if err := solver.Initialize(&rest.Config{}, stopCh); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if checked == nil || checked.CredentialsDir != "/etc/transip" {
+				t.Fatalf("expected the credentials directory to be checked, got %+v", checked)
+			}
+			for _, want := range tt.want {
+				if !logs.Contains(want) {
+					t.Errorf("expected %s to be logged, got logs:\n%s", want, logs)
+				}
+			}
+		})
+	}
+}
+
+func TestInitializeSkipsCredentialsCheck(t *testing.T) {
+	t.Setenv(metricsAddressEnvVar, "127.0.0.1:0")
+
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	if err := solver.Initialize(&rest.Config{}, stopCh); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := repo.Calls("GetAll"); got != 0 {
+		t.Errorf("expected no credentials check without %s, got %d GetAll calls", checkCredentialsDirEnvVar, got)
+	}
+}
+
+func TestInitializeRejectsDefaultTTL(t *testing.T) {
+	t.Setenv(metricsAddressEnvVar, "127.0.0.1:0")
+	t.Setenv(healthAddressEnvVar, "127.0.0.1:0")
+
+	for _, ttl := range []string{"five minutes", "150"} {
+		t.Run(ttl, func(t *testing.T) {
+			t.Setenv(defaultTTLEnvVar, ttl)
+
+			solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+
+			err := solver.Initialize(&rest.Config{}, stopCh)
+			if err == nil || !strings.Contains(err.Error(), defaultTTLEnvVar) {
+				t.Errorf("expected the default TTL to be rejected at startup, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/cert-manager/cert-manager/pkg/issuer/acme/dns/util"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Default templates of the challenge record, reproducing the record name
+// relative to the domain and the challenge key as content.
+const (
+	defaultEntryNameTemplate    = "{{ .RecordName }}"
+	defaultEntryContentTemplate = "{{ .Key }}"
+)
+
+// entryTemplate controls the name and content of the challenge record with
+// Go templates executed on an entryTemplateData. The record type is always
+// TXT.
+type entryTemplate struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+
+	name    *template.Template
+	content *template.Template
+}
+
+// entryTemplateData is the data the templates of an entryTemplate are
+// executed on.
+type entryTemplateData struct {
+	// RecordName is the name of the record relative to Domain, e.g.
+	// _acme-challenge.www.
+	RecordName string
+	// Domain is the TransIP domain the record is created in.
+	Domain string
+	// FQDN is the fully qualified name of the challenge record, without
+	// the trailing dot.
+	FQDN string
+	// Key is the challenge key.
+	Key string
+}
+
+// compileEntryTemplate parses the entry template, using the defaults for
+// the parts that are not set.
+func (cfg *transipDNSProviderConfig) compileEntryTemplate() error {
+	if cfg.EntryTemplate == nil {
+		cfg.EntryTemplate = &entryTemplate{}
+	}
+	t := cfg.EntryTemplate
+	if t.Name == "" {
+		t.Name = defaultEntryNameTemplate
+	}
+	if t.Content == "" {
+		t.Content = defaultEntryContentTemplate
+	}
+
+	var err error
+	if t.name, err = template.New("name").Option("missingkey=error").Parse(t.Name); err != nil {
+		return fmt.Errorf("entryTemplate: invalid name template: %v", err)
+	}
+	if t.content, err = template.New("content").Option("missingkey=error").Parse(t.Content); err != nil {
+		return fmt.Errorf("entryTemplate: invalid content template: %v", err)
+	}
+
+	return nil
+}
+
+// render executes the templates for the challenge, checking that the result
+// is still a valid challenge record: a name within the domain and a TXT
+// content holding the challenge key.
+func (t *entryTemplate) render(ch *v1alpha1.ChallengeRequest, recordName, domainName string) (name, content string, err error) {
+	data := entryTemplateData{
+		RecordName: recordName,
+		Domain:     domainName,
+		FQDN:       strings.TrimSuffix(ch.ResolvedFQDN, "."),
+		Key:        ch.Key,
+	}
+
+	var b strings.Builder
+	if err := t.name.Execute(&b, data); err != nil {
+		return "", "", fmt.Errorf("entryTemplate: %v", err)
+	}
+	name = b.String()
+
+	b.Reset()
+	if err := t.content.Execute(&b, data); err != nil {
+		return "", "", fmt.Errorf("entryTemplate: %v", err)
+	}
+	content = b.String()
+
+	if err := validateRecordName(name); err != nil {
+		return "", "", fmt.Errorf("entryTemplate: %v", err)
+	}
+	if !strings.Contains(content, ch.Key) {
+		return "", "", fmt.Errorf("entryTemplate: the record content must contain the challenge key")
+	}
+
+	return name, content, nil
+}
+
+// sameRecordName reports whether a and b name the same record, ignoring case
+// and treating an empty name as @, the domain itself.
+func sameRecordName(a, b string) bool {
+	if a == "" {
+		a = "@"
+	}
+	if b == "" {
+		b = "@"
+	}
+	return strings.EqualFold(a, b)
+}
+
+// recordFQDN returns the fully qualified name of the record name in the
+// domain, where @ or an empty name is the domain itself.
+func recordFQDN(name, domainName string) string {
+	if sameRecordName(name, "@") {
+		return util.ToFqdn(domainName)
+	}
+	return util.ToFqdn(name + "." + domainName)
+}
+
+// validateRecordName checks that name is a record name relative to a domain:
+// dot-separated labels of letters, digits, hyphens and underscores, or @ for
+// the domain itself.
+func validateRecordName(name string) error {
+	if name == "@" {
+		return nil
+	}
+	if name == "" || len(name) > 253 {
+		return fmt.Errorf("invalid record name %q", name)
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("invalid record name %q", name)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return fmt.Errorf("invalid record name %q: unsupported character %q", name, r)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateEnvironment checks that the environment label of the config is a
+// single DNS label, so that it can be appended to record names.
+func validateEnvironment(env string) error {
+	if env == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Label(env); len(errs) > 0 {
+		return fmt.Errorf("invalid environment %q: %s", env, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// withEnvironment appends the environment label env, when set, to the record
+// name, so that the records of each environment are kept apart, e.g.
+// _acme-challenge.www becomes _acme-challenge.www.blue.
+func withEnvironment(name, env string) string {
+	switch {
+	case env == "":
+		return name
+	case name == "@":
+		return env
+	default:
+		return name + "." + env
+	}
+}
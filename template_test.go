@@ -0,0 +1,231 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestNewDNSEntryFromChallengeDefaultTemplate(t *testing.T) {
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+	ch := newChallengeRequest(t, "www.example.com", testKey, map[string]interface{}{"ttl": 300})
+
+	cfg, err := loadConfig(ch.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := solver.NewDNSEntryFromChallenge(ch, cfg, "example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entry.Name != "_acme-challenge.www" || entry.Content != testKey || entry.Type != "TXT" || entry.Expire != 300 {
+		t.Errorf("unexpected entry %v", entry)
+	}
+}
+
+func TestPresentCleanUpCustomEntryTemplate(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{
+		"ttl": 300,
+		"entryTemplate": map[string]string{
+			"name":    "{{ .RecordName }}.acme",
+			"content": "{{ .Key }}@{{ .Domain }}",
+		},
+	})
+	ch.ResolvedFQDN = "_acme-challenge.www.example.com."
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries := repo.Entries("example.com")
+	if len(entries) != 1 || entries[0].Name != "_acme-challenge.www.acme" || entries[0].Content != testKey+"@example.com" {
+		t.Fatalf("expected the templated record, got %v", entries)
+	}
+
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entries := repo.Entries("example.com"); len(entries) != 0 {
+		t.Errorf("expected the templated record to be removed, got %v", entries)
+	}
+}
+
+func TestEntryTemplateValidation(t *testing.T) {
+	tests := map[string]struct {
+		template map[string]string
+		wantErr  string
+	}{
+		"unparsable": {
+			template: map[string]string{"name": "{{ .RecordName"},
+			wantErr:  "invalid name template",
+		},
+		"unknown field": {
+			template: map[string]string{"content": "{{ .Token }}"},
+			wantErr:  "can't evaluate field Token",
+		},
+		"content without key": {
+			template: map[string]string{"content": "static"},
+			wantErr:  "must contain the challenge key",
+		},
+		"invalid name": {
+			template: map[string]string{"name": "{{ .RecordName }} "},
+			wantErr:  "invalid record name",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := newFakeDNSRepository("example.com")
+			solver, _ := newTestSolver(repo)
+
+			ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "entryTemplate": tt.template})
+			err := solver.Present(ch)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if got := repo.Calls("AddDNSEntry"); got != 0 {
+				t.Errorf("expected no AddDNSEntry calls, got %d", got)
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpEnvironments(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	challenges := map[string]string{"blue": testKey, "green": otherTestKey}
+	for env, key := range challenges {
+		ch := newChallengeRequest(t, "example.com", key, map[string]interface{}{"ttl": 300, "environment": env})
+		ch.ResolvedFQDN = "_acme-challenge.www.example.com."
+		if err := solver.Present(ch); err != nil {
+			t.Fatalf("%s: unexpected error: %v", env, err)
+		}
+	}
+
+	entries := repo.Entries("example.com")
+	if len(entries) != 2 {
+		t.Fatalf("expected a record per environment, got %v", entries)
+	}
+	for _, e := range entries {
+		if e.Content != challenges[strings.TrimPrefix(e.Name, "_acme-challenge.www.")] {
+			t.Errorf("unexpected record %v", e)
+		}
+	}
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "environment": "blue"})
+	ch.ResolvedFQDN = "_acme-challenge.www.example.com."
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries = repo.Entries("example.com")
+	if len(entries) != 1 || entries[0].Name != "_acme-challenge.www.green" || entries[0].Content != otherTestKey {
+		t.Errorf("expected only the green record to remain, got %v", entries)
+	}
+}
+
+func TestWithEnvironment(t *testing.T) {
+	tests := []struct {
+		name, env, want string
+	}{
+		{name: "_acme-challenge", want: "_acme-challenge"},
+		{name: "_acme-challenge.www", env: "blue", want: "_acme-challenge.www.blue"},
+		{name: "@", env: "green", want: "green"},
+	}
+
+	for _, tt := range tests {
+		if got := withEnvironment(tt.name, tt.env); got != tt.want {
+			t.Errorf("withEnvironment(%q, %q) = %q, want %q", tt.name, tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestRecordFQDN(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{name: "_acme-challenge", want: "_acme-challenge.example.com."},
+		{name: "_acme-challenge.www", want: "_acme-challenge.www.example.com."},
+		{name: "@", want: "example.com."},
+		{name: "", want: "example.com."},
+	}
+
+	for _, tt := range tests {
+		if got := recordFQDN(tt.name, "example.com"); got != tt.want {
+			t.Errorf("recordFQDN(%q, %q) = %q, want %q", tt.name, "example.com", got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigEnvironment(t *testing.T) {
+	for _, env := range []string{"Blue", "blue.green", "-blue", "blue_1", strings.Repeat("a", 64)} {
+		_, err := loadConfig(&extapi.JSON{Raw: []byte(`{"environment": "` + env + `"}`)})
+		if err == nil || !strings.Contains(err.Error(), "invalid environment") {
+			t.Errorf("%s: expected an invalid environment error, got %v", env, err)
+		}
+	}
+}
+
+func TestSameRecordName(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "@", b: "@", want: true},
+		{a: "", b: "@", want: true},
+		{a: "@", b: "", want: true},
+		{a: "_acme-challenge", b: "_ACME-challenge", want: true},
+		{a: "_acme-challenge", b: "@", want: false},
+		{a: "_acme-challenge", b: "", want: false},
+		{a: "_acme-challenge.www", b: "_acme-challenge", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := sameRecordName(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameRecordName(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestPresentCleanUpRecordNameOverride(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{
+		"ttl":                300,
+		"environment":        "blue",
+		"recordNameOverride": "_acme-challenge.validation",
+	})
+	ch.ResolvedFQDN = "_acme-challenge.www.example.com."
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entries := repo.Entries("example.com")
+	if len(entries) != 1 || entries[0].Name != "_acme-challenge.validation" || entries[0].Content != testKey {
+		t.Fatalf("expected the record at the overridden name, got %v", entries)
+	}
+
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entries := repo.Entries("example.com"); len(entries) != 0 {
+		t.Errorf("expected the record at the overridden name to be removed, got %v", entries)
+	}
+}
+
+func TestLoadConfigRecordNameOverride(t *testing.T) {
+	for _, name := range []string{"_acme-challenge..www", "_acme challenge", "."} {
+		_, err := loadConfig(&extapi.JSON{Raw: []byte(`{"recordNameOverride": "` + name + `"}`)})
+		if err == nil || !strings.Contains(err.Error(), "recordNameOverride: invalid record name") {
+			t.Errorf("%s: expected an invalid record name error, got %v", name, err)
+		}
+	}
+}
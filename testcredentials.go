@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-logr/logr"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// testCredentialsCommand is the first argument that makes the webhook binary
+// test TransIP credentials and exit, instead of serving challenges.
+const testCredentialsCommand = "test-credentials"
+
+// runTestCredentials runs the test-credentials command with args, returning
+// the exit code of the process: 0 when the credentials are valid, 1 when they
+// are not, and 2 for invalid arguments.
+func runTestCredentials(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet(testCredentialsCommand, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: webhook %s [flags]\n\nLists the domains of a TransIP account to check its credentials.\n\n", testCredentialsCommand)
+		flags.PrintDefaults()
+	}
+	accountName := flags.String("account-name", os.Getenv(ambientAccountNameEnvVar), "TransIP account name (defaults to $"+ambientAccountNameEnvVar+")")
+	privateKeyPath := flags.String("private-key-path", os.Getenv(ambientPrivateKeyPathEnvVar), "path of the private key (defaults to $"+ambientPrivateKeyPathEnvVar+")")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg := &transipDNSProviderConfig{AccountName: *accountName, PrivateKeyPath: *privateKeyPath}
+	if err := cfg.checkCredentials(); err != nil {
+		fmt.Fprintln(stderr, err)
+		flags.Usage()
+		return 2
+	}
+
+	c := &transipDNSProviderSolver{log: logr.Discard()}
+	if err := c.testCredentials(cfg, stdout); err != nil {
+		fmt.Fprintf(stderr, "the TransIP credentials of account %q do not work: %v\n", cfg.AccountName, err)
+		return 1
+	}
+	return 0
+}
+
+// testCredentials lists the domains of the account of cfg, reporting the
+// result on out.
+func (c *transipDNSProviderSolver) testCredentials(cfg *transipDNSProviderConfig, out io.Writer) error {
+	ctx, cancel := c.newContext()
+	defer cancel()
+
+	repo, err := c.newDNSRepository(ctx, &v1alpha1.ChallengeRequest{}, cfg)
+	if err != nil {
+		return err
+	}
+
+	domains, err := repo.GetAll()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "the TransIP credentials of account %q work: %d domains\n", cfg.AccountName, len(domains))
+	for _, d := range domains {
+		fmt.Fprintf(out, "  %s\n", d.Name)
+	}
+	return nil
+}
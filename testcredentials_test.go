@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/transip/gotransip/v6/rest"
+)
+
+func TestTestCredentials(t *testing.T) {
+	tests := map[string]struct {
+		getAllErr error
+		wantOut   string
+		wantErr   []string
+	}{
+		"valid": {
+			wantOut: "the TransIP credentials of account \"user\" work: 1 domains\n  example.com\n",
+		},
+		"rejected": {
+			getAllErr: &rest.Error{Message: "Signature could not be verified", StatusCode: 401},
+			wantErr:   []string{"GetAll", "401", "Signature could not be verified"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := newFakeDNSRepository("example.com")
+			repo.getAllErr = tt.getAllErr
+			solver, _ := newTestSolver(repo)
+
+			var out bytes.Buffer
+			err := solver.testCredentials(&transipDNSProviderConfig{AccountName: "user", PrivateKeyPath: "/etc/transip/privateKey"}, &out)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if out.String() != tt.wantOut {
+					t.Errorf("expected output %q, got %q", tt.wantOut, out.String())
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected the credentials to be rejected")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected the error to contain %q, got %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunTestCredentialsArguments(t *testing.T) {
+	t.Setenv(ambientAccountNameEnvVar, "")
+	t.Setenv(ambientPrivateKeyPathEnvVar, "")
+
+	tests := map[string]struct {
+		args    []string
+		wantErr string
+	}{
+		"unknown flag":        {args: []string{"-key", "x"}, wantErr: "flag provided but not defined: -key"},
+		"missing account":     {args: []string{"-private-key-path", "/etc/transip/privateKey"}, wantErr: "missing accountName"},
+		"missing private key": {args: []string{"-account-name", "user"}, wantErr: "missing privateKey"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runTestCredentials(tt.args, &stdout, &stderr); code != 2 {
+				t.Errorf("expected exit code 2, got %d", code)
+			}
+			if !strings.Contains(stderr.String(), tt.wantErr) || !strings.Contains(stderr.String(), "Usage: webhook test-credentials") {
+				t.Errorf("expected %q and the usage, got %q", tt.wantErr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunTestCredentialsMissingKeyFile(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := runTestCredentials([]string{"-account-name", "user", "-private-key-path", t.TempDir() + "/missing"}, &stdout, &stderr)
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), `the TransIP credentials of account "user" do not work: error reading private key from privateKeyPath`) {
+		t.Errorf("unexpected output %q", stderr.String())
+	}
+}
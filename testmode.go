@@ -0,0 +1,61 @@
+package main
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/transip/gotransip/v6"
+	"github.com/transip/gotransip/v6/domain"
+	"github.com/transip/gotransip/v6/repository"
+)
+
+// demoClientCacheKey, followed by the request timeout and proxy of the
+// client, is the key of the demo client in the client cache, which cannot
+// collide with the hashed keys of clientCacheKey.
+const demoClientCacheKey = "demo"
+
+// newDemoClient returns a client for the TransIP demo account, which needs
+// no credentials.
+func (c *transipDNSProviderSolver) newDemoClient(httpProxy string, requestTimeout time.Duration) (*repository.Client, error) {
+	return c.clients.Get(demoClientCacheKey+requestTimeout.String()+httpProxy, func() (repository.Client, error) {
+		c.logger().Info("creating TransIP demo client for test mode")
+
+		newClient := gotransip.NewClient
+		if c.newClient != nil {
+			newClient = c.newClient
+		}
+		demo := gotransip.DemoClientConfiguration
+		demo.HTTPClient = c.httpClient(httpProxy, requestTimeout)
+		return newClient(demo)
+	})
+}
+
+// dryRunRepository lists DNS entries through repo but only logs the changes
+// it is asked to make, for Issuers in test mode.
+type dryRunRepository struct {
+	repo dnsRepository
+	log  logr.Logger
+}
+
+func (r *dryRunRepository) GetAll() ([]domain.Domain, error) {
+	return r.repo.GetAll()
+}
+
+func (r *dryRunRepository) GetDNSEntries(domainName string) ([]domain.DNSEntry, error) {
+	return r.repo.GetDNSEntries(domainName)
+}
+
+func (r *dryRunRepository) AddDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	r.log.Info("test mode: would add DNS entry", "domain", domainName, "name", dnsEntry.Name, "type", dnsEntry.Type, "ttl", dnsEntry.Expire)
+	return nil
+}
+
+func (r *dryRunRepository) RemoveDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	r.log.Info("test mode: would remove DNS entry", "domain", domainName, "name", dnsEntry.Name, "type", dnsEntry.Type, "ttl", dnsEntry.Expire)
+	return nil
+}
+
+func (r *dryRunRepository) ReplaceDNSEntries(domainName string, dnsEntries []domain.DNSEntry) error {
+	r.log.Info("test mode: would replace DNS entries", "domain", domainName, "entries", len(dnsEntries))
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6"
+	"github.com/transip/gotransip/v6/domain"
+)
+
+func TestTestModeMakesNoChanges(t *testing.T) {
+	repo := newFakeDNSRepository("example.com",
+		domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: otherTestKey},
+	)
+	solver, logs := newTestSolver(repo)
+	cfg := map[string]interface{}{"ttl": 300, "testMode": true}
+
+	if err := solver.Present(newChallengeRequest(t, "example.com", testKey, cfg)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := solver.CleanUp(newChallengeRequest(t, "example.com", otherTestKey, cfg)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, method := range []string{"AddDNSEntry", "RemoveDNSEntry", "ReplaceDNSEntries"} {
+		if got := repo.Calls(method); got != 0 {
+			t.Errorf("expected no %s calls in test mode, got %d", method, got)
+		}
+	}
+	if got := repo.Entries("example.com"); len(got) != 1 {
+		t.Errorf("expected the entries to be unchanged, got %+v", got)
+	}
+	for _, want := range []string{`"msg"="test mode: would add DNS entry"`, `"msg"="test mode: would remove DNS entry"`} {
+		if !logs.Contains(want) {
+			t.Errorf("expected %s to be logged, got logs:\n%s", want, logs)
+		}
+	}
+}
+
+func TestTestModeSkipsFollowUps(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	repo := newFakeDNSRepository("example.com")
+	solver, logs := newTestSolver(repo)
+	solver.events = &eventRecorder{client: client, namespace: "cert-manager", pod: "transip-webhook-0", log: solver.log}
+	solver.checkPropagation = func(context.Context, string, string, []string, bool) (bool, error) {
+		t.Error("expected no propagation check in test mode")
+		return true, nil
+	}
+
+	cfg := map[string]interface{}{
+		"ttl":                300,
+		"testMode":           true,
+		"propagationCheck":   true,
+		"measurePropagation": true,
+		"verifyTTL":          true,
+		"cleanupMarker":      true,
+		"cleanupCooldown":    "1m",
+	}
+	ch := newChallengeRequest(t, "example.com", testKey, cfg)
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error presenting: %v", err)
+	}
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error cleaning up: %v", err)
+	}
+	// A cooldown started by the cleanup would delay presenting again.
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error presenting again: %v", err)
+	}
+
+	if logs.Contains(`"msg"="audit"`) {
+		t.Errorf("expected no audit log line in test mode, got logs:\n%s", logs)
+	}
+	events, err := client.CoreV1().Events("cert-manager").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 0 {
+		t.Errorf("expected no events in test mode, got %d", len(events.Items))
+	}
+	if got := solver.clock.(*fakeClock).Delays(); len(got) != 0 {
+		t.Errorf("expected no waits in test mode, got %v", got)
+	}
+	if _, ok := solver.ttls.Lookup("example.com", domain.DNSEntry{Name: "_acme-challenge", Type: "TXT", Content: testKey}); ok {
+		t.Error("expected no TTL to be recorded for a record that was not added")
+	}
+	if got := solver.presentedDomains.Add("example.org"); got != 1 {
+		t.Errorf("expected example.com not to count as a managed domain in test mode, got %d domains", got)
+	}
+}
+
+func TestTestModeCleanUpSkipsFollowUps(t *testing.T) {
+	// The record exists, e.g. from a run outside test mode, so the cleanup
+	// would remove it.
+	repo := newFakeDNSRepository("example.com",
+		domain.DNSEntry{Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: testKey},
+	)
+	solver, logs := newTestSolver(repo)
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "testMode": true, "cleanupMarker": true, "cleanupCooldown": "1m"})
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !solver.cooldowns.Until("example.com").IsZero() {
+		t.Error("expected no cleanup cooldown in test mode")
+	}
+	for _, unwanted := range []string{`"msg"="audit"`, "cleanup marker"} {
+		if logs.Contains(unwanted) {
+			t.Errorf("expected no %s in test mode, got logs:\n%s", unwanted, logs)
+		}
+	}
+}
+
+func TestNewTransipClientTestMode(t *testing.T) {
+	var configs []gotransip.ClientConfiguration
+	solver := &transipDNSProviderSolver{newClient: recordClientConfigs(&configs)}
+
+	// No credentials are needed in test mode.
+	cfg := &transipDNSProviderConfig{TestMode: true}
+	if _, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{ResourceNamespace: "default"}, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(configs) != 1 || configs[0].Token != gotransip.DemoClientConfiguration.Token {
+		t.Errorf("expected a demo client, got %+v", configs)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// defaultAPITimeout bounds each TransIP API call, including its retries,
+// and each DNS lookup unless the config sets apiTimeout.
+const defaultAPITimeout = 30 * time.Second
+
+// defaultRequestTimeout bounds each attempt of a TransIP API call unless the
+// config sets requestTimeout.
+const defaultRequestTimeout = 10 * time.Second
+
+// apiTimeout returns the time each TransIP API call, including its retries,
+// and each DNS lookup may take.
+func (cfg *transipDNSProviderConfig) apiTimeout() time.Duration {
+	if cfg.APITimeout != nil {
+		return cfg.APITimeout.Duration
+	}
+	return defaultAPITimeout
+}
+
+// requestTimeout returns the time a single attempt of a TransIP API call may
+// take. It never exceeds apiTimeout, which would bound the attempt anyway.
+func (cfg *transipDNSProviderConfig) requestTimeout() time.Duration {
+	timeout := defaultRequestTimeout
+	if cfg.RequestTimeout != nil {
+		timeout = cfg.RequestTimeout.Duration
+	}
+	return min(timeout, cfg.apiTimeout())
+}
+
+// rootContext returns the context all challenge operations derive from,
+// which is cancelled when the webhook shuts down, i.e. when the stop channel
+// passed to Initialize is closed. It is created on first use.
+func (c *transipDNSProviderSolver) rootContext() context.Context {
+	c.rootOnce.Do(func() {
+		if c.stopCh == nil {
+			c.root = context.Background()
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-c.stopCh
+			cancel()
+		}()
+		c.root = ctx
+	})
+	return c.root
+}
+
+// newContext returns the context of a challenge operation, derived from the
+// root context so that it is cancelled when the webhook shuts down.
+func (c *transipDNSProviderSolver) newContext() (context.Context, context.CancelFunc) {
+	return context.WithCancel(c.rootContext())
+}
+
+// callWithTimeout returns the result of call, or the error of the context
+// when it is done first or timeout passes. gotransip does not take a
+// context, so an abandoned call keeps running in the background until its
+// HTTP request returns; only reads, which change nothing, are bounded this
+// way. When ctx is already done, call is not started.
+func callWithTimeout[T any](ctx context.Context, timeout time.Duration, name string, call func() (T, error)) (T, error) {
+	if err := ctx.Err(); err != nil {
+		var zero T
+		return zero, fmt.Errorf("TransIP API call %s: %w", name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := call()
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, fmt.Errorf("TransIP API call %s: %w", name, ctx.Err())
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/client-go/rest"
+
+	"github.com/transip/gotransip/v6/domain"
+)
+
+func TestPresentAPITimeout(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	repo.getDelay = 5 * time.Second
+
+	solver, _ := newTestSolver(repo)
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "apiTimeout": "50ms"})
+
+	start := time.Now()
+	err := solver.Present(ch)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline exceeded error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the call to time out after 50ms, took %v", elapsed)
+	}
+	// Timed out calls are not retried.
+	if got := repo.Calls("AddDNSEntry"); got != 0 {
+		t.Errorf("expected no AddDNSEntry calls, got %d", got)
+	}
+}
+
+func TestPresentRequestTimeout(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	repo.getDelay = 5 * time.Second
+
+	solver, _ := newTestSolver(repo)
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "requestTimeout": "50ms"})
+
+	start := time.Now()
+	err := solver.Present(ch)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline exceeded error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "GetDNSEntries") {
+		t.Errorf("expected the error to name the timed out call, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the request to time out after 50ms, took %v", elapsed)
+	}
+}
+
+// slowWriteRepository delays the DNS entries added to the repository.
+type slowWriteRepository struct {
+	*fakeDNSRepository
+	delay time.Duration
+}
+
+func (r *slowWriteRepository) AddDNSEntry(domainName string, dnsEntry domain.DNSEntry) error {
+	time.Sleep(r.delay)
+	return r.fakeDNSRepository.AddDNSEntry(domainName, dnsEntry)
+}
+
+func TestPresentWaitsForSlowWrite(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(&slowWriteRepository{fakeDNSRepository: repo, delay: 200 * time.Millisecond})
+
+	// A write that outlasts the request timeout is not abandoned, so it
+	// cannot land once Present returned and the domain lock is released.
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "requestTimeout": "50ms"})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := repo.Entries("example.com"); len(got) != 1 {
+		t.Errorf("expected the record to be added by the time Present returns, got %+v", got)
+	}
+}
+
+func TestHTTPClientRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	client := (&transipDNSProviderSolver{}).httpClient("", 50*time.Millisecond)
+
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the request to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the request to be cancelled after 50ms, took %v", elapsed)
+	}
+}
+
+func TestCallWithTimeoutDoneContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := callWithTimeout(ctx, time.Second, "AddDNSEntry", func() (struct{}, error) {
+		t.Error("expected the call not to be started")
+		return struct{}{}, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancellation error, got %v", err)
+	}
+}
+
+func TestPresentZoneLookupTimeout(t *testing.T) {
+	solver, _ := newTestSolver(newFakeDNSRepository("example.com"))
+	solver.findZoneByFqdn = func(ctx context.Context, _ string, _ []string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "apiTimeout": "50ms", "strictZoneDetection": true})
+	if err := solver.Present(ch); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the zone lookup to time out, got %v", err)
+	}
+}
+
+func TestPresentCancelledOnShutdown(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	repo.getDelay = 5 * time.Second
+
+	solver, _ := newTestSolver(repo)
+	stopCh := make(chan struct{})
+	solver.stopCh = stopCh
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	done := make(chan error, 1)
+	go func() { done <- solver.Present(ch) }()
+
+	time.Sleep(50 * time.Millisecond)
+	close(stopCh)
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected a cancellation error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected Present to return when the webhook shuts down")
+	}
+}
+
+func TestCleanUpCancelledOnShutdown(t *testing.T) {
+	t.Setenv(metricsAddressEnvVar, "127.0.0.1:0")
+	t.Setenv(healthAddressEnvVar, "127.0.0.1:0")
+
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+
+	stopCh := make(chan struct{})
+	if err := solver.Initialize(&rest.Config{}, stopCh); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	repo.getDelay = 5 * time.Second
+	done := make(chan error, 1)
+	go func() { done <- solver.CleanUp(ch) }()
+
+	time.Sleep(50 * time.Millisecond)
+	close(stopCh)
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected a cancellation error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected CleanUp to return when the webhook shuts down")
+	}
+
+	// Operations started after the shutdown are cancelled from the start.
+	ctx, cancel := solver.newContext()
+	defer cancel()
+	if ctx.Err() == nil {
+		t.Error("expected a context created after the shutdown to be cancelled")
+	}
+}
+
+func TestLoadConfigAPITimeout(t *testing.T) {
+	cfg, err := loadConfig(&extapi.JSON{Raw: []byte(`{}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.apiTimeout(); got != defaultAPITimeout {
+		t.Errorf("apiTimeout = %v, want %v", got, defaultAPITimeout)
+	}
+
+	if _, err := loadConfig(&extapi.JSON{Raw: []byte(`{"apiTimeout": "0s"}`)}); err == nil {
+		t.Error("expected an error for a zero apiTimeout")
+	}
+}
+
+func TestLoadConfigRequestTimeout(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config string
+		want   time.Duration
+	}{
+		"default":          {config: `{}`, want: defaultRequestTimeout},
+		"configured":       {config: `{"requestTimeout": "2s"}`, want: 2 * time.Second},
+		"capped":           {config: `{"requestTimeout": "1m", "apiTimeout": "20s"}`, want: 20 * time.Second},
+		"short apiTimeout": {config: `{"apiTimeout": "5s"}`, want: 5 * time.Second},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := loadConfig(&extapi.JSON{Raw: []byte(tc.config)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cfg.requestTimeout(); got != tc.want {
+				t.Errorf("requestTimeout = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := loadConfig(&extapi.JSON{Raw: []byte(`{"requestTimeout": "-1s"}`)}); err == nil {
+		t.Error("expected an error for a negative requestTimeout")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6"
+	"github.com/transip/gotransip/v6/repository"
+)
+
+// usesToken reports whether the config authenticates with a TransIP API
+// access token instead of a private key.
+func (cfg *transipDNSProviderConfig) usesToken() bool {
+	return cfg.Token != "" || cfg.TokenSecretRef.Name != ""
+}
+
+// tokenAccountKey identifies the account of a token config without an account
+// name, without revealing the token.
+func (cfg *transipDNSProviderConfig) tokenAccountKey() string {
+	if cfg.Token == "" {
+		return "token-secret:" + cfg.TokenSecretRef.Name + "/" + cfg.TokenSecretRef.Key
+	}
+
+	sum := sha256.Sum256([]byte(cfg.Token))
+	return "token:" + hex.EncodeToString(sum[:8])
+}
+
+// newTokenClient returns a TransIP API client authenticating with the access
+// token of the config, read from the token Secret when not given inline.
+func (c *transipDNSProviderSolver) newTokenClient(ctx context.Context, ch *v1alpha1.ChallengeRequest, cfg *transipDNSProviderConfig) (*repository.Client, error) {
+	token := cfg.Token
+	source := credentialSourceInline
+
+	if token == "" {
+		source = credentialSourceSecret
+		secret, err := c.getSecret(ctx, ch.ResourceNamespace, cfg.TokenSecretRef.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := secretKey(secret, cfg.TokenSecretRef.Key, "token")
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	return c.clients.Get(clientCacheKey(cfg.AccountName, []byte(token), cfg.ReadOnly, cfg.HTTPProxy, cfg.requestTimeout()), func() (repository.Client, error) {
+		// As with private keys, the token itself is never logged.
+		c.logger().Info("creating TransIP client", "account", cfg.AccountName, "source", source, "auth", "token")
+
+		newClient := gotransip.NewClient
+		if c.newClient != nil {
+			newClient = c.newClient
+		}
+
+		client, err := newClient(gotransip.ClientConfiguration{
+			AccountName: cfg.AccountName,
+			Token:       token,
+			ReadOnly:    cfg.ReadOnly,
+			HTTPClient:  c.httpClient(cfg.HTTPProxy, cfg.requestTimeout()),
+		})
+		if err != nil {
+			return client, err
+		}
+
+		credentialSourceTotal.WithLabelValues(credentialSourceToken).Inc()
+
+		return client, nil
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/transip/gotransip/v6"
+	"github.com/transip/gotransip/v6/repository"
+)
+
+const testToken = "eyJ0eXAiOiJKV1QiLCJhbGciOiJSUzUxMiJ9.test.token"
+
+// recordClientConfigs returns a newClient function recording the
+// configurations clients are created with.
+func recordClientConfigs(configs *[]gotransip.ClientConfiguration) func(gotransip.ClientConfiguration) (repository.Client, error) {
+	return func(cfg gotransip.ClientConfiguration) (repository.Client, error) {
+		*configs = append(*configs, cfg)
+		return repository.Client{}, nil
+	}
+}
+
+func TestNewTransipClientToken(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "transip-credentials", Namespace: "default"},
+		Data:       map[string][]byte{"token": []byte(testToken + "\n")},
+	})
+
+	tests := map[string]*transipDNSProviderConfig{
+		"inline": {Token: testToken},
+		"secret": {
+			AccountName:    "user",
+			TokenSecretRef: v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "transip-credentials"}, Key: "token"},
+		},
+	}
+
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			log, logs := newTestLogger()
+			var configs []gotransip.ClientConfiguration
+			solver := &transipDNSProviderSolver{client: client, log: log, newClient: recordClientConfigs(&configs)}
+
+			if _, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{ResourceNamespace: "default"}, cfg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(configs) != 1 {
+				t.Fatalf("expected one client, got %d", len(configs))
+			}
+			if configs[0].Token != testToken || configs[0].PrivateKeyReader != nil || configs[0].AccountName != cfg.AccountName {
+				t.Errorf("expected a token client configuration for account %q, got %+v", cfg.AccountName, configs[0])
+			}
+			if !logs.Contains(`"source"="` + name + `" "auth"="token"`) {
+				t.Errorf("expected the token source to be logged, got logs:\n%s", logs)
+			}
+			if logs.Contains(testToken) {
+				t.Errorf("expected the token not to be logged, got logs:\n%s", logs)
+			}
+		})
+	}
+}
+
+func TestNewTransipClientTokenMissingFromSecret(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "transip-credentials", Namespace: "default"},
+		Data:       map[string][]byte{"privateKey": []byte("...")},
+	})
+	var configs []gotransip.ClientConfiguration
+	solver := &transipDNSProviderSolver{client: client, newClient: recordClientConfigs(&configs)}
+	cfg := &transipDNSProviderConfig{
+		TokenSecretRef: v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "transip-credentials"}, Key: "token"},
+	}
+
+	_, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{ResourceNamespace: "default"}, cfg)
+	if !errors.Is(err, ErrSecretKeyNotFound) {
+		t.Fatalf("expected ErrSecretKeyNotFound for a secret without the token, got %v", err)
+	}
+	if len(configs) != 0 {
+		t.Errorf("expected no client to be created, got %d", len(configs))
+	}
+}
+
+func TestNewTransipClientTokenAndPrivateKey(t *testing.T) {
+	var configs []gotransip.ClientConfiguration
+	solver := &transipDNSProviderSolver{newClient: recordClientConfigs(&configs)}
+	cfg := &transipDNSProviderConfig{AccountName: "user", Token: testToken, PrivateKey: testPrivateKey(t)}
+
+	_, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{}, cfg)
+	if err == nil {
+		t.Fatal("expected an error when both a token and a private key are configured")
+	}
+	if len(configs) != 0 {
+		t.Errorf("expected no client to be created, got %d", len(configs))
+	}
+}
+
+func TestAccountKeyToken(t *testing.T) {
+	inline := &transipDNSProviderConfig{Token: testToken}
+	if key := inline.accountKey(); key == "" || key == testToken {
+		t.Errorf("expected a key identifying the token without revealing it, got %q", key)
+	}
+	if other := (&transipDNSProviderConfig{Token: testToken + "2"}).accountKey(); other == inline.accountKey() {
+		t.Error("expected different tokens to have different keys")
+	}
+	if key := (&transipDNSProviderConfig{Token: testToken, AccountName: "user"}).accountKey(); key != "user" {
+		t.Errorf("expected the account name as key, got %q", key)
+	}
+}
+
+func TestNewTransipClientReadOnly(t *testing.T) {
+	for _, readOnly := range []bool{false, true} {
+		var configs []gotransip.ClientConfiguration
+		solver := &transipDNSProviderSolver{newClient: recordClientConfigs(&configs)}
+
+		for _, cfg := range []*transipDNSProviderConfig{
+			{Token: testToken, ReadOnly: readOnly},
+			{AccountName: "user", PrivateKey: testPrivateKey(t), ReadOnly: readOnly},
+		} {
+			if _, err := solver.NewTransipClient(context.Background(), &v1alpha1.ChallengeRequest{}, cfg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		for _, cfg := range configs {
+			if cfg.ReadOnly != readOnly {
+				t.Errorf("expected ReadOnly %v, got %v", readOnly, cfg.ReadOnly)
+			}
+		}
+	}
+}
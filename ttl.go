@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/transip/gotransip/v6/domain"
+	"k8s.io/klog/v2"
+)
+
+// defaultTTL is the TTL, in seconds, of challenge records whose config does
+// not set a positive ttl.
+const defaultTTL = 300
+
+// configuredDefaultTTL returns the TTL of challenge records whose config does
+// not set a positive ttl: the one in defaultTTLEnvVar, or defaultTTL when that
+// is unset or zero. As it applies to every Issuer whatever its ttlClampMode,
+// it must be a TTL TransIP accepts.
+func configuredDefaultTTL() (int, error) {
+	ttl, err := envInt(defaultTTLEnvVar)
+	if err != nil {
+		return 0, err
+	}
+	if ttl == 0 {
+		return defaultTTL, nil
+	}
+	if _, err := validateTTL(ttl, ttlReject); err != nil {
+		return 0, fmt.Errorf("invalid value %q for %s: %w", strconv.Itoa(ttl), defaultTTLEnvVar, err)
+	}
+	return ttl, nil
+}
+
+// transipTTLs are the TTL values, in seconds, that TransIP offers for DNS
+// entries. Other values may be normalized by the API to one of these.
+var transipTTLs = []int{60, 300, 3600, 86400}
+
+// nearestTransipTTL returns the TransIP TTL closest to ttl, preferring the
+// larger value on a tie.
+func nearestTransipTTL(ttl int) int {
+	nearest := transipTTLs[0]
+	for _, allowed := range transipTTLs[1:] {
+		if abs(allowed-ttl) <= abs(nearest-ttl) {
+			nearest = allowed
+		}
+	}
+	return nearest
+}
+
+// ttlClampMode selects what loadConfig does with a ttl that is not one of
+// transipTTLs.
+type ttlClampMode string
+
+const (
+	// ttlReject rejects the config.
+	ttlReject ttlClampMode = "reject"
+	// ttlClamp uses the nearest TransIP TTL instead.
+	ttlClamp ttlClampMode = "clamp"
+	// ttlPassThrough sends the ttl as is, for accounts where TransIP
+	// normalizes it.
+	ttlPassThrough ttlClampMode = "none"
+)
+
+// validateTTL returns the TTL to use for ttl according to mode, which
+// defaults to rejecting TTLs that TransIP does not offer.
+func validateTTL(ttl int, mode ttlClampMode) (int, error) {
+	for _, allowed := range transipTTLs {
+		if ttl == allowed {
+			return ttl, nil
+		}
+	}
+
+	switch mode {
+	case "", ttlReject:
+		return 0, fmt.Errorf("ttl %d is not accepted by TransIP, which accepts %s seconds: set one of these, or set ttlClampMode to %q to use the nearest", ttl, formatTTLs(), ttlClamp)
+	case ttlClamp:
+		nearest := nearestTransipTTL(ttl)
+		klog.Background().Info("ttl is not accepted by TransIP, using the nearest accepted ttl", "ttl", ttl, "nearest", nearest)
+		return nearest, nil
+	case ttlPassThrough:
+		return ttl, nil
+	default:
+		return 0, fmt.Errorf("invalid ttlClampMode %q: expected one of %q, %q or %q", mode, ttlReject, ttlClamp, ttlPassThrough)
+	}
+}
+
+// formatTTLs lists transipTTLs for error messages, e.g. "60, 300, 3600 or
+// 86400".
+func formatTTLs() string {
+	ttls := make([]string, len(transipTTLs))
+	for i, ttl := range transipTTLs {
+		ttls[i] = strconv.Itoa(ttl)
+	}
+	return strings.Join(ttls[:len(ttls)-1], ", ") + " or " + ttls[len(ttls)-1]
+}
+
+// jitteredTTL returns ttl raised by a random number of seconds in
+// [0, jitter], using intn to pick it.
+func jitteredTTL(ttl, jitter int, intn func(n int) int) int {
+	if jitter <= 0 {
+		return ttl
+	}
+	return ttl + intn(jitter+1)
+}
+
+// sameRecord reports whether a and b are the same record, ignoring their TTL,
+// which may have been jittered or normalized by TransIP.
+func sameRecord(a, b domain.DNSEntry) bool {
+	return sameRecordName(a.Name, b.Name) && a.Type == b.Type && a.Content == b.Content
+}
+
+// acceptedTTL reports whether ttl, the TTL of an existing challenge record,
+// satisfies the config: it is the configured TTL, the TTL TransIP normalizes
+// it to, or within the configured jitter of it.
+func acceptedTTL(ttl int, cfg *transipDNSProviderConfig) bool {
+	if ttl == nearestTransipTTL(cfg.TTL) {
+		return true
+	}
+	return ttl >= cfg.TTL && ttl <= cfg.TTL+cfg.TTLJitter
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// verifyStoredTTL re-reads the entries of the domain after a record has been
+// added and warns when TransIP stored a TTL other than the requested one or
+// its normalized value, which typically means the account's plan enforces a
+// minimum TTL.
+func (c *transipDNSProviderSolver) verifyStoredTTL(repo dnsRepository, domainName string, entry domain.DNSEntry) {
+	log := c.logger().WithValues("domain", domainName, "name", entry.Name)
+
+	entries, err := repo.GetDNSEntries(domainName)
+	if err != nil {
+		log.Error(err, "could not re-read DNS entries to verify the TTL")
+		return
+	}
+
+	for _, e := range entries {
+		if !sameRecordName(e.Name, entry.Name) || e.Type != entry.Type || e.Content != entry.Content {
+			continue
+		}
+
+		if e.Expire != entry.Expire && e.Expire != nearestTransipTTL(entry.Expire) {
+			log.Info("WARNING: TransIP stored a different TTL than requested", "requestedTTL", entry.Expire, "storedTTL", e.Expire)
+		}
+		return
+	}
+
+	log.Info("WARNING: added DNS entry was not returned when verifying its TTL")
+}
+
+// warnConflictingTTLs warns when other TXT records at the name of entry, such
+// as those of concurrent challenges presented by other Issuers, have a
+// different TTL. Each record keeps the TTL it was created with: the webhook
+// never changes the TTL of another challenge's record, so which TTL resolvers
+// see for the name is up to the nameservers.
+func (c *transipDNSProviderSolver) warnConflictingTTLs(domainName string, entry domain.DNSEntry, entries []domain.DNSEntry) {
+	for _, e := range entries {
+		if !sameRecordName(e.Name, entry.Name) || e.Type != entry.Type || e.Content == entry.Content {
+			continue
+		}
+
+		if e.Expire != entry.Expire {
+			c.logger().Info("WARNING: other TXT records with the same name have a different TTL, each record keeps its own TTL",
+				"domain", domainName, "name", entry.Name, "ttl", entry.Expire, "existingTTL", e.Expire)
+			return
+		}
+	}
+}
+
+// presentedTTLs records the TTL each challenge record was presented with, so
+// that cleanup can remove a record it cannot list with the TTL it was stored
+// with, even when the TTL was jittered or the config changed since. The zero
+// value is ready to use.
+type presentedTTLs struct {
+	mu   sync.Mutex
+	ttls map[string]int
+}
+
+// presentedTTLKey identifies the challenge record entry in domainName.
+func presentedTTLKey(domainName string, entry domain.DNSEntry) string {
+	name := entry.Name
+	if name == "" {
+		name = "@"
+	}
+	return strings.ToLower(domainName) + "\x00" + strings.ToLower(name) + "\x00" + entry.Content
+}
+
+// Record records the TTL of entry as presented in domainName.
+func (p *presentedTTLs) Record(domainName string, entry domain.DNSEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ttls == nil {
+		p.ttls = map[string]int{}
+	}
+	p.ttls[presentedTTLKey(domainName, entry)] = entry.Expire
+}
+
+// Lookup returns the TTL entry was presented with in domainName, if recorded.
+func (p *presentedTTLs) Lookup(domainName string, entry domain.DNSEntry) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ttl, ok := p.ttls[presentedTTLKey(domainName, entry)]
+	return ttl, ok
+}
+
+// Forget drops the TTL recorded for entry in domainName once it is cleaned up.
+func (p *presentedTTLs) Forget(domainName string, entry domain.DNSEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.ttls, presentedTTLKey(domainName, entry))
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	"github.com/transip/gotransip/v6/domain"
+	"github.com/transip/gotransip/v6/rest"
+)
+
+func TestNearestTransipTTL(t *testing.T) {
+	tests := map[int]int{
+		1:     60,
+		60:    60,
+		120:   60,
+		200:   300,
+		300:   300,
+		2000:  3600,
+		90000: 86400,
+	}
+
+	for ttl, want := range tests {
+		if got := nearestTransipTTL(ttl); got != want {
+			t.Errorf("nearestTransipTTL(%d) = %d, want %d", ttl, got, want)
+		}
+	}
+}
+
+func TestPresentVerifyTTLWarnsOnDifferentStoredTTL(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	// Simulate a plan that enforces a minimum TTL of one hour.
+	repo.storedTTL = func(int) int { return 3600 }
+
+	solver, logs := newTestSolver(repo)
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 60, "verifyTTL": true})
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !logs.Contains("TransIP stored a different TTL than requested") {
+		t.Errorf("expected a TTL warning, got logs:\n%s", logs)
+	}
+	if !logs.Contains(`"storedTTL"=3600`) {
+		t.Errorf("expected the stored TTL to be logged, got logs:\n%s", logs)
+	}
+}
+
+func TestPresentVerifyTTLAcceptsNormalizedTTL(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	repo.storedTTL = nearestTransipTTL
+
+	solver, logs := newTestSolver(repo)
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 120, "ttlClampMode": "none", "verifyTTL": true})
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if logs.Contains("WARNING") {
+		t.Errorf("expected no warning for a normalized TTL, got logs:\n%s", logs)
+	}
+}
+
+func TestPresentVerifyTTLDisabled(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	repo.storedTTL = func(int) int { return 3600 }
+
+	solver, logs := newTestSolver(repo)
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 60})
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := repo.Calls("GetDNSEntries"); got != 1 {
+		t.Errorf("expected 1 GetDNSEntries call without verifyTTL, got %d", got)
+	}
+	if logs.Contains("WARNING") {
+		t.Errorf("expected no warning without verifyTTL, got logs:\n%s", logs)
+	}
+}
+
+func TestPresentConflictingTTLs(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, logs := newTestSolver(repo)
+
+	first := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300})
+	if err := solver.Present(first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if logs.Contains("WARNING") {
+		t.Fatalf("expected no warning for the first record, got logs:\n%s", logs)
+	}
+
+	second := newChallengeRequest(t, "example.com", otherTestKey, map[string]interface{}{"ttl": 60})
+	if err := solver.Present(second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !logs.Contains("other TXT records with the same name have a different TTL") {
+		t.Errorf("expected a conflicting TTL warning, got logs:\n%s", logs)
+	}
+
+	// Each record keeps the TTL it was presented with.
+	ttls := map[string]int{}
+	for _, e := range repo.Entries("example.com") {
+		ttls[e.Content] = e.Expire
+	}
+	if ttls[testKey] != 300 || ttls[otherTestKey] != 60 {
+		t.Errorf("expected TTLs 300 and 60 to be kept, got %v", ttls)
+	}
+}
+
+func TestJitteredTTL(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	seen := map[int]bool{}
+	for i := 0; i < 1000; i++ {
+		ttl := jitteredTTL(300, 30, rng.Intn)
+		if ttl < 300 || ttl > 330 {
+			t.Fatalf("jitteredTTL(300, 30) = %d, want a value in [300, 330]", ttl)
+		}
+		seen[ttl] = true
+	}
+	if !seen[300] || !seen[330] {
+		t.Errorf("expected both bounds to be reachable, got %v", seen)
+	}
+
+	if got := jitteredTTL(300, 0, rng.Intn); got != 300 {
+		t.Errorf("jitteredTTL(300, 0) = %d, want 300", got)
+	}
+}
+
+func TestPresentTTLJitter(t *testing.T) {
+	repo := newFakeDNSRepository("example.com")
+	solver, _ := newTestSolver(repo)
+	solver.randIntn = func(n int) int { return n - 1 }
+
+	ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "ttlJitter": 30})
+
+	// Presenting again finds the record despite its jittered TTL.
+	for i := 0; i < 2; i++ {
+		if err := solver.Present(ch); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	entries := repo.Entries("example.com")
+	if len(entries) != 1 || entries[0].Expire != 330 {
+		t.Fatalf("expected one record with TTL 330, got %v", entries)
+	}
+
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if entries := repo.Entries("example.com"); len(entries) != 0 {
+		t.Errorf("expected the jittered record to be removed, got %v", entries)
+	}
+}
+
+func TestLoadConfigTTLJitter(t *testing.T) {
+	for _, raw := range []string{
+		`{"ttlJitter": -1}`,
+		`{"ttlJitter": 30, "tolerateListForbidden": true}`,
+	} {
+		if _, err := loadConfig(&extapi.JSON{Raw: []byte(raw)}); err == nil {
+			t.Errorf("loadConfig(%s): expected an error", raw)
+		}
+	}
+}
+
+func TestLoadConfigDefaultTTL(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		want   int
+	}{
+		"empty config": {config: `{}`, want: defaultTTL},
+		"zero":         {config: `{"ttl": 0}`, want: defaultTTL},
+		"negative":     {config: `{"ttl": -60}`, want: defaultTTL},
+		"positive":     {config: `{"ttl": 60}`, want: 60},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := loadConfig(&extapi.JSON{Raw: []byte(tt.config)})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.TTL != tt.want {
+				t.Errorf("ttl = %d, want %d", cfg.TTL, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDefaultTTLFromEnv(t *testing.T) {
+	tests := map[string]struct {
+		env     string
+		config  string
+		want    int
+		wantErr string
+	}{
+		"env default":     {env: "3600", config: `{}`, want: 3600},
+		"zero ttl":        {env: "3600", config: `{"ttl": 0}`, want: 3600},
+		"config override": {env: "3600", config: `{"ttl": 60}`, want: 60},
+		"zero env":        {env: "0", config: `{}`, want: defaultTTL},
+		"not accepted":    {env: "150", config: `{}`, wantErr: `invalid value "150" for TRANSIP_DEFAULT_TTL: ttl 150 is not accepted by TransIP`},
+		"clamp mode":      {env: "150", config: `{"ttlClampMode": "clamp"}`, wantErr: "ttl 150 is not accepted by TransIP"},
+		"invalid":         {env: "five minutes", config: `{}`, wantErr: `invalid value "five minutes" for TRANSIP_DEFAULT_TTL`},
+		"negative":        {env: "-60", config: `{}`, wantErr: `invalid value "-60" for TRANSIP_DEFAULT_TTL`},
+		"invalid, unused": {env: "five minutes", config: `{"ttl": 60}`, want: 60},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(defaultTTLEnvVar, tt.env)
+
+			cfg, err := loadConfig(&extapi.JSON{Raw: []byte(tt.config)})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.TTL != tt.want {
+				t.Errorf("ttl = %d, want %d", cfg.TTL, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTTL(t *testing.T) {
+	tests := []struct {
+		ttl     int
+		mode    ttlClampMode
+		want    int
+		wantErr string
+	}{
+		{ttl: 3600, want: 3600},
+		{ttl: 3600, mode: ttlClamp, want: 3600},
+		{ttl: 150, wantErr: "ttl 150 is not accepted by TransIP, which accepts 60, 300, 3600 or 86400 seconds"},
+		{ttl: 150, mode: ttlReject, wantErr: "ttl 150 is not accepted by TransIP"},
+		{ttl: 150, mode: ttlClamp, want: 60},
+		{ttl: 200, mode: ttlClamp, want: 300},
+		{ttl: 100000, mode: ttlClamp, want: 86400},
+		{ttl: 150, mode: ttlPassThrough, want: 150},
+		{ttl: 150, mode: "round", wantErr: "invalid ttlClampMode"},
+	}
+
+	for _, tt := range tests {
+		got, err := validateTTL(tt.ttl, tt.mode)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateTTL(%d, %q): expected an error containing %q, got %v", tt.ttl, tt.mode, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("validateTTL(%d, %q) = %d, %v, want %d", tt.ttl, tt.mode, got, err, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigTTLClampMode(t *testing.T) {
+	if _, err := loadConfig(&extapi.JSON{Raw: []byte(`{"ttl": 150}`)}); err == nil || !strings.Contains(err.Error(), "not accepted by TransIP") {
+		t.Errorf("expected the ttl to be rejected, got %v", err)
+	}
+
+	cfg, err := loadConfig(&extapi.JSON{Raw: []byte(`{"ttl": 150, "ttlClampMode": "clamp"}`)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TTL != 60 {
+		t.Errorf("expected the ttl to be clamped to 60, got %d", cfg.TTL)
+	}
+}
+
+func TestPresentCorrectsExistingTTL(t *testing.T) {
+	for _, batch := range []bool{false, true} {
+		existing := domain.DNSEntry{Name: "_acme-challenge", Expire: 3600, Type: "TXT", Content: testKey}
+		other := domain.DNSEntry{Name: "www", Expire: 300, Type: "A", Content: "192.0.2.1"}
+		repo := newFakeDNSRepository("example.com", other, existing)
+
+		solver, logs := newTestSolver(repo)
+		ch := newChallengeRequest(t, "example.com", testKey, map[string]interface{}{"ttl": 300, "batchUpdates": batch})
+		if err := solver.Present(ch); err != nil {
+			t.Fatalf("batch=%v: unexpected error: %v", batch, err)
+		}
+
+		want := []domain.DNSEntry{other, {Name: "_acme-challenge", Expire: 300, Type: "TXT", Content: testKey}}
+		if got := repo.Entries("example.com"); !reflect.DeepEqual(got, want) {
+			t.Errorf("batch=%v: expected the TTL to be corrected, got %+v", batch, got)
+		}
+		if !logs.Contains(`"existingTTL"=3600`) {
+			t.Errorf("batch=%v: expected the TTL update to be logged, got logs:\n%s", batch, logs)
+		}
+	}
+}
+
+func TestPresentKeepsMatchingTTL(t *testing.T) {
+	for name, tc := range map[string]struct {
+		existing int
+		config   map[string]interface{}
+	}{
+		"same":       {existing: 300, config: map[string]interface{}{"ttl": 300}},
+		"normalized": {existing: 60, config: map[string]interface{}{"ttl": 120, "ttlClampMode": "none"}},
+		"jittered":   {existing: 310, config: map[string]interface{}{"ttl": 300, "ttlJitter": 30}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			existing := domain.DNSEntry{Name: "_acme-challenge", Expire: tc.existing, Type: "TXT", Content: testKey}
+			repo := newFakeDNSRepository("example.com", existing)
+
+			solver, _ := newTestSolver(repo)
+			if err := solver.Present(newChallengeRequest(t, "example.com", testKey, tc.config)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, method := range []string{"AddDNSEntry", "RemoveDNSEntry", "ReplaceDNSEntries"} {
+				if got := repo.Calls(method); got != 0 {
+					t.Errorf("expected no %s calls for a matching record, got %d", method, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPresentCleanUpAgreeOnTTL(t *testing.T) {
+	tests := map[string]struct {
+		present, cleanUp map[string]interface{}
+		listForbidden    bool
+	}{
+		"default then explicit": {
+			present: map[string]interface{}{},
+			cleanUp: map[string]interface{}{"ttl": 60},
+		},
+		"explicit then changed": {
+			present: map[string]interface{}{"ttl": 60},
+			cleanUp: map[string]interface{}{"ttl": 3600},
+		},
+		"unlisted, changed": {
+			present:       map[string]interface{}{"ttl": 60, "tolerateListForbidden": true},
+			cleanUp:       map[string]interface{}{"ttl": 3600, "tolerateListForbidden": true},
+			listForbidden: true,
+		},
+		"unlisted, jittered": {
+			present:       map[string]interface{}{"ttl": 300, "ttlJitter": 30, "tolerateListForbidden": true},
+			cleanUp:       map[string]interface{}{"ttl": 300, "ttlJitter": 30, "tolerateListForbidden": true},
+			listForbidden: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := newFakeDNSRepository("example.com")
+			if tt.listForbidden {
+				repo.getErr = &rest.Error{Message: "this key is not allowed to list DNS entries", StatusCode: 403}
+			}
+			solver, _ := newTestSolver(repo)
+			solver.randIntn = func(n int) int { return n / 2 }
+
+			if err := solver.Present(newChallengeRequest(t, "example.com", testKey, tt.present)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(repo.Entries("example.com")) != 1 {
+				t.Fatalf("expected the challenge record, got %v", repo.Entries("example.com"))
+			}
+
+			if err := solver.CleanUp(newChallengeRequest(t, "example.com", testKey, tt.cleanUp)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if entries := repo.Entries("example.com"); len(entries) != 0 {
+				t.Errorf("expected the record to be removed whatever the TTL, got %v", entries)
+			}
+		})
+	}
+}
+
+func TestPresentedTTLs(t *testing.T) {
+	var ttls presentedTTLs
+	entry := domain.DNSEntry{Name: "_acme-challenge", Type: "TXT", Content: testKey, Expire: 317}
+
+	ttls.Record("Example.com", entry)
+	entry.Expire = 300
+	if ttl, ok := ttls.Lookup("example.com", domain.DNSEntry{Name: "_ACME-challenge", Type: "TXT", Content: testKey}); !ok || ttl != 317 {
+		t.Errorf("expected the recorded TTL 317, got %d, %v", ttl, ok)
+	}
+	if _, ok := ttls.Lookup("example.com", domain.DNSEntry{Name: "_acme-challenge", Type: "TXT", Content: otherTestKey}); ok {
+		t.Error("expected no TTL for another challenge")
+	}
+
+	ttls.Forget("example.com", entry)
+	if _, ok := ttls.Lookup("example.com", entry); ok {
+		t.Error("expected the TTL to be forgotten")
+	}
+}
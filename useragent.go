@@ -0,0 +1,30 @@
+package main
+
+import "net/http"
+
+// version is the version of the webhook, set at build time with
+// -ldflags "-X main.version=<version>".
+var version = "dev"
+
+// userAgent identifies the webhook to the TransIP API.
+func userAgent() string {
+	return "cert-manager-webhook-transip/" + version
+}
+
+// userAgentTransport prefixes the User-Agent of each request with that of the
+// webhook, keeping the one gotransip sets after it.
+type userAgentTransport struct {
+	next http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ua := userAgent()
+	if existing := req.Header.Get("User-Agent"); existing != "" {
+		ua += " " + existing
+	}
+
+	// A RoundTripper must not modify the request it is given.
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", ua)
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPClientUserAgent(t *testing.T) {
+	defer func(v string) { version = v }(version)
+	version = "v1.2.3"
+
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("User-Agent"))
+	}))
+	defer server.Close()
+
+	client := (&transipDNSProviderSolver{}).httpClient("", time.Second)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User-Agent", "gotransip/6.26.0")
+	for _, r := range []*http.Request{req, req.Clone(req.Context())} {
+		resp, err := client.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	want := "cert-manager-webhook-transip/v1.2.3 gotransip/6.26.0"
+	if len(got) != 2 || got[0] != want || got[1] != want {
+		t.Errorf("expected the User-Agent %q on every request, got %q", want, got)
+	}
+	if ua := req.Header.Get("User-Agent"); ua != "gotransip/6.26.0" {
+		t.Errorf("expected the request itself not to be modified, got User-Agent %q", ua)
+	}
+}